@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/config"
+	"github.com/mishudark/eventhus/deadletterstore/badger"
+	"github.com/mishudark/eventhus/eventbus"
+)
+
+const deadLetterUsage = `usage: eventhus deadletter -store <dir> [flags] <list|inspect|replay> [id...]
+
+	list		prints the dead letters, oldest first
+	inspect <id>	prints a dead letter as json
+	replay [id...]	publishes the dead letters of -target again, all of them without ids
+
+The badger store is locked by the process that opened it, stop the
+application before running the command.
+
+flags:`
+
+func deadLetter(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("deadletter", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprintln(out, deadLetterUsage)
+		flags.PrintDefaults()
+	}
+
+	dir := flags.String("store", "", "directory of the badger dead letter store")
+	bus := flags.String("bus", "nats", "event bus used by replay: nats, kafka or redis")
+	url := flags.String("url", "", "address of the event bus, comma separated kafka brokers")
+	target := flags.String("target", "", "replays only the dead letters of this target, required when they have several")
+
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if *dir == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing store or subcommand")
+	}
+
+	store, err := badger.NewClient(*dir)
+	if err != nil {
+		return err
+	}
+	defer store.CloseClient()
+
+	ids := flags.Args()[1:]
+
+	switch flags.Arg(0) {
+	case "list":
+		return listDeadLetters(store, out)
+	case "inspect":
+		if len(ids) != 1 {
+			return errors.New("inspect needs the id of a dead letter")
+		}
+		return inspectDeadLetter(store, ids[0], out)
+	case "replay":
+		eb, err := newEventBus(*bus, *url)
+		if err != nil {
+			return err
+		}
+
+		replayed, err := eventbus.Replay(store, eb, *target, ids...)
+		fmt.Fprintf(out, "%d replayed\n", replayed)
+		return err
+	}
+
+	flags.Usage()
+	return fmt.Errorf("unknown subcommand %q", flags.Arg(0))
+}
+
+func listDeadLetters(store eventhus.EventDeadLetterStore, out io.Writer) error {
+	letters, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED AT\tTARGET\tTOPIC\tEVENT\tATTEMPTS\tERROR")
+
+	for _, l := range letters {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\t%d\t%s\n",
+			l.ID, l.FailedAt.Format(time.RFC3339), l.Target, l.Bucket, l.Subset, l.Event.Type, l.Attempts, l.Error)
+	}
+
+	return w.Flush()
+}
+
+func inspectDeadLetter(store eventhus.EventDeadLetterStore, id string, out io.Writer) error {
+	letter, found, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("dead letter %s not found", id)
+	}
+
+	blob, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(blob))
+	return err
+}
+
+func newEventBus(kind, url string) (eventhus.EventBus, error) {
+	if url == "" {
+		return nil, errors.New("replay needs the url of the event bus")
+	}
+
+	switch kind {
+	case "nats":
+		return config.Nats(url, false)()
+	case "kafka":
+		return config.Kafka(strings.Split(url, ","))()
+	case "redis":
+		return config.Redis(&redis.Options{Addr: url})()
+	}
+
+	return nil, fmt.Errorf("unknown event bus %q", kind)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/deadletterstore/badger"
+)
+
+func TestDeadLetterListInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventhus-cli")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := badger.NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	store.Save(eventhus.EventDeadLetter{
+		ID:       "letter-1",
+		Event:    eventhus.Event{ID: "1", Type: "AccountCreated"},
+		Target:   "nats",
+		Bucket:   "bank",
+		Subset:   "account",
+		Error:    "nats: timeout",
+		Attempts: 3,
+		FailedAt: time.Now(),
+	})
+	store.CloseClient()
+
+	var out bytes.Buffer
+	if err = deadLetter([]string{"-store", dir, "list"}, &out); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	for _, expected := range []string{"letter-1", "bank/account", "AccountCreated", "nats: timeout"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in %s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	if err = deadLetter([]string{"-store", dir, "inspect", "letter-1"}, &out); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if !strings.Contains(out.String(), `"attempts": 3`) {
+		t.Errorf("unexpected output %s", out.String())
+	}
+
+	if err = deadLetter([]string{"-store", dir, "inspect", "missing"}, &out); err == nil {
+		t.Error("expected an error, got nil")
+	}
+
+	if err = deadLetter([]string{"-store", dir, "replay"}, &out); err == nil {
+		t.Error("expected an error without url, got nil")
+	}
+}
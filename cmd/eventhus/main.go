@@ -0,0 +1,37 @@
+// Command eventhus manages the stores of an eventhus application
+//
+//	eventhus deadletter -store <dir> list
+//	eventhus deadletter -store <dir> inspect <id>
+//	eventhus deadletter -store <dir> -bus nats -url nats://localhost:4222 replay [id...]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: eventhus <command> [arguments]
+
+commands:
+	deadletter	list, inspect and replay the events that couldn't be published`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "deadletter":
+		err = deadLetter(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
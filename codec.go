@@ -0,0 +1,66 @@
+package eventhus
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrHeaderUnsupported is returned by the event buses whose transport can't carry
+// the header of a message
+var ErrHeaderUnsupported = errors.New("the transport doesn't support message headers")
+
+// Message is an event encoded for a transport, Header holds the attributes sent
+// apart from the body; every bus prefixes their names following its own binding
+type Message struct {
+	ContentType string
+	Header      map[string]string
+	Body        []byte
+}
+
+// EventCodec converts the events to the messages sent by the event buses and back
+type EventCodec interface {
+	Encode(event Event, bucket, subset string) (Message, error)
+	Decode(msg Message, register EventTypeRegister) (Event, error)
+}
+
+// EventCodecSetter is implemented by the event buses able to change how the
+// events are encoded
+type EventCodecSetter interface {
+	SetCodec(codec EventCodec)
+}
+
+// CodecChecker is implemented by the event buses whose messages have no header
+type CodecChecker interface {
+	CheckCodec(codec EventCodec) error
+}
+
+// UsesHeader reports whether the codec puts attributes in the message header,
+// it encodes a probe event
+func UsesHeader(codec EventCodec) bool {
+	msg, err := codec.Encode(Event{ID: "probe", AggregateID: "probe", AggregateType: "probe", Type: "probe"}, "probe", "probe")
+	return err == nil && len(msg.Header) > 0
+}
+
+// JSONContentType is the content type of the events encoded by JSONCodec
+const JSONContentType = "application/json"
+
+// JSONCodec encodes the events as plain json, it's the default codec of the buses
+type JSONCodec struct{}
+
+// Encode an event
+func (JSONCodec) Encode(event Event, bucket, subset string) (Message, error) {
+	blob, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		ContentType: JSONContentType,
+		Body:        blob,
+	}, nil
+}
+
+// Decode an event with DecodeEvent
+func (JSONCodec) Decode(msg Message, register EventTypeRegister) (Event, error) {
+	return DecodeEvent(msg.Body, register)
+}
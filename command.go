@@ -16,6 +16,8 @@ type BaseCommand struct {
 	AggregateID   string
 	AggregateType string
 	Version       int
+	// IdempotencyKey is optional, commands with the same key are handled once
+	IdempotencyKey string
 }
 
 // GetAggregateID returns the command aggregate ID
@@ -42,3 +44,8 @@ func (b BaseCommand) IsValid() bool {
 func (b BaseCommand) GetVersion() int {
 	return b.Version
 }
+
+// GetIdempotencyKey of the command
+func (b BaseCommand) GetIdempotencyKey() string {
+	return b.IdempotencyKey
+}
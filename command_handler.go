@@ -1,6 +1,7 @@
 package eventhus
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sync"
@@ -18,10 +19,18 @@ type CommandHandlerRegister interface {
 	// Handlers() []string
 }
 
+// CommandTypeRegister knows how to build the registered commands from its names,
+// it's used to decode commands received from a remote bus
+type CommandTypeRegister interface {
+	Commands() []string
+	New(name string) (Command, error)
+}
+
 // CommandRegister contains a registry of command-handler style
 type CommandRegister struct {
 	sync.RWMutex
 	registry map[string]CommandHandle
+	types    map[string]reflect.Type
 	// repository *Repository
 }
 
@@ -29,6 +38,7 @@ type CommandRegister struct {
 func NewCommandRegister() *CommandRegister {
 	return &CommandRegister{
 		registry: make(map[string]CommandHandle),
+		types:    make(map[string]reflect.Type),
 		// repository: repository,
 	}
 }
@@ -41,16 +51,104 @@ func (c *CommandRegister) Add(command interface{}, handler CommandHandle) {
 	rawType := reflect.TypeOf(command)
 	name := rawType.String()
 	c.registry[name] = handler
+	c.types[name] = rawType
 }
 
 // Get the handler for a command
 func (c *CommandRegister) Get(command interface{}) (CommandHandle, error) {
-	rawType := reflect.TypeOf(command)
-	name := rawType.String()
+	name := CommandTypeName(command)
 
+	c.RLock()
 	handler, ok := c.registry[name]
+	c.RUnlock()
+
 	if !ok {
 		return nil, fmt.Errorf("can't find %s in registry", name)
 	}
 	return handler, nil
 }
+
+// Commands registered
+func (c *CommandRegister) Commands() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	values := make([]string, 0, len(c.types))
+	for name := range c.types {
+		values = append(values, name)
+	}
+
+	return values
+}
+
+// New returns a pointer to an empty command of the given type, the commands
+// registered by pointer get a pointer to the element
+func (c *CommandRegister) New(name string) (Command, error) {
+	c.RLock()
+	rawType, ok := c.types[name]
+	c.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("can't find %s in registry", name)
+	}
+
+	if rawType.Kind() == reflect.Ptr {
+		rawType = rawType.Elem()
+	}
+
+	command, ok := reflect.New(rawType).Interface().(Command)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a command", name)
+	}
+
+	return command, nil
+}
+
+// CommandTypeName returns the name used to register a command
+func CommandTypeName(command interface{}) string {
+	return reflect.TypeOf(command).String()
+}
+
+// commandEnvelope is the wire format of a command
+type commandEnvelope struct {
+	Type    string          `json:"type"`
+	Command json.RawMessage `json:"command"`
+}
+
+// MarshalCommand serializes a command along with its type name
+func MarshalCommand(command Command) ([]byte, error) {
+	blob, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(commandEnvelope{
+		Type:    CommandTypeName(command),
+		Command: blob,
+	})
+}
+
+// UnmarshalCommand builds a command serialized with MarshalCommand,
+// the command type should be known by the register
+func UnmarshalCommand(data []byte, register CommandTypeRegister) (Command, error) {
+	var envelope commandEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	command, err := register.New(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(envelope.Command, command); err != nil {
+		return nil, err
+	}
+
+	// the command is handled as it was registered, by pointer or by value
+	if CommandTypeName(command) == envelope.Type {
+		return command, nil
+	}
+
+	return reflect.ValueOf(command).Elem().Interface().(Command), nil
+}
@@ -0,0 +1,91 @@
+package eventhus
+
+import "testing"
+
+type SubCommand struct {
+	BaseCommand
+	Amount int
+}
+
+type commandHandleStub struct{}
+
+func (commandHandleStub) Handle(command Command) error {
+	return nil
+}
+
+func TestCommandRegisterNew(t *testing.T) {
+	register := NewCommandRegister()
+	register.Add(SubCommand{}, commandHandleStub{})
+
+	commands := register.Commands()
+	if len(commands) != 1 || commands[0] != "eventhus.SubCommand" {
+		t.Error("expected [eventhus.SubCommand], got", commands)
+	}
+
+	if _, err := register.New("eventhus.Missing"); err == nil {
+		t.Error("expected error, got nil")
+	}
+
+	if _, err := register.New("eventhus.SubCommand"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestMarshalCommand(t *testing.T) {
+	register := NewCommandRegister()
+	register.Add(SubCommand{}, commandHandleStub{})
+
+	command := SubCommand{Amount: 10}
+	command.AggregateID = "123"
+
+	blob, err := MarshalCommand(command)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	decoded, err := UnmarshalCommand(blob, register)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	sub, ok := decoded.(SubCommand)
+	if !ok {
+		t.Fatalf("expected SubCommand, got %T", decoded)
+	}
+
+	if sub.Amount != 10 || sub.AggregateID != "123" {
+		t.Errorf("unexpected command %+v", sub)
+	}
+
+	if _, err = register.Get(decoded); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestMarshalCommandRegisteredByPointer(t *testing.T) {
+	register := NewCommandRegister()
+	register.Add(&SubCommand{}, commandHandleStub{})
+
+	command, err := register.New("*eventhus.SubCommand")
+	if _, ok := command.(*SubCommand); !ok || err != nil {
+		t.Fatalf("expected *SubCommand and nil, got %T and %v", command, err)
+	}
+
+	blob, err := MarshalCommand(&SubCommand{Amount: 10})
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	decoded, err := UnmarshalCommand(blob, register)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if sub, ok := decoded.(*SubCommand); !ok || sub.Amount != 10 {
+		t.Fatalf("expected *SubCommand, got %#v", decoded)
+	}
+
+	if _, err = register.Get(decoded); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
@@ -1,7 +1,48 @@
 package eventhus
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidCommand the command didn't pass its own validation
+var ErrInvalidCommand = errors.New("invalid command")
+
 // CommandBus serve as the bridge between commands and command handler
 // it should manage the queues
 type CommandBus interface {
 	HandleCommand(command Command)
 }
+
+// CommandError describes a command that failed to be handled, Command is nil
+// when the payload received by the bus couldn't be decoded
+type CommandError struct {
+	Command  Command
+	Payload  []byte
+	Err      error
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Error returns the message of the original error
+func (e CommandError) Error() string {
+	return e.Err.Error()
+}
+
+// CommandErrorHandler is notified every time a command bus fails to handle a command
+type CommandErrorHandler interface {
+	HandleError(err CommandError)
+}
+
+// CommandErrorHandlerFunc is an adapter to use a func as CommandErrorHandler
+type CommandErrorHandlerFunc func(err CommandError)
+
+// HandleError calls f(err)
+func (f CommandErrorHandlerFunc) HandleError(err CommandError) {
+	f(err)
+}
+
+// CommandErrorReporter is implemented by the command buses able to report failed commands
+type CommandErrorReporter interface {
+	SetErrorHandler(handler CommandErrorHandler)
+}
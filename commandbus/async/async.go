@@ -1,7 +1,13 @@
 package async
 
-import "github.com/mishudark/eventhus"
+import (
+	"time"
 
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/commandbus"
+)
+
+// workerPool is the pool of the workers started by NewWorker
 var workerPool = make(chan chan eventhus.Command)
 
 // Worker contains the basic info to manage commands
@@ -9,12 +15,15 @@ type Worker struct {
 	WorkerPool     chan chan eventhus.Command
 	JobChannel     chan eventhus.Command
 	CommandHandler eventhus.CommandHandlerRegister
+	reporter       *commandbus.ErrorReporter
 }
 
 // Bus stores the command handler
 type Bus struct {
+	commandbus.ErrorReporter
 	CommandHandler eventhus.CommandHandlerRegister
 	maxWorkers     int
+	workerPool     chan chan eventhus.Command
 }
 
 // Start initialize a worker ready to receive jobs
@@ -24,28 +33,40 @@ func (w *Worker) Start() {
 			w.WorkerPool <- w.JobChannel
 
 			job := <-w.JobChannel
+			start := time.Now()
+
 			handler, err := w.CommandHandler.Get(job)
 			if err != nil {
+				w.reporter.Report(job, err, start)
 				continue
 			}
 
 			if !job.IsValid() {
+				w.reporter.Report(job, eventhus.ErrInvalidCommand, start)
 				continue
 			}
 
 			if err = handler.Handle(job); err != nil {
-				//TODO: log the error
+				w.reporter.Report(job, err, start)
 			}
 		}
 	}()
 }
 
 // NewWorker initialize the values of worker and start it
+//
+// Deprecated: every bus starts its own workers, this one takes the jobs of a
+// package pool no bus sends to
 func NewWorker(commandHandler eventhus.CommandHandlerRegister) {
+	newWorker(workerPool, commandHandler, nil)
+}
+
+func newWorker(workerPool chan chan eventhus.Command, commandHandler eventhus.CommandHandlerRegister, reporter *commandbus.ErrorReporter) {
 	w := Worker{
 		WorkerPool:     workerPool,
 		CommandHandler: commandHandler,
 		JobChannel:     make(chan eventhus.Command),
+		reporter:       reporter,
 	}
 
 	w.Start()
@@ -54,7 +75,7 @@ func NewWorker(commandHandler eventhus.CommandHandlerRegister) {
 // HandleCommand ad a job to the queue
 func (b *Bus) HandleCommand(command eventhus.Command) {
 	go func(c eventhus.Command) {
-		workerJobQueue := <-workerPool
+		workerJobQueue := <-b.workerPool
 		workerJobQueue <- c
 	}(command)
 }
@@ -73,7 +94,11 @@ func NewBus(register eventhus.CommandHandlerRegister, maxWorkers int) *Bus {
 
 // Start the bus
 func (b *Bus) Start() {
+	if b.workerPool == nil {
+		b.workerPool = make(chan chan eventhus.Command)
+	}
+
 	for i := 0; i < b.maxWorkers; i++ {
-		NewWorker(b.CommandHandler)
+		newWorker(b.workerPool, b.CommandHandler, &b.ErrorReporter)
 	}
 }
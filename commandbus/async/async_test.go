@@ -0,0 +1,84 @@
+package async
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/commandbus"
+)
+
+type PerformDeposit struct {
+	eventhus.BaseCommand
+}
+
+type unknownCommand struct {
+	eventhus.BaseCommand
+}
+
+type failingHandler struct{}
+
+func (failingHandler) Handle(command eventhus.Command) error {
+	return errors.New("balance out")
+}
+
+func TestBusReportsErrors(t *testing.T) {
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, failingHandler{})
+
+	handler := commandbus.NewChanErrorHandler(2)
+	bus := NewBus(register, 1)
+	bus.SetErrorHandler(handler)
+
+	bus.HandleCommand(PerformDeposit{})
+	bus.HandleCommand(unknownCommand{})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-handler.Errors():
+			if err.Command == nil || err.Err == nil {
+				t.Errorf("unexpected error %+v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected 2 errors, got", i)
+		}
+	}
+}
+
+type recordingHandler struct {
+	handled chan eventhus.Command
+}
+
+func (h recordingHandler) Handle(command eventhus.Command) error {
+	h.handled <- command
+	return nil
+}
+
+func TestBusesHaveTheirOwnWorkers(t *testing.T) {
+	deposits := eventhus.NewCommandRegister()
+	handled := make(chan eventhus.Command, 10)
+	deposits.Add(PerformDeposit{}, recordingHandler{handled})
+
+	others := eventhus.NewCommandRegister()
+	others.Add(unknownCommand{}, recordingHandler{make(chan eventhus.Command, 10)})
+
+	failed := commandbus.NewChanErrorHandler(10)
+	other := NewBus(others, 4)
+	other.SetErrorHandler(failed)
+
+	bus := NewBus(deposits, 1)
+	for i := 0; i < 10; i++ {
+		bus.HandleCommand(PerformDeposit{})
+	}
+
+	for i := 0; i < 10; i++ {
+		select {
+		case <-handled:
+		case err := <-failed.Errors():
+			t.Fatal("expected the command handled by its bus, got", err.Err)
+		case <-time.After(time.Second):
+			t.Fatal("expected 10 commands handled, got", i)
+		}
+	}
+}
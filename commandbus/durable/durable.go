@@ -0,0 +1,225 @@
+package durable
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/commandbus"
+)
+
+// ErrTooManyAttempts the command failed more times than allowed
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// PollInterval is the time the workers wait for commands when the queue is empty
+const PollInterval = 500 * time.Millisecond
+
+const (
+	// DefaultMaxAttempts is used when NewBus gets no attempts limit
+	DefaultMaxAttempts = 10
+	// DefaultBackoff is the wait before retrying a failed command
+	DefaultBackoff = time.Second
+	// DefaultMaxBackoff caps the wait, it doubles on every attempt
+	DefaultMaxBackoff = time.Minute
+)
+
+// Bus stores the commands in a durable queue before handling them, the
+// commands not acknowledged are redelivered, even after a restart
+type Bus struct {
+	commandbus.ErrorReporter
+	CommandHandler eventhus.CommandHandlerRegister
+	queue          eventhus.CommandQueue
+	types          eventhus.CommandTypeRegister
+	maxWorkers     int
+	maxAttempts    int
+	lease          time.Duration
+	backoff        time.Duration
+	maxBackoff     time.Duration
+	notify         chan struct{}
+	done           chan struct{}
+	wg             sync.WaitGroup
+}
+
+// Option customizes a Bus
+type Option func(*Bus)
+
+// WithBackoff sets the wait before retrying a failed command, it doubles on
+// every attempt up to max
+func WithBackoff(initial, max time.Duration) Option {
+	return func(b *Bus) {
+		b.backoff = initial
+		b.maxBackoff = max
+	}
+}
+
+// NewBus returns a bus that handles the commands from the queue with maxWorkers,
+// a command is parked after maxAttempts failures, DefaultMaxAttempts when it's zero
+func NewBus(register eventhus.CommandHandlerRegister, queue eventhus.CommandQueue, maxWorkers, maxAttempts int, lease time.Duration) (*Bus, error) {
+	return NewBusWithOptions(register, queue, maxWorkers, maxAttempts, lease)
+}
+
+// NewBusWithOptions returns a bus customized with options
+func NewBusWithOptions(register eventhus.CommandHandlerRegister, queue eventhus.CommandQueue, maxWorkers, maxAttempts int, lease time.Duration, options ...Option) (*Bus, error) {
+	types, ok := register.(eventhus.CommandTypeRegister)
+	if !ok {
+		return nil, errors.New("the register can't decode commands")
+	}
+
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	b := &Bus{
+		CommandHandler: register,
+		queue:          queue,
+		types:          types,
+		maxWorkers:     maxWorkers,
+		maxAttempts:    maxAttempts,
+		lease:          lease,
+		backoff:        DefaultBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		notify:         make(chan struct{}, maxWorkers),
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(b)
+	}
+
+	// start the bus
+	b.Start()
+	return b, nil
+}
+
+// Start the workers
+func (b *Bus) Start() {
+	for i := 0; i < b.maxWorkers; i++ {
+		b.wg.Add(1)
+		go b.work()
+	}
+}
+
+// Close stops the workers after they finish the current command
+func (b *Bus) Close() {
+	close(b.done)
+	b.wg.Wait()
+}
+
+// Enqueue appends the command to the queue
+func (b *Bus) Enqueue(command eventhus.Command) error {
+	blob, err := eventhus.MarshalCommand(command)
+	if err != nil {
+		return err
+	}
+
+	if _, err = b.queue.Append(blob); err != nil {
+		return err
+	}
+
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// HandleCommand appends the command to the queue, the failures to append it
+// are notified to the error handler
+func (b *Bus) HandleCommand(command eventhus.Command) {
+	start := time.Now()
+	b.Report(command, b.Enqueue(command), start)
+}
+
+func (b *Bus) work() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		found, err := b.next()
+		if found && err == nil {
+			continue
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-b.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// next leases a command and handles it
+func (b *Bus) next() (bool, error) {
+	queued, found, err := b.queue.Lease(b.lease)
+	if err != nil || !found {
+		return found, err
+	}
+
+	// a worker stopped while handling it
+	if queued.Attempts > b.maxAttempts {
+		return true, b.queue.Park(queued.ID, tooManyAttempts(queued.Error))
+	}
+
+	start := time.Now()
+	command, err := eventhus.UnmarshalCommand(queued.Data, b.types)
+	if err != nil {
+		b.ReportPayload(queued.Data, err, start)
+		return true, b.queue.Park(queued.ID, err)
+	}
+
+	handler, err := b.CommandHandler.Get(command)
+	if err != nil {
+		b.Report(command, err, start)
+		return true, b.queue.Park(queued.ID, err)
+	}
+
+	if !command.IsValid() {
+		b.Report(command, eventhus.ErrInvalidCommand, start)
+		return true, b.queue.Park(queued.ID, eventhus.ErrInvalidCommand)
+	}
+
+	if err = handler.Handle(command); err != nil {
+		b.Report(command, err, start)
+		if queued.Attempts >= b.maxAttempts {
+			return true, b.queue.Park(queued.ID, tooManyAttempts(err.Error()))
+		}
+
+		return true, b.queue.Release(queued.ID, b.delay(queued.Attempts), err)
+	}
+
+	return true, b.queue.Ack(queued.ID)
+}
+
+// tooManyAttempts is the cause of a parked command, with its last error
+func tooManyAttempts(last string) error {
+	if last == "" {
+		return ErrTooManyAttempts
+	}
+
+	return errors.New(ErrTooManyAttempts.Error() + ": " + last)
+}
+
+// delay returns the wait before the next attempt of a command
+func (b *Bus) delay(attempts int) time.Duration {
+	delay := b.backoff
+	for i := 1; i < attempts && delay < b.maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > b.maxBackoff {
+		return b.maxBackoff
+	}
+
+	return delay
+}
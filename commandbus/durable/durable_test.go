@@ -0,0 +1,192 @@
+package durable
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/commandbus"
+	"github.com/mishudark/eventhus/commandqueue/badger"
+)
+
+type PerformDeposit struct {
+	eventhus.BaseCommand
+	Amount int
+}
+
+type handlerStub struct {
+	handled chan eventhus.Command
+	err     error
+}
+
+func (h *handlerStub) Handle(command eventhus.Command) error {
+	h.handled <- command
+	return h.err
+}
+
+func newQueue(t *testing.T) (*badger.Client, string) {
+	dir, err := ioutil.TempDir("", "durable-bus")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	queue, err := badger.NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return queue, dir
+}
+
+func TestBusHandleCommand(t *testing.T) {
+	queue, dir := newQueue(t)
+	defer os.RemoveAll(dir)
+	defer queue.CloseClient()
+
+	handler := &handlerStub{handled: make(chan eventhus.Command, 1)}
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, handler)
+
+	bus, err := NewBus(register, queue, 2, 3, time.Minute)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer bus.Close()
+
+	bus.HandleCommand(PerformDeposit{Amount: 300})
+
+	select {
+	case command := <-handler.handled:
+		if command.(PerformDeposit).Amount != 300 {
+			t.Errorf("unexpected command %+v", command)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the command was not handled")
+	}
+}
+
+func TestBusParksFailingCommand(t *testing.T) {
+	queue, dir := newQueue(t)
+	defer os.RemoveAll(dir)
+	defer queue.CloseClient()
+
+	handler := &handlerStub{
+		handled: make(chan eventhus.Command, 10),
+		err:     errors.New("store down"),
+	}
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, handler)
+
+	bus, err := NewBusWithOptions(register, queue, 1, 3, time.Minute, WithBackoff(10*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	bus.HandleCommand(PerformDeposit{Amount: 300})
+
+	deadline := time.After(3 * time.Second)
+	for {
+		parked, _ := queue.Parked()
+		if len(parked) == 1 {
+			bus.Close()
+			if len(handler.handled) != 3 {
+				t.Error("expected 3 attempts, got", len(handler.handled))
+			}
+
+			if parked[0].Error != "too many attempts: store down" {
+				t.Error("expected the last error, got", parked[0].Error)
+			}
+			return
+		}
+
+		select {
+		case <-deadline:
+			bus.Close()
+			t.Fatal("the command was not parked")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestBusReportsUndecodableCommand(t *testing.T) {
+	queue, dir := newQueue(t)
+	defer os.RemoveAll(dir)
+	defer queue.CloseClient()
+
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, &handlerStub{handled: make(chan eventhus.Command, 1)})
+
+	bus, err := NewBus(register, queue, 1, 3, time.Minute)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer bus.Close()
+
+	failed := commandbus.NewChanErrorHandler(1)
+	bus.SetErrorHandler(failed)
+
+	if _, err = queue.Append([]byte("not a command")); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	select {
+	case err := <-failed.Errors():
+		if err.Command != nil || string(err.Payload) != "not a command" || err.Err == nil {
+			t.Errorf("unexpected error %+v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the payload was not reported")
+	}
+}
+
+// fullQueue refuses the new commands
+type fullQueue struct {
+	eventhus.CommandQueue
+}
+
+func (fullQueue) Append(data []byte) (string, error) {
+	return "", errors.New("disk full")
+}
+
+func (fullQueue) Lease(duration time.Duration) (eventhus.QueuedCommand, bool, error) {
+	return eventhus.QueuedCommand{}, false, nil
+}
+
+func TestBusReportsEnqueueErrors(t *testing.T) {
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, &handlerStub{handled: make(chan eventhus.Command, 1)})
+
+	bus, err := NewBus(register, fullQueue{}, 1, 3, time.Minute)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer bus.Close()
+
+	failed := commandbus.NewChanErrorHandler(1)
+	bus.SetErrorHandler(failed)
+
+	bus.HandleCommand(PerformDeposit{Amount: 300})
+
+	select {
+	case err := <-failed.Errors():
+		if err.Command.(PerformDeposit).Amount != 300 || err.Err == nil || err.Err.Error() != "disk full" {
+			t.Errorf("unexpected error %+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the enqueue error was not reported")
+	}
+}
+
+func TestBusBackoff(t *testing.T) {
+	bus := &Bus{backoff: time.Second, maxBackoff: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if got := bus.delay(i + 1); got != delay {
+			t.Errorf("expected %v for attempt %d, got %v", delay, i+1, got)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package commandbus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// ErrorReporter is embedded by the command buses to notify the failed commands
+// to an error handler, the zero value discards the errors
+type ErrorReporter struct {
+	mu      sync.RWMutex
+	handler eventhus.CommandErrorHandler
+}
+
+// SetErrorHandler replaces the handler notified on failures
+func (r *ErrorReporter) SetErrorHandler(handler eventhus.CommandErrorHandler) {
+	r.mu.Lock()
+	r.handler = handler
+	r.mu.Unlock()
+}
+
+// Report a failed command that started at start
+func (r *ErrorReporter) Report(command eventhus.Command, err error, start time.Time) {
+	if command == nil {
+		return
+	}
+
+	r.report(eventhus.CommandError{Command: command, Err: err, Start: start})
+}
+
+// ReportPayload reports a payload that couldn't be decoded into a command
+func (r *ErrorReporter) ReportPayload(payload []byte, err error, start time.Time) {
+	r.report(eventhus.CommandError{Payload: payload, Err: err, Start: start})
+}
+
+func (r *ErrorReporter) report(failed eventhus.CommandError) {
+	if r == nil || failed.Err == nil {
+		return
+	}
+
+	r.mu.RLock()
+	handler := r.handler
+	r.mu.RUnlock()
+
+	if handler == nil {
+		return
+	}
+
+	failed.Duration = time.Since(failed.Start)
+	handler.HandleError(failed)
+}
@@ -0,0 +1,190 @@
+package commandbus
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// MultiErrorHandler notifies every failed command to all its handlers
+type MultiErrorHandler []eventhus.CommandErrorHandler
+
+// HandleError notifies all the handlers in order
+func (m MultiErrorHandler) HandleError(err eventhus.CommandError) {
+	for _, handler := range m {
+		handler.HandleError(err)
+	}
+}
+
+// LogErrorHandler logs the failed commands
+type LogErrorHandler struct {
+	log *log.Logger
+}
+
+// NewLogErrorHandler returns a handler that writes to l
+func NewLogErrorHandler(l *log.Logger) *LogErrorHandler {
+	return &LogErrorHandler{
+		log: l,
+	}
+}
+
+// HandleError logs the command, the error and the time it took
+func (l *LogErrorHandler) HandleError(err eventhus.CommandError) {
+	if err.Command == nil {
+		l.log.Printf("payload: %q error: %s duration: %s", err.Payload, err.Err, err.Duration)
+		return
+	}
+
+	l.log.Printf(
+		"command: %s aggregate: %s error: %s duration: %s",
+		eventhus.CommandTypeName(err.Command), err.Command.GetAggregateID(), err.Err, err.Duration,
+	)
+}
+
+// ChanErrorHandler sends the failed commands to a channel, the errors are
+// dropped when the channel is full so a slow consumer never blocks the bus
+type ChanErrorHandler struct {
+	errors  chan eventhus.CommandError
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewChanErrorHandler returns a handler with a channel buffered to size
+func NewChanErrorHandler(size int) *ChanErrorHandler {
+	return &ChanErrorHandler{
+		errors: make(chan eventhus.CommandError, size),
+	}
+}
+
+// HandleError sends the error to the channel
+func (c *ChanErrorHandler) HandleError(err eventhus.CommandError) {
+	select {
+	case c.errors <- err:
+	default:
+		c.mu.Lock()
+		c.dropped++
+		c.mu.Unlock()
+	}
+}
+
+// Errors returns the channel to consume the failed commands
+func (c *ChanErrorHandler) Errors() <-chan eventhus.CommandError {
+	return c.errors
+}
+
+// Dropped returns the quantity of errors discarded because the channel was full
+func (c *ChanErrorHandler) Dropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.dropped
+}
+
+// DeadLetter is a failed command, Data holds the command serialized
+// with eventhus.MarshalCommand so it can be sent again
+type DeadLetter struct {
+	Data     []byte        `json:"data"`
+	Type     string        `json:"type"`
+	Error    string        `json:"error"`
+	FailedAt time.Time     `json:"failed_at"`
+	Duration time.Duration `json:"duration"`
+}
+
+// DeadLetterStore persists the failed commands
+type DeadLetterStore interface {
+	Add(letter DeadLetter) error
+	All() ([]DeadLetter, error)
+}
+
+// DeadLetterErrorHandler stores the failed commands in a DeadLetterStore
+type DeadLetterErrorHandler struct {
+	store   DeadLetterStore
+	onError func(error)
+}
+
+// DeadLetterOption customizes a DeadLetterErrorHandler
+type DeadLetterOption func(*DeadLetterErrorHandler)
+
+// WithStoreErrorHandler sets the func notified when a failed command can't be
+// stored, the errors are logged by default
+func WithStoreErrorHandler(handler func(error)) DeadLetterOption {
+	return func(d *DeadLetterErrorHandler) {
+		d.onError = handler
+	}
+}
+
+// NewDeadLetterErrorHandler returns a handler that writes to store
+func NewDeadLetterErrorHandler(store DeadLetterStore, options ...DeadLetterOption) *DeadLetterErrorHandler {
+	d := &DeadLetterErrorHandler{
+		store: store,
+		onError: func(err error) {
+			log.Println("commandbus: dead letter failed:", err)
+		},
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	return d
+}
+
+// HandleError stores the failed command, the payloads that couldn't be decoded
+// are stored as they were received
+func (d *DeadLetterErrorHandler) HandleError(err eventhus.CommandError) {
+	blob, name := err.Payload, ""
+	if err.Command != nil {
+		name = eventhus.CommandTypeName(err.Command)
+
+		var marshalErr error
+		if blob, marshalErr = eventhus.MarshalCommand(err.Command); marshalErr != nil {
+			d.onError(fmt.Errorf("marshal command %s: %w", name, marshalErr))
+			return
+		}
+	}
+
+	addErr := d.store.Add(DeadLetter{
+		Data:     blob,
+		Type:     name,
+		Error:    err.Err.Error(),
+		FailedAt: err.Start.Add(err.Duration),
+		Duration: err.Duration,
+	})
+
+	if addErr != nil {
+		d.onError(fmt.Errorf("store dead letter %s: %w", name, addErr))
+	}
+}
+
+// MemoryDeadLetterStore keeps the failed commands in memory
+type MemoryDeadLetterStore struct {
+	mu      sync.RWMutex
+	letters []DeadLetter
+}
+
+// NewMemoryDeadLetterStore returns an empty store
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{}
+}
+
+// Add a failed command
+func (m *MemoryDeadLetterStore) Add(letter DeadLetter) error {
+	m.mu.Lock()
+	m.letters = append(m.letters, letter)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// All the failed commands, oldest first
+func (m *MemoryDeadLetterStore) All() ([]DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	letters := make([]DeadLetter, len(m.letters))
+	copy(letters, m.letters)
+	return letters, nil
+}
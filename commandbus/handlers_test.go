@@ -0,0 +1,122 @@
+package commandbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type PerformDeposit struct {
+	eventhus.BaseCommand
+	Amount int
+}
+
+func TestErrorReporterReport(t *testing.T) {
+	var reporter ErrorReporter
+	handler := NewChanErrorHandler(1)
+
+	// without handler the errors are discarded
+	reporter.Report(PerformDeposit{}, errors.New("discarded"), time.Now())
+
+	reporter.SetErrorHandler(handler)
+	reporter.Report(PerformDeposit{}, nil, time.Now())
+	reporter.Report(PerformDeposit{Amount: 10}, errors.New("balance out"), time.Now())
+
+	select {
+	case err := <-handler.Errors():
+		if err.Error() != "balance out" || err.Command.(PerformDeposit).Amount != 10 {
+			t.Errorf("unexpected error %+v", err)
+		}
+	default:
+		t.Fatal("expected an error in the channel")
+	}
+
+	if len(handler.Errors()) != 0 {
+		t.Error("expected empty channel, got", len(handler.Errors()))
+	}
+}
+
+func TestErrorReporterReportPayload(t *testing.T) {
+	var reporter ErrorReporter
+	store := NewMemoryDeadLetterStore()
+	reporter.SetErrorHandler(NewDeadLetterErrorHandler(store))
+
+	reporter.ReportPayload([]byte("{bad"), errors.New("unexpected end of input"), time.Now())
+
+	letters, _ := store.All()
+	if len(letters) != 1 || string(letters[0].Data) != "{bad" || letters[0].Type != "" {
+		t.Errorf("unexpected dead letters %+v", letters)
+	}
+}
+
+func TestChanErrorHandlerDropped(t *testing.T) {
+	handler := NewChanErrorHandler(1)
+	handler.HandleError(eventhus.CommandError{Err: errors.New("first")})
+	handler.HandleError(eventhus.CommandError{Err: errors.New("second")})
+
+	if handler.Dropped() != 1 {
+		t.Error("expected 1 dropped error, got", handler.Dropped())
+	}
+}
+
+func TestDeadLetterErrorHandler(t *testing.T) {
+	store := NewMemoryDeadLetterStore()
+	handlers := MultiErrorHandler{
+		NewDeadLetterErrorHandler(store),
+		NewChanErrorHandler(1),
+	}
+
+	handlers.HandleError(eventhus.CommandError{
+		Command: PerformDeposit{Amount: 10},
+		Err:     errors.New("balance out"),
+		Start:   time.Now(),
+	})
+
+	letters, err := store.All()
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(letters) != 1 || letters[0].Type != "commandbus.PerformDeposit" || letters[0].Error != "balance out" {
+		t.Fatalf("unexpected dead letters %+v", letters)
+	}
+
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, nil)
+
+	command, err := eventhus.UnmarshalCommand(letters[0].Data, register)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if command.(PerformDeposit).Amount != 10 {
+		t.Errorf("unexpected command %+v", command)
+	}
+}
+
+type failingDeadLetterStore struct {
+	*MemoryDeadLetterStore
+}
+
+func (failingDeadLetterStore) Add(letter DeadLetter) error {
+	return errors.New("store down")
+}
+
+func TestDeadLetterErrorHandlerReportsStoreErrors(t *testing.T) {
+	var reported []error
+	handler := NewDeadLetterErrorHandler(failingDeadLetterStore{}, WithStoreErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+
+	handler.HandleError(eventhus.CommandError{
+		Command: PerformDeposit{Amount: 10},
+		Err:     errors.New("balance out"),
+		Start:   time.Now(),
+	})
+
+	if len(reported) != 1 || reported[0].Error() != "store dead letter commandbus.PerformDeposit: store down" {
+		t.Error("expected the store error, got", reported)
+	}
+}
@@ -0,0 +1,207 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/commandbus"
+	nats "github.com/nats-io/nats.go"
+)
+
+// DefaultQueue is the queue group shared by the handler processes
+const DefaultQueue = "eventhus"
+
+// Reply is sent back by the handler process with the outcome of the command
+type Reply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Client sends commands to the handler processes, it's used by the
+// services that only produce commands
+type Client struct {
+	commandbus.ErrorReporter
+	conn    *nats.Conn
+	prefix  string
+	timeout time.Duration
+}
+
+// NewClient returns a client connected to nats, commands are sent to the subject
+// `prefix.<command type>` and it waits up to timeout for the outcome
+func NewClient(urls string, prefix string, timeout time.Duration) (*Client, error) {
+	conn, err := connect(urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn:    conn,
+		prefix:  prefix,
+		timeout: timeout,
+	}, nil
+}
+
+func connect(urls string) (*nats.Conn, error) {
+	opts := nats.GetDefaultOptions()
+	opts.Servers = strings.Split(urls, ",")
+
+	for i, s := range opts.Servers {
+		opts.Servers[i] = strings.Trim(s, " ")
+	}
+
+	return opts.Connect()
+}
+
+// Send a command and wait for the outcome of its handler
+func (c *Client) Send(command eventhus.Command) error {
+	blob, err := eventhus.MarshalCommand(command)
+	if err != nil {
+		return err
+	}
+
+	msg, err := c.conn.Request(c.subject(eventhus.CommandTypeName(command)), blob, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	var reply Reply
+	if err = json.Unmarshal(msg.Data, &reply); err != nil {
+		return err
+	}
+
+	if reply.Error != "" {
+		return errors.New(reply.Error)
+	}
+
+	return nil
+}
+
+// HandleCommand sends the command without waiting for its outcome,
+// the failures to send it are notified to the error handler
+func (c *Client) HandleCommand(command eventhus.Command) {
+	start := time.Now()
+
+	blob, err := eventhus.MarshalCommand(command)
+	if err != nil {
+		c.Report(command, err, start)
+		return
+	}
+
+	err = c.conn.Publish(c.subject(eventhus.CommandTypeName(command)), blob)
+	c.Report(command, err, start)
+}
+
+// Close the connection
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) subject(name string) string {
+	return c.prefix + "." + name
+}
+
+// Bus consumes the commands registered in the register as part of a queue group,
+// every command is handled by only one process of the group
+type Bus struct {
+	*Client
+	register      eventhus.CommandHandlerRegister
+	types         eventhus.CommandTypeRegister
+	subscriptions []*nats.Subscription
+}
+
+// NewBus returns a bus that handles the commands sent to `prefix.<command type>`,
+// the register should implement eventhus.CommandTypeRegister to decode them
+func NewBus(register eventhus.CommandHandlerRegister, urls, prefix, queue string, timeout time.Duration) (*Bus, error) {
+	types, ok := register.(eventhus.CommandTypeRegister)
+	if !ok {
+		return nil, errors.New("the register can't decode commands")
+	}
+
+	client, err := NewClient(urls, prefix, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bus{
+		Client:   client,
+		register: register,
+		types:    types,
+	}
+
+	if err = b.Start(queue); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Start consuming the registered commands
+func (b *Bus) Start(queue string) error {
+	for _, name := range b.types.Commands() {
+		sub, err := b.conn.QueueSubscribe(b.subject(name), queue, b.handle)
+		if err != nil {
+			return err
+		}
+
+		b.subscriptions = append(b.subscriptions, sub)
+	}
+
+	return b.conn.Flush()
+}
+
+func (b *Bus) handle(msg *nats.Msg) {
+	start := time.Now()
+	command, err := b.handleCommand(msg.Data)
+	if command == nil {
+		b.ReportPayload(msg.Data, err, start)
+	} else {
+		b.Report(command, err, start)
+	}
+
+	// commands sent with HandleCommand don't expect a reply
+	if msg.Reply == "" {
+		return
+	}
+
+	var reply Reply
+	if err != nil {
+		reply.Error = err.Error()
+	}
+
+	blob, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+
+	b.conn.Publish(msg.Reply, blob)
+}
+
+func (b *Bus) handleCommand(data []byte) (eventhus.Command, error) {
+	command, err := eventhus.UnmarshalCommand(data, b.types)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, err := b.register.Get(command)
+	if err != nil {
+		return command, err
+	}
+
+	if !command.IsValid() {
+		return command, eventhus.ErrInvalidCommand
+	}
+
+	return command, handler.Handle(command)
+}
+
+// Close stops consuming commands and closes the connection
+func (b *Bus) Close() {
+	for _, sub := range b.subscriptions {
+		sub.Unsubscribe()
+	}
+
+	b.Client.Close()
+}
@@ -0,0 +1,149 @@
+package nats
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+)
+
+const testURL = "nats://127.0.0.1:8369"
+
+type PerformDeposit struct {
+	eventhus.BaseCommand
+	Amount int
+}
+
+type handlerStub struct {
+	sync.Mutex
+	commands []eventhus.Command
+	err      error
+}
+
+func (h *handlerStub) Handle(command eventhus.Command) error {
+	h.Lock()
+	defer h.Unlock()
+
+	h.commands = append(h.commands, command)
+	return h.err
+}
+
+func (h *handlerStub) count() int {
+	h.Lock()
+	defer h.Unlock()
+
+	return len(h.commands)
+}
+
+func (h *handlerStub) command(i int) eventhus.Command {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.commands[i]
+}
+
+func runServer() *server.Server {
+	opts := test.DefaultTestOptions
+	opts.Port = 8369
+	return test.RunServer(&opts)
+}
+
+func newBus(t *testing.T, handler eventhus.CommandHandle) *Bus {
+	register := eventhus.NewCommandRegister()
+	register.Add(PerformDeposit{}, handler)
+
+	bus, err := NewBus(register, testURL, "commands", DefaultQueue, time.Second)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return bus
+}
+
+func TestClientSend(t *testing.T) {
+	s := runServer()
+	defer s.Shutdown()
+
+	handler := &handlerStub{}
+	bus := newBus(t, handler)
+	defer bus.Close()
+
+	client, err := NewClient(testURL, "commands", time.Second)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer client.Close()
+
+	command := PerformDeposit{Amount: 300}
+	command.AggregateID = "123"
+
+	if err = client.Send(command); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if handler.count() != 1 {
+		t.Fatal("expected 1 command, got", handler.count())
+	}
+
+	received, ok := handler.command(0).(PerformDeposit)
+	if !ok {
+		t.Fatalf("expected PerformDeposit, got %T", handler.command(0))
+	}
+
+	if received.Amount != 300 || received.AggregateID != "123" {
+		t.Errorf("unexpected command %+v", received)
+	}
+}
+
+func TestClientSendReturnsHandlerError(t *testing.T) {
+	s := runServer()
+	defer s.Shutdown()
+
+	bus := newBus(t, &handlerStub{err: errors.New("balance out")})
+	defer bus.Close()
+
+	client, err := NewClient(testURL, "commands", time.Second)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer client.Close()
+
+	err = client.Send(PerformDeposit{})
+	if err == nil || err.Error() != "balance out" {
+		t.Error("expected balance out, got", err)
+	}
+}
+
+func TestQueueGroup(t *testing.T) {
+	s := runServer()
+	defer s.Shutdown()
+
+	first := &handlerStub{}
+	second := &handlerStub{}
+
+	busOne := newBus(t, first)
+	defer busOne.Close()
+
+	busTwo := newBus(t, second)
+	defer busTwo.Close()
+
+	client, err := NewClient(testURL, "commands", time.Second)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 10; i++ {
+		if err = client.Send(PerformDeposit{Amount: i}); err != nil {
+			t.Error("expected nil, got", err)
+		}
+	}
+
+	if total := first.count() + second.count(); total != 10 {
+		t.Error("expected every command to be handled once, got", total)
+	}
+}
@@ -3,6 +3,7 @@ package basic
 import (
 	"errors"
 	"reflect"
+	"time"
 
 	"github.com/mishudark/eventhus"
 )
@@ -10,52 +11,142 @@ import (
 // ErrInvalidID missing initial event
 var ErrInvalidID = errors.New("Invalid ID, initial event missign")
 
+// ReservationLease is how long a command holds its idempotency key, a crashed
+// handler releases it once the lease elapses
+var ReservationLease = time.Minute
+
 // Handler contains the info to manage commands
 type Handler struct {
 	repository     *eventhus.Repository
 	aggregate      reflect.Type
 	bucket, subset string
+	dedup          eventhus.DedupStore
+	publish        []eventhus.PublishOption
 }
 
 // NewCommandHandler return a handler
 func NewCommandHandler(repository *eventhus.Repository, aggregate eventhus.AggregateHandler, bucket, subset string) eventhus.CommandHandle {
-	return &Handler{
-		repository: repository,
-		aggregate:  reflect.TypeOf(aggregate).Elem(),
-		bucket:     bucket,
-		subset:     subset,
+	return NewCommandHandlerWithOptions()(repository, aggregate, bucket, subset)
+}
+
+// Option customizes a Handler
+type Option func(*Handler)
+
+// WithDedupStore consults store before handling the commands carrying an
+// idempotency key
+func WithDedupStore(store eventhus.DedupStore) Option {
+	return func(h *Handler) {
+		h.dedup = store
+	}
+}
+
+// WithPublishOptions publishes the events with options, e.g. eventhus.AtomicBatch()
+func WithPublishOptions(options ...eventhus.PublishOption) Option {
+	return func(h *Handler) {
+		h.publish = options
+	}
+}
+
+// NewCommandHandlerWithOptions returns a command handler constructor whose
+// handlers are customized with options
+func NewCommandHandlerWithOptions(options ...Option) func(*eventhus.Repository, eventhus.AggregateHandler, string, string) eventhus.CommandHandle {
+	return func(repository *eventhus.Repository, aggregate eventhus.AggregateHandler, bucket, subset string) eventhus.CommandHandle {
+		h := &Handler{
+			repository: repository,
+			aggregate:  reflect.TypeOf(aggregate).Elem(),
+			bucket:     bucket,
+			subset:     subset,
+		}
+
+		for _, opt := range options {
+			opt(h)
+		}
+
+		return h
 	}
 }
 
+// NewIdempotentCommandHandler returns a command handler constructor that consults
+// the dedup store before handling commands carrying an idempotency key
+func NewIdempotentCommandHandler(store eventhus.DedupStore) func(*eventhus.Repository, eventhus.AggregateHandler, string, string) eventhus.CommandHandle {
+	return NewCommandHandlerWithOptions(WithDedupStore(store))
+}
+
 // Handle a command
 func (h *Handler) Handle(command eventhus.Command) error {
-	var err error
+	key := eventhus.IdempotencyKey(command)
+	if key == "" || h.dedup == nil {
+		_, err := h.handle(command)
+		return err
+	}
 
+	// the key is claimed before handling, so concurrent retries can't both
+	// apply the command
+	result, found, err := h.dedup.Reserve(key, ReservationLease)
+	if err != nil {
+		return err
+	}
+
+	// the command was already handled, return the original outcome
+	if found {
+		return result.Err()
+	}
+
+	final, err := h.handle(command)
+	if !final {
+		// nothing was persisted, a retry can handle it
+		if releaseErr := h.dedup.Release(key); releaseErr != nil && err == nil {
+			return releaseErr
+		}
+
+		return err
+	}
+
+	result = eventhus.CommandResult{
+		Key:       key,
+		HandledAt: time.Now(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if saveErr := h.dedup.Save(result); saveErr != nil && err == nil {
+		return saveErr
+	}
+
+	return err
+}
+
+// handle a command, final reports whether the outcome can't change on a retry,
+// it is false when nothing was persisted because the store failed
+func (h *Handler) handle(command eventhus.Command) (final bool, err error) {
 	version := command.GetVersion()
 	aggregate := reflect.New(h.aggregate).Interface().(eventhus.AggregateHandler)
 
 	if version != 0 {
 		if err = h.repository.Load(aggregate, command.GetAggregateID()); err != nil {
-			return err
+			return false, err
 		}
 	}
 
 	if err = aggregate.HandleCommand(command); err != nil {
-		return err
+		return true, err
 	}
 
 	// if not contain a valid ID,  the initial event (some like createAggreagate event) is missing
 	if aggregate.GetID() == "" {
-		return ErrInvalidID
+		return true, ErrInvalidID
 	}
 
 	if err = h.repository.Save(aggregate, version); err != nil {
-		return err
+		return false, err
 	}
 
-	if err = h.repository.PublishEvents(aggregate, h.bucket, h.subset); err != nil {
-		return err
+	// the events are already stored, a retry must not emit them again
+	if err = h.repository.PublishEvents(aggregate, h.bucket, h.subset, h.publish...); err != nil {
+		return true, err
 	}
 
-	return nil
+	return true, nil
 }
@@ -0,0 +1,218 @@
+package basic
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/dedupstore/memory"
+)
+
+var errRejected = errors.New("rejected")
+
+type counterCreated struct{}
+
+type createCounter struct {
+	eventhus.BaseCommand
+	Reject bool
+	// Twice emits two events
+	Twice bool
+}
+
+type counter struct {
+	eventhus.BaseAggregate
+}
+
+func (c *counter) ApplyChange(event eventhus.Event) {
+	c.ID = event.AggregateID
+}
+
+func (c *counter) HandleCommand(command eventhus.Command) error {
+	cmd := command.(createCounter)
+	if cmd.Reject {
+		return errRejected
+	}
+
+	event := eventhus.Event{
+		AggregateID:   cmd.AggregateID,
+		AggregateType: "counter",
+		Data:          &counterCreated{},
+	}
+
+	c.BaseAggregate.ApplyChangeHelper(c, event, true)
+	if cmd.Twice {
+		c.BaseAggregate.ApplyChangeHelper(c, event, true)
+	}
+
+	return nil
+}
+
+type storeStub struct {
+	saved []eventhus.Event
+}
+
+func (s *storeStub) Save(events []eventhus.Event, version int) error {
+	s.saved = append(s.saved, events...)
+	return nil
+}
+
+func (s *storeStub) SafeSave(events []eventhus.Event, version int) error {
+	return s.Save(events, version)
+}
+
+func (s *storeStub) Load(aggregateID string) ([]eventhus.Event, error) {
+	return nil, nil
+}
+
+type busStub struct {
+	published []eventhus.Event
+}
+
+func (b *busStub) Publish(event eventhus.Event, bucket, subset string) error {
+	b.published = append(b.published, event)
+	return nil
+}
+
+// blockingBus holds the publish until released
+type blockingBus struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBus) Publish(event eventhus.Event, bucket, subset string) error {
+	close(b.started)
+	<-b.release
+	return nil
+}
+
+func TestHandlerReservesKey(t *testing.T) {
+	store := &storeStub{}
+	bus := &blockingBus{started: make(chan struct{}), release: make(chan struct{})}
+	repository := eventhus.NewRepository(store, bus)
+
+	constructor := NewIdempotentCommandHandler(memory.NewStore(0))
+	handler := constructor(repository, &counter{}, "test", "counter")
+
+	command := createCounter{}
+	command.AggregateID = "1"
+	command.IdempotencyKey = "create-1"
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := handler.Handle(command); err != nil {
+			t.Error("expected nil, got", err)
+		}
+	}()
+
+	<-bus.started
+	// the first handler is still running, the key is reserved
+	if err := handler.Handle(command); err != eventhus.ErrCommandInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrCommandInProgress, err)
+	}
+
+	close(bus.release)
+	wg.Wait()
+
+	if err := handler.Handle(command); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(store.saved) != 1 {
+		t.Error("expected 1 saved event, got", len(store.saved))
+	}
+}
+
+func TestHandlerDeduplicatesCommands(t *testing.T) {
+	store := &storeStub{}
+	bus := &busStub{}
+	repository := eventhus.NewRepository(store, bus)
+
+	constructor := NewIdempotentCommandHandler(memory.NewStore(0))
+	handler := constructor(repository, &counter{}, "test", "counter")
+
+	command := createCounter{}
+	command.AggregateID = "1"
+	command.IdempotencyKey = "create-1"
+
+	for i := 0; i < 2; i++ {
+		if err := handler.Handle(command); err != nil {
+			t.Error("expected nil, got", err)
+		}
+	}
+
+	if len(store.saved) != 1 || len(bus.published) != 1 {
+		t.Errorf("expected 1 saved and published event, got %d and %d", len(store.saved), len(bus.published))
+	}
+}
+
+func TestHandlerReturnsOriginalError(t *testing.T) {
+	store := &storeStub{}
+	repository := eventhus.NewRepository(store, &busStub{})
+
+	constructor := NewIdempotentCommandHandler(memory.NewStore(0))
+	handler := constructor(repository, &counter{}, "test", "counter")
+
+	command := createCounter{Reject: true}
+	command.AggregateID = "1"
+	command.IdempotencyKey = "create-1"
+
+	if err := handler.Handle(command); err != errRejected {
+		t.Error("expected rejected, got", err)
+	}
+
+	// the retry carries the same key, the original outcome is kept
+	command.Reject = false
+	err := handler.Handle(command)
+	if !errors.Is(err, errRejected) {
+		t.Error("expected rejected, got", err)
+	}
+
+	if len(store.saved) != 0 {
+		t.Error("expected 0 saved events, got", len(store.saved))
+	}
+}
+
+func TestHandlerWithoutKey(t *testing.T) {
+	store := &storeStub{}
+	repository := eventhus.NewRepository(store, &busStub{})
+
+	constructor := NewIdempotentCommandHandler(memory.NewStore(0))
+	handler := constructor(repository, &counter{}, "test", "counter")
+
+	command := createCounter{}
+	command.AggregateID = "1"
+
+	handler.Handle(command)
+	handler.Handle(command)
+
+	if len(store.saved) != 2 {
+		t.Error("expected 2 saved events, got", len(store.saved))
+	}
+}
+
+func TestHandlerWithPublishOptions(t *testing.T) {
+	store := &storeStub{}
+	bus := &busStub{}
+	repository := eventhus.NewRepository(store, bus)
+
+	constructor := NewCommandHandlerWithOptions(WithPublishOptions(eventhus.AtomicBatch()))
+	handler := constructor(repository, &counter{}, "test", "counter")
+
+	command := createCounter{Twice: true}
+	command.AggregateID = "1"
+
+	if err := handler.Handle(command); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(bus.published) != 1 || bus.published[0].Type != eventhus.EventBatchType {
+		t.Fatalf("expected a batch, got %+v", bus.published)
+	}
+
+	if batch := bus.published[0].Data.(*eventhus.EventBatch); batch.Count != 2 {
+		t.Error("expected 2 events in the batch, got", batch.Count)
+	}
+}
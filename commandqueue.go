@@ -0,0 +1,28 @@
+package eventhus
+
+import "time"
+
+// QueuedCommand is a serialized command waiting in a CommandQueue
+type QueuedCommand struct {
+	ID          string    `json:"id"`
+	Data        []byte    `json:"data"`
+	Attempts    int       `json:"attempts"`
+	LeasedUntil time.Time `json:"leased_until"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// CommandQueue persists the commands until a worker acknowledges them,
+// a leased command becomes available again once its lease expires
+type CommandQueue interface {
+	Append(data []byte) (string, error)
+	// Lease the oldest available command and increment its attempts,
+	// found is false when there is nothing to process
+	Lease(duration time.Duration) (command QueuedCommand, found bool, err error)
+	Ack(id string) error
+	// Release a leased command after a failure, it's available again once
+	// delay elapses
+	Release(id string, delay time.Duration, err error) error
+	// Park moves a command that can't be processed out of the queue
+	Park(id string, err error) error
+	Parked() ([]QueuedCommand, error)
+}
@@ -0,0 +1,375 @@
+package badger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mishudark/eventhus"
+)
+
+// the ready commands are indexed by id and the leased ones by expiry, so a
+// lease doesn't scan the queue
+const (
+	queuePrefix  = "queue:"
+	readyPrefix  = "ready:"
+	leasedPrefix = "leased:"
+	parkedPrefix = "parked:"
+	sequenceKey  = "queue-sequence"
+)
+
+// Client is a durable command queue backed by BadgerDB, writes are serialized
+// to avoid conflicts between the workers
+type Client struct {
+	sync.Mutex
+	session  *badger.DB
+	sequence *badger.Sequence
+}
+
+// NewClient opens the queue stored in dbDir, the commands leased by
+// a previous process are available again
+func NewClient(dbDir string) (*Client, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	session, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, err := session.GetSequence([]byte(sequenceKey), 100)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	cli := &Client{
+		session:  session,
+		sequence: sequence,
+	}
+
+	if err = cli.releaseAll(); err != nil {
+		cli.CloseClient()
+		return nil, err
+	}
+
+	return cli, nil
+}
+
+// CloseClient closes the db connection
+func (c *Client) CloseClient() error {
+	c.sequence.Release()
+	return c.session.Close()
+}
+
+// Append a serialized command at the end of the queue
+func (c *Client) Append(data []byte) (string, error) {
+	seq, err := c.sequence.Next()
+	if err != nil {
+		return "", err
+	}
+
+	// zero padded ids keep the keys sorted in arrival order
+	command := eventhus.QueuedCommand{
+		ID:   fmt.Sprintf("%020d", seq),
+		Data: data,
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	err = c.session.Update(func(txn *badger.Txn) error {
+		return ready(txn, command)
+	})
+
+	return command.ID, err
+}
+
+// Lease the oldest ready command, or the one whose lease expired first when its
+// id is older
+func (c *Client) Lease(duration time.Duration) (eventhus.QueuedCommand, bool, error) {
+	var command eventhus.QueuedCommand
+	var found bool
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	err := c.session.Update(func(txn *badger.Txn) error {
+		id, ok := first(txn, readyPrefix)
+
+		if key, leased := first(txn, leasedPrefix); leased {
+			expiry, leasedID, err := parseLeased(key)
+			if err != nil {
+				return err
+			}
+
+			if expiry <= now.UnixNano() && (!ok || leasedID < id) {
+				id, ok = leasedID, true
+			}
+		}
+
+		if !ok {
+			return nil
+		}
+
+		current, err := get(txn, queuePrefix, id)
+		if err != nil {
+			return err
+		}
+
+		if err = unindex(txn, current); err != nil {
+			return err
+		}
+
+		command = current
+		found = true
+
+		command.Attempts++
+		command.LeasedUntil = now.Add(duration)
+		return lease(txn, command)
+	})
+
+	return command, found, err
+}
+
+// Ack removes a processed command
+func (c *Client) Ack(id string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		command, err := get(txn, queuePrefix, id)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = unindex(txn, command); err != nil {
+			return err
+		}
+
+		return txn.Delete([]byte(queuePrefix + id))
+	})
+}
+
+// Release a leased command after a failure, it's available again once delay elapses
+func (c *Client) Release(id string, delay time.Duration, cause error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		command, err := get(txn, queuePrefix, id)
+		if err != nil {
+			return err
+		}
+
+		if err = unindex(txn, command); err != nil {
+			return err
+		}
+
+		if cause != nil {
+			command.Error = cause.Error()
+		}
+
+		if delay > 0 {
+			command.LeasedUntil = time.Now().Add(delay)
+			return lease(txn, command)
+		}
+
+		command.LeasedUntil = time.Time{}
+		return ready(txn, command)
+	})
+}
+
+// Park moves a command to the parking area
+func (c *Client) Park(id string, cause error) error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		command, err := get(txn, queuePrefix, id)
+		if err != nil {
+			return err
+		}
+
+		if err = unindex(txn, command); err != nil {
+			return err
+		}
+
+		command.LeasedUntil = time.Time{}
+		if cause != nil {
+			command.Error = cause.Error()
+		}
+
+		if err = set(txn, parkedPrefix, command); err != nil {
+			return err
+		}
+
+		return txn.Delete([]byte(queuePrefix + id))
+	})
+}
+
+// Parked returns the commands in the parking area
+func (c *Client) Parked() ([]eventhus.QueuedCommand, error) {
+	var commands []eventhus.QueuedCommand
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		return iterate(txn, parkedPrefix, func(command eventhus.QueuedCommand) (bool, error) {
+			commands = append(commands, command)
+			return true, nil
+		})
+	})
+
+	return commands, err
+}
+
+// releaseAll the leases, it runs on startup when no worker can hold a lease
+func (c *Client) releaseAll() error {
+	return c.session.Update(func(txn *badger.Txn) error {
+		var leased []eventhus.QueuedCommand
+
+		err := iterate(txn, queuePrefix, func(command eventhus.QueuedCommand) (bool, error) {
+			if !command.LeasedUntil.IsZero() {
+				leased = append(leased, command)
+			}
+			return true, nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, command := range leased {
+			if err = txn.Delete(leasedKey(command)); err != nil {
+				return err
+			}
+
+			command.LeasedUntil = time.Time{}
+			if err = ready(txn, command); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ready stores the command and adds it to the ready index
+func ready(txn *badger.Txn, command eventhus.QueuedCommand) error {
+	if err := set(txn, queuePrefix, command); err != nil {
+		return err
+	}
+
+	return txn.Set([]byte(readyPrefix+command.ID), nil)
+}
+
+// lease saves the command in the leased index
+func lease(txn *badger.Txn, command eventhus.QueuedCommand) error {
+	if err := set(txn, queuePrefix, command); err != nil {
+		return err
+	}
+
+	return txn.Set(leasedKey(command), nil)
+}
+
+// unindex removes the command from the ready or leased index
+func unindex(txn *badger.Txn, command eventhus.QueuedCommand) error {
+	if command.LeasedUntil.IsZero() {
+		return txn.Delete([]byte(readyPrefix + command.ID))
+	}
+
+	return txn.Delete(leasedKey(command))
+}
+
+// leasedKey sorts the leased commands by expiry, then by id
+func leasedKey(command eventhus.QueuedCommand) []byte {
+	return []byte(fmt.Sprintf("%s%020d:%s", leasedPrefix, command.LeasedUntil.UnixNano(), command.ID))
+}
+
+// parseLeased returns the expiry in nanoseconds and the id of a leased key
+// without prefix
+func parseLeased(key string) (int64, string, error) {
+	i := strings.IndexByte(key, ':')
+	if i < 0 {
+		return 0, "", fmt.Errorf("invalid leased key %q", key)
+	}
+
+	expiry, err := strconv.ParseInt(key[:i], 10, 64)
+	return expiry, key[i+1:], err
+}
+
+// first returns the first key under prefix without it
+func first(txn *badger.Txn, prefix string) (string, bool) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	it.Seek([]byte(prefix))
+	if !it.ValidForPrefix([]byte(prefix)) {
+		return "", false
+	}
+
+	return string(it.Item().Key()[len(prefix):]), true
+}
+
+func get(txn *badger.Txn, prefix, id string) (eventhus.QueuedCommand, error) {
+	var command eventhus.QueuedCommand
+
+	item, err := txn.Get([]byte(prefix + id))
+	if err != nil {
+		return command, err
+	}
+
+	val, err := item.Value()
+	if err != nil {
+		return command, err
+	}
+
+	err = json.Unmarshal(val, &command)
+	return command, err
+}
+
+func set(txn *badger.Txn, prefix string, command eventhus.QueuedCommand) error {
+	blob, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set([]byte(prefix+command.ID), blob)
+}
+
+// iterate the commands under prefix in order until fn returns false
+func iterate(txn *badger.Txn, prefix string, fn func(eventhus.QueuedCommand) (bool, error)) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+		item := it.Item()
+		val, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		var command eventhus.QueuedCommand
+		if err = json.Unmarshal(val, &command); err != nil {
+			return err
+		}
+
+		next, err := fn(command)
+		if err != nil || !next {
+			return err
+		}
+	}
+
+	return nil
+}
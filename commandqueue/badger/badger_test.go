@@ -0,0 +1,160 @@
+package badger
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) (*Client, string) {
+	dir, err := ioutil.TempDir("", "badger-queue")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return cli, dir
+}
+
+func TestClientLeaseAck(t *testing.T) {
+	cli, dir := newTestClient(t)
+	defer os.RemoveAll(dir)
+	defer cli.CloseClient()
+
+	first, _ := cli.Append([]byte("first"))
+	cli.Append([]byte("second"))
+
+	command, found, err := cli.Lease(time.Minute)
+	if err != nil || !found {
+		t.Fatal("expected a command, got", found, err)
+	}
+
+	if command.ID != first || string(command.Data) != "first" || command.Attempts != 1 {
+		t.Errorf("unexpected command %+v", command)
+	}
+
+	// the first one is leased, the next lease returns the second one
+	command, found, _ = cli.Lease(time.Minute)
+	if !found || string(command.Data) != "second" {
+		t.Errorf("unexpected command %+v", command)
+	}
+
+	if _, found, _ = cli.Lease(time.Minute); found {
+		t.Error("expected empty queue")
+	}
+
+	cli.Ack(first)
+	cli.Release(command.ID, 0, errors.New("store down"))
+
+	command, found, _ = cli.Lease(time.Minute)
+	if !found || string(command.Data) != "second" || command.Attempts != 2 || command.Error != "store down" {
+		t.Errorf("unexpected command %+v", command)
+	}
+}
+
+func TestClientRedeliversAfterRestart(t *testing.T) {
+	cli, dir := newTestClient(t)
+	defer os.RemoveAll(dir)
+
+	cli.Append([]byte("first"))
+	if _, found, _ := cli.Lease(time.Hour); !found {
+		t.Fatal("expected a command")
+	}
+	cli.CloseClient()
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	command, found, _ := cli.Lease(time.Hour)
+	if !found || command.Attempts != 2 {
+		t.Errorf("expected redelivered command, got %+v", command)
+	}
+}
+
+func TestClientPark(t *testing.T) {
+	cli, dir := newTestClient(t)
+	defer os.RemoveAll(dir)
+	defer cli.CloseClient()
+
+	id, _ := cli.Append([]byte("poison"))
+	cli.Lease(time.Minute)
+
+	if err := cli.Park(id, errors.New("can't decode")); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	parked, err := cli.Parked()
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(parked) != 1 || parked[0].ID != id || parked[0].Error != "can't decode" {
+		t.Errorf("unexpected parked commands %+v", parked)
+	}
+
+	if _, found, _ := cli.Lease(time.Minute); found {
+		t.Error("expected empty queue")
+	}
+}
+
+func TestClientLeaseExpired(t *testing.T) {
+	cli, dir := newTestClient(t)
+	defer os.RemoveAll(dir)
+	defer cli.CloseClient()
+
+	first, _ := cli.Append([]byte("first"))
+	if _, found, _ := cli.Lease(time.Millisecond); !found {
+		t.Fatal("expected a command")
+	}
+	cli.Append([]byte("second"))
+
+	time.Sleep(5 * time.Millisecond)
+
+	// the expired lease is older than the ready command
+	command, found, err := cli.Lease(time.Minute)
+	if err != nil || !found {
+		t.Fatal("expected a command, got", found, err)
+	}
+
+	if command.ID != first || command.Attempts != 2 {
+		t.Errorf("expected the expired command, got %+v", command)
+	}
+
+	command, found, _ = cli.Lease(time.Minute)
+	if !found || string(command.Data) != "second" {
+		t.Errorf("unexpected command %+v", command)
+	}
+
+	if _, found, _ = cli.Lease(time.Minute); found {
+		t.Error("expected empty queue")
+	}
+}
+
+func TestClientReleaseDelay(t *testing.T) {
+	cli, dir := newTestClient(t)
+	defer os.RemoveAll(dir)
+	defer cli.CloseClient()
+
+	cli.Append([]byte("first"))
+	command, _, _ := cli.Lease(time.Minute)
+	cli.Release(command.ID, 50*time.Millisecond, errors.New("store down"))
+
+	if _, found, _ := cli.Lease(time.Minute); found {
+		t.Error("expected the command to wait for the delay")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	command, found, _ := cli.Lease(time.Minute)
+	if !found || command.Attempts != 2 || command.Error != "store down" {
+		t.Errorf("unexpected command %+v", command)
+	}
+}
@@ -1,11 +1,24 @@
 package config
 
 import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
 	"github.com/mishudark/eventhus"
 	"github.com/mishudark/eventhus/commandbus/async"
+	"github.com/mishudark/eventhus/commandbus/durable"
+	natsbus "github.com/mishudark/eventhus/commandbus/nats"
+	queue "github.com/mishudark/eventhus/commandqueue/badger"
+	"github.com/mishudark/eventhus/eventbus"
+	"github.com/mishudark/eventhus/eventbus/jetstream"
+	"github.com/mishudark/eventhus/eventbus/kafka"
+	"github.com/mishudark/eventhus/eventbus/memory"
 	"github.com/mishudark/eventhus/eventbus/mosquitto"
 	"github.com/mishudark/eventhus/eventbus/nats"
 	"github.com/mishudark/eventhus/eventbus/rabbitmq"
+	redisbus "github.com/mishudark/eventhus/eventbus/redis"
+	"github.com/mishudark/eventhus/eventbus/webhook"
 	"github.com/mishudark/eventhus/eventstore/badger"
 	"github.com/mishudark/eventhus/eventstore/mongo"
 )
@@ -22,6 +35,9 @@ type CommandBus func(register eventhus.CommandHandlerRegister) (eventhus.Command
 // CommandConfig should connect internally commands with an aggregate
 type CommandConfig func(repository *eventhus.Repository, register *eventhus.CommandRegister)
 
+// EventConfig should connect internally event handlers with the events they process
+type EventConfig func(register *eventhus.EventHandlerRegistry)
+
 // commandHandler is the signature used by command handlers constructor
 type commandHandler func(repository *eventhus.Repository, aggregate eventhus.AggregateHandler, bucket, subset string) eventhus.CommandHandle
 
@@ -35,6 +51,31 @@ func WireCommands(aggregate eventhus.AggregateHandler, handler commandHandler, b
 	}
 }
 
+// WireEvents acts as a wired between an event handler and the event types it processes
+func WireEvents(handler eventhus.EventHandle, events ...interface{}) EventConfig {
+	return func(register *eventhus.EventHandlerRegistry) {
+		for _, event := range events {
+			register.Add(event, handler)
+		}
+	}
+}
+
+// WireAggregateEvents connects an event handler with all the events of the aggregate types
+func WireAggregateEvents(handler eventhus.EventHandle, aggregateTypes ...string) EventConfig {
+	return func(register *eventhus.EventHandlerRegistry) {
+		for _, aggregateType := range aggregateTypes {
+			register.AddForAggregate(aggregateType, handler)
+		}
+	}
+}
+
+// WireSubsetEvents connects an event handler with all the events published to bucket and subset
+func WireSubsetEvents(handler eventhus.EventHandle, bucket, subset string) EventConfig {
+	return func(register *eventhus.EventHandlerRegistry) {
+		register.AddForSubset(bucket, subset, handler)
+	}
+}
+
 // NewClient returns a command bus properly configured
 func NewClient(es EventStore, eb EventBus, cb CommandBus, cmdConfigs ...CommandConfig) (eventhus.CommandBus, error) {
 	store, err := es()
@@ -63,6 +104,13 @@ func RabbitMq(username, password, host string, port int) EventBus {
 	}
 }
 
+// RabbitMqWithOptions generates a RabbitMq implementation of EventBus customized with options
+func RabbitMqWithOptions(username, password, host string, port int, options ...rabbitmq.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return rabbitmq.NewClientWithOptions(username, password, host, port, options...)
+	}
+}
+
 // Nats generates a Nats implementation of EventBus
 func Nats(urls string, useTLS bool) EventBus {
 	return func() (eventhus.EventBus, error) {
@@ -70,6 +118,50 @@ func Nats(urls string, useTLS bool) EventBus {
 	}
 }
 
+// NatsWithOptions generates a Nats implementation of EventBus customized with options
+func NatsWithOptions(urls string, options ...nats.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return nats.NewClientWithOptions(urls, options...)
+	}
+}
+
+// JetStream generates a NATS JetStream implementation of EventBus, the stream
+// described by cfg is created if it doesn't exist
+func JetStream(urls string, cfg jetstream.Config) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return jetstream.NewClient(urls, cfg)
+	}
+}
+
+// Kafka generates a Kafka implementation of EventBus
+func Kafka(brokers []string, options ...kafka.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return kafka.NewClient(brokers, options...)
+	}
+}
+
+// Redis generates a Redis Streams implementation of EventBus
+func Redis(opts *redis.Options, options ...redisbus.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return redisbus.NewClient(opts, options...)
+	}
+}
+
+// Routing generates an EventBus that sends every event to the publishers of the
+// routes it matches, the events without route go to fallback
+func Routing(routes []eventbus.Route, fallback ...eventhus.EventBus) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return eventbus.NewRoutingBus(routes, fallback...), nil
+	}
+}
+
+// Webhook generates an EventBus that POSTs the events to the matching endpoints
+func Webhook(endpoints []webhook.Endpoint, options ...webhook.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return webhook.NewClient(endpoints, options...), nil
+	}
+}
+
 // Mosquitto generates a Mosquitto implementation of EventBus
 func Mosquitto(method string, host string, port int, clientID string) EventBus {
 	return func() (eventhus.EventBus, error) {
@@ -77,6 +169,36 @@ func Mosquitto(method string, host string, port int, clientID string) EventBus {
 	}
 }
 
+// MosquittoWithOptions generates a Mosquitto implementation of EventBus customized with options
+func MosquittoWithOptions(method string, host string, port int, clientID string, options ...mosquitto.Option) EventBus {
+	return func() (eventhus.EventBus, error) {
+		return mosquitto.NewClientWithOptions(method, host, port, clientID, options...)
+	}
+}
+
+// Memory generates an in-process implementation of EventBus, memoryBus returns
+// it once built, close an async one before stopping
+func Memory(async bool, eventConfigs ...EventConfig) (bus EventBus, memoryBus func() *memory.Bus) {
+	var b *memory.Bus
+
+	bus = func() (eventhus.EventBus, error) {
+		register := eventhus.NewEventHandlerRegistry()
+		for _, conf := range eventConfigs {
+			conf(register)
+		}
+
+		if async {
+			b = memory.NewAsyncBus(register)
+		} else {
+			b = memory.NewBus(register)
+		}
+
+		return b, nil
+	}
+
+	return bus, func() *memory.Bus { return b }
+}
+
 // Mongo generates a MongoDB implementation of EventStore
 func Mongo(host string, port int, db string) EventStore {
 	return func() (eventhus.EventStore, error) {
@@ -97,3 +219,146 @@ func AsyncCommandBus(workers int) CommandBus {
 		return async.NewBus(register, workers), nil
 	}
 }
+
+// NatsCommandBus generates a CommandBus that consumes the commands sent over nats
+// as part of the queue group, timeout applies to the commands sent through it
+func NatsCommandBus(urls, prefix, queue string, timeout time.Duration) CommandBus {
+	return func(register eventhus.CommandHandlerRegister) (eventhus.CommandBus, error) {
+		return natsbus.NewBus(register, urls, prefix, queue, timeout)
+	}
+}
+
+// DurableCommandBus generates a CommandBus that persists the commands in a
+// BadgerDB queue, a command is parked after maxAttempts failures
+func DurableCommandBus(dbDir string, workers, maxAttempts int, lease time.Duration) CommandBus {
+	return func(register eventhus.CommandHandlerRegister) (eventhus.CommandBus, error) {
+		q, err := queue.NewClient(dbDir)
+		if err != nil {
+			return nil, err
+		}
+
+		bus, err := durable.NewBus(register, q, workers, maxAttempts, lease)
+		if err != nil {
+			q.CloseClient()
+			return nil, err
+		}
+
+		return &durableBus{bus, q}, nil
+	}
+}
+
+// durableBus owns the queue it was created with
+type durableBus struct {
+	*durable.Bus
+	queue *queue.Client
+}
+
+// Close stops the workers, then the queue is closed
+func (b *durableBus) Close() {
+	b.Bus.Close()
+	b.queue.CloseClient()
+}
+
+// WithErrorHandler sets the handler notified when the command bus fails to handle a command
+func WithErrorHandler(cb CommandBus, handler eventhus.CommandErrorHandler) CommandBus {
+	return func(register eventhus.CommandHandlerRegister) (eventhus.CommandBus, error) {
+		bus, err := cb(register)
+		if err != nil {
+			return nil, err
+		}
+
+		reporter, ok := bus.(eventhus.CommandErrorReporter)
+		if !ok {
+			return nil, errors.New("the command bus doesn't report errors")
+		}
+
+		reporter.SetErrorHandler(handler)
+		return bus, nil
+	}
+}
+
+// WithCodec sets how the event bus encodes the events
+func WithCodec(eb EventBus, codec eventhus.EventCodec) EventBus {
+	return func() (eventhus.EventBus, error) {
+		bus, err := eb()
+		if err != nil {
+			return nil, err
+		}
+
+		setter, ok := bus.(eventhus.EventCodecSetter)
+		if !ok {
+			return nil, errors.New("the event bus doesn't encode the events")
+		}
+
+		if checker, ok := bus.(eventhus.CodecChecker); ok {
+			if err = checker.CheckCodec(codec); err != nil {
+				return nil, err
+			}
+		}
+
+		setter.SetCodec(codec)
+		return bus, nil
+	}
+}
+
+// WithRouter sets how the event bus computes the topics of the events
+func WithRouter(eb EventBus, router eventhus.Router) EventBus {
+	return func() (eventhus.EventBus, error) {
+		bus, err := eb()
+		if err != nil {
+			return nil, err
+		}
+
+		setter, ok := bus.(eventhus.RouterSetter)
+		if !ok {
+			return nil, errors.New("the event bus doesn't route the events")
+		}
+
+		setter.SetRouter(router)
+		return bus, nil
+	}
+}
+
+// WithCircuitBreaker retries the failed publishes of the event bus and stops
+// calling it after repeated failures
+func WithCircuitBreaker(eb EventBus, options ...eventbus.CircuitBreakerOption) EventBus {
+	return func() (eventhus.EventBus, error) {
+		bus, err := eb()
+		if err != nil {
+			return nil, err
+		}
+
+		return eventbus.NewCircuitBreaker(bus, options...), nil
+	}
+}
+
+// WithDeadLetters saves in store the events the event bus fails to publish,
+// target names the bus in the dead letters
+func WithDeadLetters(eb EventBus, store eventhus.EventDeadLetterStore, target string) EventBus {
+	return func() (eventhus.EventBus, error) {
+		bus, err := eb()
+		if err != nil {
+			return nil, err
+		}
+
+		return eventbus.NewDeadLetterBus(bus, store, target), nil
+	}
+}
+
+// WithBatching publishes the events in batches, batcher returns it once built,
+// close it before stopping
+func WithBatching(eb EventBus, onError eventbus.BatchErrorHandler, options ...eventbus.BatchOption) (bus EventBus, batcher func() *eventbus.Batcher) {
+	var b *eventbus.Batcher
+
+	bus = func() (eventhus.EventBus, error) {
+		inner, err := eb()
+		if err != nil {
+			return nil, err
+		}
+
+		b = eventbus.NewBatcher(inner, onError, options...)
+		return b, nil
+	}
+
+	return bus, func() *eventbus.Batcher { return b }
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus/cloudevents"
+)
+
+func TestWithCodecRejectsHeadersOnNats(t *testing.T) {
+	bus := WithCodec(Nats("nats://127.0.0.1:4222", false), cloudevents.NewCodec(cloudevents.Binary))
+	if _, err := bus(); err != eventhus.ErrHeaderUnsupported {
+		t.Errorf("expected %v, got %v", eventhus.ErrHeaderUnsupported, err)
+	}
+
+	bus = WithCodec(Nats("nats://127.0.0.1:4222", false), cloudevents.NewCodec(cloudevents.Structured))
+	if _, err := bus(); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestWithBatchingReturnsBatcher(t *testing.T) {
+	bus, batcher := WithBatching(Nats("nats://127.0.0.1:4222", false), nil)
+	if batcher() != nil {
+		t.Error("expected nil before the bus is built")
+	}
+
+	eb, err := bus()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if batcher() == nil || eb != eventhus.EventBus(batcher()) {
+		t.Error("expected the batcher of the bus, got", batcher())
+	}
+}
+
+func TestMemoryReturnsBus(t *testing.T) {
+	bus, memoryBus := Memory(true)
+	if memoryBus() != nil {
+		t.Error("expected nil before the bus is built")
+	}
+
+	eb, err := bus()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if memoryBus() == nil || eb != eventhus.EventBus(memoryBus()) {
+		t.Error("expected the memory bus, got", memoryBus())
+	}
+
+	memoryBus().Close()
+}
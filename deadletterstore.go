@@ -0,0 +1,25 @@
+package eventhus
+
+import "time"
+
+// EventDeadLetter is an event that couldn't be published, Target names the
+// event bus that failed
+type EventDeadLetter struct {
+	ID       string    `json:"id"`
+	Event    Event     `json:"event"`
+	Target   string    `json:"target"`
+	Bucket   string    `json:"bucket"`
+	Subset   string    `json:"subset"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// EventDeadLetterStore keeps the events that couldn't be published until they
+// are replayed
+type EventDeadLetterStore interface {
+	Save(letter EventDeadLetter) error
+	Get(id string) (letter EventDeadLetter, found bool, err error)
+	List() ([]EventDeadLetter, error)
+	Remove(id string) error
+}
@@ -0,0 +1,143 @@
+package badger
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mishudark/eventhus"
+)
+
+const keyPrefix = "deadletter:"
+
+// Client for access to BadgerDB
+type Client struct {
+	session *badger.DB
+}
+
+// NewClient generates a new dead letter store backed by BadgerDB
+func NewClient(dbDir string) (*Client, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	session, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		session: session,
+	}, nil
+}
+
+// CloseClient closes the db connection
+func (c *Client) CloseClient() error {
+	return c.session.Close()
+}
+
+// storedLetter keeps the data of the event as it was serialized
+type storedLetter struct {
+	eventhus.EventDeadLetter
+	Data json.RawMessage `json:"data"`
+}
+
+// Save adds or replaces a dead letter
+func (c *Client) Save(letter eventhus.EventDeadLetter) error {
+	data, err := json.Marshal(letter.Event.Data)
+	if err != nil {
+		return err
+	}
+
+	stored := storedLetter{EventDeadLetter: letter, Data: data}
+	stored.Event.Data = nil
+
+	blob, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(keyPrefix+letter.ID), blob)
+	})
+}
+
+func decode(blob []byte) (eventhus.EventDeadLetter, error) {
+	var stored storedLetter
+	if err := json.Unmarshal(blob, &stored); err != nil {
+		return eventhus.EventDeadLetter{}, err
+	}
+
+	letter := stored.EventDeadLetter
+	letter.Event.Data = stored.Data
+	return letter, nil
+}
+
+// Get a dead letter, the data of the event is a json.RawMessage
+func (c *Client) Get(id string) (eventhus.EventDeadLetter, bool, error) {
+	var letter eventhus.EventDeadLetter
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(keyPrefix + id))
+		if err != nil {
+			return err
+		}
+
+		val, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		letter, err = decode(val)
+		return err
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return letter, false, nil
+	}
+
+	if err != nil {
+		return letter, false, err
+	}
+
+	return letter, true, nil
+}
+
+// List the dead letters, oldest first
+func (c *Client) List() ([]eventhus.EventDeadLetter, error) {
+	var letters []eventhus.EventDeadLetter
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+
+			letter, err := decode(val)
+			if err != nil {
+				return err
+			}
+
+			letters = append(letters, letter)
+		}
+
+		return nil
+	})
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+
+	return letters, err
+}
+
+// Remove a dead letter
+func (c *Client) Remove(id string) error {
+	return c.session.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(keyPrefix + id))
+	})
+}
@@ -0,0 +1,68 @@
+package badger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type AccountCreated struct {
+	Owner string `json:"owner"`
+}
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-deadletter")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	now := time.Now()
+	letters := []eventhus.EventDeadLetter{
+		{ID: "b", Event: eventhus.Event{ID: "2"}, FailedAt: now.Add(time.Second)},
+		{ID: "a", Event: eventhus.Event{ID: "1", Type: "AccountCreated", Data: &AccountCreated{Owner: "mishudark"}}, Target: "nats", FailedAt: now},
+	}
+
+	for _, letter := range letters {
+		if err = cli.Save(letter); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	letter, found, err := cli.Get("a")
+	if err != nil || !found {
+		t.Fatalf("expected the dead letter, got %v %v", found, err)
+	}
+
+	data, ok := letter.Event.Data.(json.RawMessage)
+	if !ok || string(data) != `{"owner":"mishudark"}` {
+		t.Errorf("unexpected data %s", letter.Event.Data)
+	}
+
+	all, err := cli.List()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(all) != 2 || all[0].ID != "a" || all[1].ID != "b" {
+		t.Errorf("unexpected dead letters %+v", all)
+	}
+
+	if err = cli.Remove("a"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if _, found, _ = cli.Get("a"); found {
+		t.Error("expected the dead letter to be removed")
+	}
+}
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/mishudark/eventhus"
+)
+
+// Store keeps the dead letters in memory
+type Store struct {
+	sync.RWMutex
+	letters map[string]eventhus.EventDeadLetter
+}
+
+// NewStore returns an empty dead letter store
+func NewStore() *Store {
+	return &Store{
+		letters: make(map[string]eventhus.EventDeadLetter),
+	}
+}
+
+// Save adds or replaces a dead letter
+func (s *Store) Save(letter eventhus.EventDeadLetter) error {
+	s.Lock()
+	s.letters[letter.ID] = letter
+	s.Unlock()
+
+	return nil
+}
+
+// Get a dead letter
+func (s *Store) Get(id string) (eventhus.EventDeadLetter, bool, error) {
+	s.RLock()
+	letter, ok := s.letters[id]
+	s.RUnlock()
+
+	return letter, ok, nil
+}
+
+// List the dead letters, oldest first
+func (s *Store) List() ([]eventhus.EventDeadLetter, error) {
+	s.RLock()
+	letters := make([]eventhus.EventDeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+	s.RUnlock()
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+
+	return letters, nil
+}
+
+// Remove a dead letter
+func (s *Store) Remove(id string) error {
+	s.Lock()
+	delete(s.letters, id)
+	s.Unlock()
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package eventhus
+
+import (
+	"errors"
+	"time"
+)
+
+// IdempotentCommand is implemented by commands that carry an idempotency key,
+// commands sharing the same key are handled only once
+type IdempotentCommand interface {
+	Command
+	GetIdempotencyKey() string
+}
+
+// ErrCommandInProgress is returned by Reserve while another caller handles a
+// command with the same idempotency key
+var ErrCommandInProgress = errors.New("a command with the same idempotency key is being handled")
+
+// CommandResult stores the outcome of an already handled command
+type CommandResult struct {
+	Key       string    `json:"key" bson:"_id"`
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	HandledAt time.Time `json:"handled_at" bson:"handled_at"`
+	// ReservedUntil is set while the command is being handled, the reservation
+	// is taken over once it elapses
+	ReservedUntil time.Time `json:"reserved_until,omitempty" bson:"reserved_until,omitempty"`
+}
+
+// Pending reports whether the result is a reservation of a command being handled
+func (r CommandResult) Pending() bool {
+	return !r.ReservedUntil.IsZero()
+}
+
+// Reservable reports whether a caller can reserve the key of the stored result r
+func (r CommandResult) Reservable(now time.Time) bool {
+	return r.Pending() && now.After(r.ReservedUntil)
+}
+
+// HandledError is the original error of a command returned again for a retry,
+// only its message is kept, so errors.Is matches it by message
+type HandledError struct {
+	Message string
+}
+
+func (e *HandledError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target has the message of the original error
+func (e *HandledError) Is(target error) bool {
+	return target != nil && target.Error() == e.Message
+}
+
+// Err rebuilds the original error of the command as a HandledError, nil if it
+// succeeded; it must be compared with errors.Is, not ==
+func (r CommandResult) Err() error {
+	if r.Error == "" {
+		return nil
+	}
+
+	return &HandledError{Message: r.Error}
+}
+
+// DedupStore keeps the outcome of handled commands indexed by their idempotency key
+type DedupStore interface {
+	Get(key string) (result CommandResult, found bool, err error)
+	// Reserve atomically claims the key for lease, found is true when the command
+	// was already handled; it fails with ErrCommandInProgress when the key is
+	// reserved by another caller
+	Reserve(key string, lease time.Duration) (result CommandResult, found bool, err error)
+	Save(result CommandResult) error
+	// Release drops the reservation of the key, so a retry can handle the command
+	Release(key string) error
+}
+
+// IdempotencyKey returns the key of the command, empty if it doesn't carry one
+func IdempotencyKey(command Command) string {
+	c, ok := command.(IdempotentCommand)
+	if !ok {
+		return ""
+	}
+
+	return c.GetIdempotencyKey()
+}
@@ -0,0 +1,172 @@
+package badger
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mishudark/eventhus"
+)
+
+const keyPrefix = "dedup:"
+
+// Client for access to BadgerDB
+type Client struct {
+	session   *badger.DB
+	retention time.Duration
+}
+
+// NewClient generates a new dedup store backed by BadgerDB, results older than
+// retention are discarded, a zero retention keeps them forever
+func NewClient(dbDir string, retention time.Duration) (*Client, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	session, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		session:   session,
+		retention: retention,
+	}, nil
+}
+
+// CloseClient closes the db connection
+func (c *Client) CloseClient() error {
+	return c.session.Close()
+}
+
+// Get the result of a handled command
+func (c *Client) Get(key string) (eventhus.CommandResult, bool, error) {
+	var result eventhus.CommandResult
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(keyPrefix + key))
+		if err != nil {
+			return err
+		}
+
+		val, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(val, &result)
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return result, false, nil
+	}
+
+	if err != nil || result.Pending() {
+		return eventhus.CommandResult{}, false, err
+	}
+
+	return result, true, nil
+}
+
+// Reserve claims the key for lease, the reservation expires with the lease
+func (c *Client) Reserve(key string, lease time.Duration) (eventhus.CommandResult, bool, error) {
+	var result eventhus.CommandResult
+	found := false
+	now := time.Now()
+
+	err := c.session.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(keyPrefix + key))
+		switch err {
+		case nil:
+			val, err := item.Value()
+			if err != nil {
+				return err
+			}
+
+			if err = json.Unmarshal(val, &result); err != nil {
+				return err
+			}
+
+			if !result.Reservable(now) {
+				if result.Pending() {
+					return eventhus.ErrCommandInProgress
+				}
+
+				found = true
+				return nil
+			}
+		case badger.ErrKeyNotFound:
+		default:
+			return err
+		}
+
+		blob, err := json.Marshal(eventhus.CommandResult{
+			Key:           key,
+			HandledAt:     now,
+			ReservedUntil: now.Add(lease),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return txn.SetWithTTL([]byte(keyPrefix+key), blob, lease)
+	})
+
+	// a concurrent transaction reserved the key first
+	if err == badger.ErrConflict {
+		err = eventhus.ErrCommandInProgress
+	}
+
+	if err != nil || !found {
+		return eventhus.CommandResult{}, false, err
+	}
+
+	return result, true, nil
+}
+
+// Release drops the reservation of the key
+func (c *Client) Release(key string) error {
+	return c.session.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(keyPrefix + key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		val, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		var result eventhus.CommandResult
+		if err = json.Unmarshal(val, &result); err != nil {
+			return err
+		}
+
+		if !result.Pending() {
+			return nil
+		}
+
+		return txn.Delete([]byte(keyPrefix + key))
+	})
+}
+
+// Save the result of a handled command
+func (c *Client) Save(result eventhus.CommandResult) error {
+	blob, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		key := []byte(keyPrefix + result.Key)
+		if c.retention > 0 {
+			return txn.SetWithTTL(key, blob, c.retention)
+		}
+
+		return txn.Set(key, blob)
+	})
+}
@@ -0,0 +1,86 @@
+package badger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func getTestFilePath() string {
+	tmp := os.TempDir()
+	dir := filepath.Join(tmp, "badger-dedup")
+	return dir
+}
+
+func TestClientSaveGet(t *testing.T) {
+	cli, err := NewClient(getTestFilePath(), time.Hour)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	_, found, err := cli.Get("missing")
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if found {
+		t.Error("expected false, got", found)
+	}
+
+	err = cli.Save(eventhus.CommandResult{Key: "deposit-1", HandledAt: time.Now()})
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	result, found, err := cli.Get("deposit-1")
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if !found {
+		t.Error("expected true, got", found)
+	}
+
+	if result.Err() != nil {
+		t.Error("expected nil, got", result.Err())
+	}
+}
+
+func TestClientReserve(t *testing.T) {
+	os.RemoveAll(getTestFilePath())
+	cli, err := NewClient(getTestFilePath(), time.Hour)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	if _, found, err := cli.Reserve("withdraw-1", time.Minute); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+
+	if _, _, err := cli.Reserve("withdraw-1", time.Minute); err != eventhus.ErrCommandInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrCommandInProgress, err)
+	}
+
+	if err = cli.Release("withdraw-1"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if _, _, err := cli.Reserve("withdraw-1", time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	cli.Save(eventhus.CommandResult{Key: "withdraw-1", Error: "balance out", HandledAt: time.Now()})
+	result, found, err := cli.Reserve("withdraw-1", time.Minute)
+	if err != nil || !found {
+		t.Errorf("expected nil and true, got %v and %v", err, found)
+	}
+
+	if result.Err() == nil || result.Err().Error() != "balance out" {
+		t.Error("expected balance out, got", result.Err())
+	}
+}
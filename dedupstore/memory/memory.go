@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// Store keeps the command results in memory
+type Store struct {
+	sync.RWMutex
+	results   map[string]eventhus.CommandResult
+	retention time.Duration
+	purgedAt  time.Time
+}
+
+// NewStore returns a dedup store, results older than retention are discarded
+// and purged once per retention, a zero retention keeps them forever
+func NewStore(retention time.Duration) *Store {
+	return &Store{
+		results:   make(map[string]eventhus.CommandResult),
+		retention: retention,
+	}
+}
+
+// Get the result of a handled command
+func (s *Store) Get(key string) (eventhus.CommandResult, bool, error) {
+	s.RLock()
+	result, ok := s.results[key]
+	s.RUnlock()
+
+	if !ok || result.Pending() || s.expired(result, time.Now()) {
+		return eventhus.CommandResult{}, false, nil
+	}
+
+	return result, true, nil
+}
+
+// Reserve claims the key for lease
+func (s *Store) Reserve(key string, lease time.Duration) (eventhus.CommandResult, bool, error) {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	result, ok := s.results[key]
+	if ok && !s.expired(result, now) && !result.Reservable(now) {
+		if result.Pending() {
+			return eventhus.CommandResult{}, false, eventhus.ErrCommandInProgress
+		}
+
+		return result, true, nil
+	}
+
+	s.results[key] = eventhus.CommandResult{
+		Key:           key,
+		HandledAt:     now,
+		ReservedUntil: now.Add(lease),
+	}
+
+	return eventhus.CommandResult{}, false, nil
+}
+
+// Release drops the reservation of the key
+func (s *Store) Release(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if result, ok := s.results[key]; ok && result.Pending() {
+		delete(s.results, key)
+	}
+
+	return nil
+}
+
+// Save the result of a handled command
+func (s *Store) Save(result eventhus.CommandResult) error {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	// the scan is paid once per retention, the memory is bounded by two of them
+	if s.retention > 0 && now.Sub(s.purgedAt) >= s.retention {
+		for key, r := range s.results {
+			if s.expired(r, now) {
+				delete(s.results, key)
+			}
+		}
+
+		s.purgedAt = now
+	}
+
+	s.results[result.Key] = result
+	return nil
+}
+
+func (s *Store) expired(result eventhus.CommandResult, now time.Time) bool {
+	return s.retention > 0 && now.Sub(result.HandledAt) > s.retention
+}
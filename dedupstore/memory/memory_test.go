@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func TestStoreGet(t *testing.T) {
+	store := NewStore(0)
+
+	_, found, err := store.Get("key")
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if found {
+		t.Error("expected false, got", found)
+	}
+
+	store.Save(eventhus.CommandResult{Key: "key", Error: "balance out", HandledAt: time.Now()})
+
+	result, found, err := store.Get("key")
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if !found {
+		t.Error("expected true, got", found)
+	}
+
+	if !errors.Is(result.Err(), errors.New("balance out")) {
+		t.Error("expected balance out, got", result.Err())
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	store := NewStore(time.Minute)
+	store.Save(eventhus.CommandResult{Key: "old", HandledAt: time.Now().Add(-time.Hour)})
+	store.Save(eventhus.CommandResult{Key: "new", HandledAt: time.Now()})
+
+	if _, found, _ := store.Get("old"); found {
+		t.Error("expected expired result")
+	}
+
+	if _, found, _ := store.Get("new"); !found {
+		t.Error("expected result to be found")
+	}
+
+	// the purge runs once per retention
+	if len(store.results) != 2 {
+		t.Error("expected 2 results before the purge, got", len(store.results))
+	}
+
+	store.purgedAt = store.purgedAt.Add(-time.Minute)
+	store.Save(eventhus.CommandResult{Key: "newer", HandledAt: time.Now()})
+
+	if len(store.results) != 2 {
+		t.Error("expected 2 results after the purge, got", len(store.results))
+	}
+}
+
+func TestStoreReserve(t *testing.T) {
+	store := NewStore(0)
+
+	if _, found, err := store.Reserve("key", time.Minute); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+
+	if _, _, err := store.Reserve("key", time.Minute); err != eventhus.ErrCommandInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrCommandInProgress, err)
+	}
+
+	if _, found, _ := store.Get("key"); found {
+		t.Error("expected the reservation to be hidden")
+	}
+
+	store.Release("key")
+	if _, _, err := store.Reserve("key", time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	store.Save(eventhus.CommandResult{Key: "key", HandledAt: time.Now()})
+	if _, found, err := store.Reserve("key", time.Minute); err != nil || !found {
+		t.Errorf("expected nil and true, got %v and %v", err, found)
+	}
+}
+
+func TestStoreReserveExpiredLease(t *testing.T) {
+	store := NewStore(0)
+	store.Reserve("key", -time.Second)
+
+	if _, found, err := store.Reserve("key", time.Minute); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+}
@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const collection = "command_results"
+
+// Client for access to mongodb
+type Client struct {
+	db      string
+	session *mgo.Session
+}
+
+// NewClient generates a new dedup store backed by mongodb, results older than
+// retention are removed by a TTL index, a zero retention keeps them forever
+func NewClient(host string, port int, db string, retention time.Duration) (*Client, error) {
+	session, err := mgo.Dial(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+
+	session.SetMode(mgo.Monotonic, true)
+
+	if retention > 0 {
+		index := mgo.Index{
+			Key:         []string{"handled_at"},
+			ExpireAfter: retention,
+		}
+
+		if err = session.DB(db).C(collection).EnsureIndex(index); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
+	return &Client{
+		db:      db,
+		session: session,
+	}, nil
+}
+
+// Get the result of a handled command
+func (c *Client) Get(key string) (eventhus.CommandResult, bool, error) {
+	var result eventhus.CommandResult
+
+	sess := c.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(c.db).C(collection).FindId(key).One(&result)
+	if err == mgo.ErrNotFound {
+		return result, false, nil
+	}
+
+	if err != nil || result.Pending() {
+		return eventhus.CommandResult{}, false, err
+	}
+
+	return result, true, nil
+}
+
+// Reserve claims the key for lease, the unique _id makes the insert atomic
+func (c *Client) Reserve(key string, lease time.Duration) (eventhus.CommandResult, bool, error) {
+	sess := c.session.Copy()
+	defer sess.Close()
+
+	col := sess.DB(c.db).C(collection)
+	now := time.Now()
+	reservation := eventhus.CommandResult{
+		Key:           key,
+		HandledAt:     now,
+		ReservedUntil: now.Add(lease),
+	}
+
+	err := col.Insert(reservation)
+	if err == nil {
+		return eventhus.CommandResult{}, false, nil
+	}
+
+	if !mgo.IsDup(err) {
+		return eventhus.CommandResult{}, false, err
+	}
+
+	var result eventhus.CommandResult
+	if err = col.FindId(key).One(&result); err != nil {
+		return eventhus.CommandResult{}, false, err
+	}
+
+	if !result.Pending() {
+		return result, true, nil
+	}
+
+	if !result.Reservable(now) {
+		return eventhus.CommandResult{}, false, eventhus.ErrCommandInProgress
+	}
+
+	// take over the expired reservation unless another caller did it first
+	err = col.Update(bson.M{"_id": key, "reserved_until": result.ReservedUntil}, reservation)
+	if err == mgo.ErrNotFound {
+		return eventhus.CommandResult{}, false, eventhus.ErrCommandInProgress
+	}
+
+	return eventhus.CommandResult{}, false, err
+}
+
+// Release drops the reservation of the key
+func (c *Client) Release(key string) error {
+	sess := c.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(c.db).C(collection).Remove(bson.M{"_id": key, "reserved_until": bson.M{"$exists": true}})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// Save the result of a handled command
+func (c *Client) Save(result eventhus.CommandResult) error {
+	sess := c.session.Copy()
+	defer sess.Close()
+
+	_, err := sess.DB(c.db).C(collection).UpsertId(result.Key, result)
+	return err
+}
@@ -0,0 +1,106 @@
+// +build integration
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func newTestClient(t *testing.T) *Client {
+	cli, err := NewClient("localhost", 27017, "eventhus_dedup", time.Hour)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	cli.session.DB(cli.db).C(collection).RemoveAll(nil)
+	return cli
+}
+
+func TestClientSaveGet(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.session.Close()
+
+	if _, found, err := cli.Get("missing"); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+
+	err := cli.Save(eventhus.CommandResult{Key: "deposit-1", HandledAt: time.Now()})
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	result, found, err := cli.Get("deposit-1")
+	if err != nil || !found {
+		t.Errorf("expected nil and true, got %v and %v", err, found)
+	}
+
+	if result.Err() != nil {
+		t.Error("expected nil, got", result.Err())
+	}
+}
+
+func TestClientReserve(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.session.Close()
+
+	if _, found, err := cli.Reserve("withdraw-1", time.Minute); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+
+	if _, _, err := cli.Reserve("withdraw-1", time.Minute); err != eventhus.ErrCommandInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrCommandInProgress, err)
+	}
+
+	// the reservation is not a result
+	if _, found, _ := cli.Get("withdraw-1"); found {
+		t.Error("expected the pending command not found")
+	}
+
+	if err := cli.Release("withdraw-1"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if _, _, err := cli.Reserve("withdraw-1", time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	cli.Save(eventhus.CommandResult{Key: "withdraw-1", Error: "balance out", HandledAt: time.Now()})
+	result, found, err := cli.Reserve("withdraw-1", time.Minute)
+	if err != nil || !found {
+		t.Errorf("expected nil and true, got %v and %v", err, found)
+	}
+
+	if result.Err() == nil || result.Err().Error() != "balance out" {
+		t.Error("expected balance out, got", result.Err())
+	}
+
+	// a handled command is not released
+	if err = cli.Release("withdraw-1"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if _, found, _ := cli.Get("withdraw-1"); !found {
+		t.Error("expected the result to be kept")
+	}
+}
+
+func TestClientReserveExpired(t *testing.T) {
+	cli := newTestClient(t)
+	defer cli.session.Close()
+
+	if _, _, err := cli.Reserve("transfer-1", -time.Second); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	// the expired reservation is taken over
+	if _, found, err := cli.Reserve("transfer-1", time.Minute); err != nil || found {
+		t.Errorf("expected nil and false, got %v and %v", err, found)
+	}
+
+	if _, _, err := cli.Reserve("transfer-1", time.Minute); err != eventhus.ErrCommandInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrCommandInProgress, err)
+	}
+}
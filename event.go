@@ -14,12 +14,13 @@ var (
 
 // Event stores the data for every event
 type Event struct {
-	ID            string      `json:"id"`
-	AggregateID   string      `json:"aggregate_id"`
-	AggregateType string      `json:"aggregate_type"`
-	Version       int         `json:"version"`
-	Type          string      `json:"type"`
-	Data          interface{} `json:"data"`
+	ID            string            `json:"id"`
+	AggregateID   string            `json:"aggregate_id"`
+	AggregateType string            `json:"aggregate_type"`
+	Version       int               `json:"version"`
+	Type          string            `json:"type"`
+	Data          interface{}       `json:"data"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 }
 
 // Register defines generic methods to create a registry
@@ -56,6 +57,10 @@ func (e *EventType) Set(source interface{}) {
 
 // Get a type based on its name
 func (e *EventType) Get(name string) (interface{}, error) {
+	if name == EventBatchType {
+		return &EventBatch{}, nil
+	}
+
 	mu.RLock()
 	rawType, ok := registry[name]
 	mu.RUnlock()
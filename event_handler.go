@@ -0,0 +1,103 @@
+package eventhus
+
+import (
+	"reflect"
+	"sync"
+)
+
+// EventHandlerRegister stores the handlers for events, an event can be handled
+// by its type, the type of its aggregate or the bucket and subset it was published to
+type EventHandlerRegister interface {
+	Add(event interface{}, handler EventHandle)
+	AddForAggregate(aggregateType string, handler EventHandle)
+	AddForSubset(bucket, subset string, handler EventHandle)
+	Get(event Event, bucket, subset string) []EventHandle
+}
+
+const (
+	matchEventType = iota
+	matchAggregateType
+	matchSubset
+)
+
+type eventHandlerEntry struct {
+	match          int
+	name           string
+	bucket, subset string
+	handler        EventHandle
+}
+
+func (e eventHandlerEntry) matches(event Event, bucket, subset string) bool {
+	switch e.match {
+	case matchEventType:
+		return e.name == event.Type
+	case matchAggregateType:
+		return e.name == event.AggregateType
+	default:
+		return e.bucket == bucket && e.subset == subset
+	}
+}
+
+// EventHandlerRegistry contains a registry of event-handler style,
+// the handlers are returned in registration order
+type EventHandlerRegistry struct {
+	sync.RWMutex
+	entries []eventHandlerEntry
+}
+
+// NewEventHandlerRegistry creates a new EventHandlerRegistry
+func NewEventHandlerRegistry() *EventHandlerRegistry {
+	return &EventHandlerRegistry{}
+}
+
+// Add a handler for an event type
+func (r *EventHandlerRegistry) Add(event interface{}, handler EventHandle) {
+	_, name := GetTypeName(event)
+	r.add(eventHandlerEntry{match: matchEventType, name: name, handler: handler})
+}
+
+// AddForAggregate adds a handler for all the events of an aggregate type
+func (r *EventHandlerRegistry) AddForAggregate(aggregateType string, handler EventHandle) {
+	r.add(eventHandlerEntry{match: matchAggregateType, name: aggregateType, handler: handler})
+}
+
+// AddForSubset adds a handler for all the events published to bucket and subset
+func (r *EventHandlerRegistry) AddForSubset(bucket, subset string, handler EventHandle) {
+	r.add(eventHandlerEntry{match: matchSubset, bucket: bucket, subset: subset, handler: handler})
+}
+
+func (r *EventHandlerRegistry) add(entry eventHandlerEntry) {
+	r.Lock()
+	r.entries = append(r.entries, entry)
+	r.Unlock()
+}
+
+// Get the handlers for an event, a pointer handler is returned once
+func (r *EventHandlerRegistry) Get(event Event, bucket, subset string) []EventHandle {
+	var handlers []EventHandle
+
+	r.RLock()
+	for _, entry := range r.entries {
+		if entry.handler != nil && entry.matches(event, bucket, subset) && !containsHandler(handlers, entry.handler) {
+			handlers = append(handlers, entry.handler)
+		}
+	}
+	r.RUnlock()
+
+	return handlers
+}
+
+// containsHandler reports whether the pointer handler is in handlers
+func containsHandler(handlers []EventHandle, handler EventHandle) bool {
+	if reflect.TypeOf(handler).Kind() != reflect.Ptr {
+		return false
+	}
+
+	for _, h := range handlers {
+		if h == handler {
+			return true
+		}
+	}
+
+	return false
+}
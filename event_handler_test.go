@@ -0,0 +1,59 @@
+package eventhus
+
+import "testing"
+
+type itemAdded struct{}
+
+type handlerStub struct {
+	name  string
+	calls *[]string
+}
+
+func (h handlerStub) Handle(event Event) error {
+	*h.calls = append(*h.calls, h.name)
+	return nil
+}
+
+func TestEventHandlerRegistryGet(t *testing.T) {
+	var calls []string
+	registry := NewEventHandlerRegistry()
+	registry.AddForSubset("shop", "cart", handlerStub{"subset", &calls})
+	registry.Add(itemAdded{}, handlerStub{"type", &calls})
+	registry.AddForAggregate("Cart", handlerStub{"aggregate", &calls})
+	registry.AddForAggregate("Order", handlerStub{"order", &calls})
+
+	event := Event{Type: "itemAdded", AggregateType: "Cart"}
+	for _, handler := range registry.Get(event, "shop", "cart") {
+		handler.Handle(event)
+	}
+
+	expected := []string{"subset", "type", "aggregate"}
+	if len(calls) != len(expected) {
+		t.Fatal("expected", expected, "got", calls)
+	}
+
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatal("expected", expected, "got", calls)
+		}
+	}
+
+	if handlers := registry.Get(Event{Type: "other"}, "shop", "orders"); len(handlers) != 0 {
+		t.Error("expected 0 handlers, got", len(handlers))
+	}
+}
+
+func TestEventHandlerRegistryGetReturnsHandlerOnce(t *testing.T) {
+	var calls []string
+	handler := &handlerStub{"projection", &calls}
+
+	registry := NewEventHandlerRegistry()
+	registry.Add(itemAdded{}, handler)
+	registry.AddForAggregate("Cart", handler)
+	registry.AddForSubset("shop", "cart", EventHandleFunc(func(event Event) error { return nil }))
+
+	handlers := registry.Get(Event{Type: "itemAdded", AggregateType: "Cart"}, "shop", "cart")
+	if len(handlers) != 2 {
+		t.Error("expected 2 handlers, got", len(handlers))
+	}
+}
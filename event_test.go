@@ -32,3 +32,29 @@ func TestEventTypeRegister(t *testing.T) {
 	}
 
 }
+
+func TestDecodeEvent(t *testing.T) {
+	reg := NewEventRegister()
+	reg.Set(SubEvent{})
+
+	blob := []byte(`{"id":"1","aggregate_id":"2","aggregate_type":"order","version":3,"type":"SubEvent","data":{"Name":"muñeca","SKU":"123"}}`)
+
+	event, err := DecodeEvent(blob, reg)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	data, ok := event.Data.(*SubEvent)
+	if !ok {
+		t.Fatalf("expected *SubEvent, got %T", event.Data)
+	}
+
+	if event.AggregateID != "2" || event.Version != 3 || data.SKU != "123" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	_, err = DecodeEvent([]byte(`{"type":"Missing"}`), reg)
+	if err == nil {
+		t.Error("expected error, got nil")
+	}
+}
@@ -0,0 +1,96 @@
+package eventhus
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mishudark/eventhus/utils"
+)
+
+// EventBatchType is the type of the events whose Data is an *EventBatch, the
+// register knows it without being set
+const EventBatchType = "EventBatch"
+
+// EventBatch is the envelope of the events saved together by an aggregate, it's
+// published as a single message so the consumers see all of them or none
+type EventBatch struct {
+	CommitID string  `json:"commit_id"`
+	Count    int     `json:"count"`
+	Events   []Event `json:"events"`
+}
+
+// UnmarshalJSON decodes the events of the batch with the types of the register
+func (b *EventBatch) UnmarshalJSON(blob []byte) error {
+	var raw struct {
+		CommitID string            `json:"commit_id"`
+		Count    int               `json:"count"`
+		Events   []json.RawMessage `json:"events"`
+	}
+
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return err
+	}
+
+	if raw.Count != len(raw.Events) {
+		return fmt.Errorf("batch %s has %d events, expected %d", raw.CommitID, len(raw.Events), raw.Count)
+	}
+
+	register := NewEventRegister()
+	events := make([]Event, len(raw.Events))
+	for i, e := range raw.Events {
+		event, err := DecodeEvent(e, register)
+		if err != nil {
+			return err
+		}
+
+		events[i] = event
+	}
+
+	b.CommitID = raw.CommitID
+	b.Count = raw.Count
+	b.Events = events
+	return nil
+}
+
+// NewBatchEvent wraps events of an aggregate in an EventBatch, the envelope
+// takes the aggregate, last version and metadata of the events
+func NewBatchEvent(events []Event) (Event, error) {
+	commitID, err := utils.UUID()
+	if err != nil {
+		return Event{}, err
+	}
+
+	last := events[len(events)-1]
+	return Event{
+		ID:            commitID,
+		AggregateID:   last.AggregateID,
+		AggregateType: last.AggregateType,
+		Version:       last.Version,
+		Type:          EventBatchType,
+		Data: &EventBatch{
+			CommitID: commitID,
+			Count:    len(events),
+			Events:   events,
+		},
+		Metadata: last.Metadata,
+	}, nil
+}
+
+// UnpackBatch returns a handler that calls handler with every event of a batch
+// in order, it stops at the first error; the other events are passed through
+func UnpackBatch(handler EventHandle) EventHandle {
+	return EventHandleFunc(func(event Event) error {
+		batch, ok := event.Data.(*EventBatch)
+		if !ok || event.Type != EventBatchType {
+			return handler.Handle(event)
+		}
+
+		for _, e := range batch.Events {
+			if err := handler.Handle(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package eventhus
+
+import "testing"
+
+type batchBusStub struct {
+	published []Event
+}
+
+func (b *batchBusStub) Publish(event Event, bucket, subset string) error {
+	b.published = append(b.published, event)
+	return nil
+}
+
+type orderAggregate struct {
+	BaseAggregate
+}
+
+func (a *orderAggregate) ApplyChange(event Event) {}
+
+func (a *orderAggregate) HandleCommand(command Command) error {
+	return nil
+}
+
+func TestPublishEventsAtomicBatch(t *testing.T) {
+	reg := NewEventRegister()
+	reg.Set(SubEvent{})
+
+	aggregate := &orderAggregate{}
+	aggregate.ApplyChangeHelper(aggregate, Event{AggregateID: "1", Data: &SubEvent{SKU: "a"}}, true)
+	aggregate.ApplyChangeHelper(aggregate, Event{AggregateID: "1", Data: &SubEvent{SKU: "b"}}, true)
+
+	bus := &batchBusStub{}
+	repository := NewRepository(nil, bus)
+
+	if err := repository.PublishEvents(aggregate, "shop", "orders", AtomicBatch()); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(bus.published) != 1 {
+		t.Fatal("expected 1 message, got", len(bus.published))
+	}
+
+	msg, err := JSONCodec{}.Encode(bus.published[0], "shop", "orders")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	event, err := JSONCodec{}.Decode(msg, reg)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	batch, ok := event.Data.(*EventBatch)
+	if !ok || event.Type != EventBatchType || batch.Count != 2 || batch.CommitID != event.ID || event.Version != 2 {
+		t.Fatalf("unexpected batch %+v", event)
+	}
+
+	var skus []string
+	handler := UnpackBatch(EventHandleFunc(func(e Event) error {
+		skus = append(skus, e.Data.(*SubEvent).SKU)
+		return nil
+	}))
+
+	if err = handler.Handle(event); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(skus) != 2 || skus[0] != "a" || skus[1] != "b" {
+		t.Error("expected [a b], got", skus)
+	}
+}
+
+func TestEventBatchIncomplete(t *testing.T) {
+	msg := Message{Body: []byte(`{"type":"EventBatch","data":{"commit_id":"1","count":2,"events":[]}}`)}
+
+	if _, err := (JSONCodec{}).Decode(msg, NewEventRegister()); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
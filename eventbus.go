@@ -1,6 +1,94 @@
 package eventhus
 
+import "encoding/json"
+
 // EventBus defines the methods for manage the events publisher and consumer
 type EventBus interface {
 	Publish(event Event, bucket, subset string) error
 }
+
+// BatchEvent is an event waiting to be published to bucket and subset
+type BatchEvent struct {
+	Event  Event
+	Bucket string
+	Subset string
+}
+
+// BatchPublisher is implemented by the event buses able to publish several
+// events at once, paying the round trip to the broker a single time
+type BatchPublisher interface {
+	PublishBatch(events []BatchEvent) error
+}
+
+// EventHandle defines the contract to handle events
+type EventHandle interface {
+	Handle(event Event) error
+}
+
+// EventHandleFunc is an adapter to use a func as EventHandle
+type EventHandleFunc func(event Event) error
+
+// Handle calls f(event)
+func (f EventHandleFunc) Handle(event Event) error {
+	return f(event)
+}
+
+// Subscription is returned by Subscribe, closing it stops the delivery of events
+type Subscription interface {
+	Close() error
+}
+
+// Subscriber is implemented by the event buses able to consume the events
+// published to a bucket and subset
+type Subscriber interface {
+	Subscribe(bucket, subset string, handler EventHandle) (Subscription, error)
+}
+
+// GroupSubscriber shares the events among the members of a group, every event
+// is delivered to a single one of them
+type GroupSubscriber interface {
+	SubscribeGroup(group, bucket, subset string, handler EventHandle) (Subscription, error)
+}
+
+// rawEvent is used to decode the data of an event after its type is known
+type rawEvent struct {
+	ID            string            `json:"id"`
+	AggregateID   string            `json:"aggregate_id"`
+	AggregateType string            `json:"aggregate_type"`
+	Version       int               `json:"version"`
+	Type          string            `json:"type"`
+	Data          json.RawMessage   `json:"data"`
+	Metadata      map[string]string `json:"metadata"`
+}
+
+// DecodeEvent builds an event from its json representation, Data is
+// a pointer to the type registered in the register with the event type
+func DecodeEvent(blob []byte, register EventTypeRegister) (Event, error) {
+	var raw rawEvent
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return Event{}, err
+	}
+
+	event := Event{
+		ID:            raw.ID,
+		AggregateID:   raw.AggregateID,
+		AggregateType: raw.AggregateType,
+		Version:       raw.Version,
+		Type:          raw.Type,
+		Metadata:      raw.Metadata,
+	}
+
+	data, err := register.Get(raw.Type)
+	if err != nil {
+		return event, err
+	}
+
+	if len(raw.Data) > 0 {
+		if err = json.Unmarshal(raw.Data, data); err != nil {
+			return event, err
+		}
+	}
+
+	event.Data = data
+	return event, nil
+}
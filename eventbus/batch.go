@@ -0,0 +1,247 @@
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/utils"
+)
+
+// ErrBatcherClosed is returned when publishing through a closed Batcher
+var ErrBatcherClosed = errors.New("the batcher is closed")
+
+// Default settings of the batcher
+const (
+	DefaultBatchSize   = 100
+	DefaultBatchWindow = 10 * time.Millisecond
+)
+
+// BatchError holds the events of a batch that weren't published
+type BatchError struct {
+	Events []eventhus.BatchEvent
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d events not published: %s", len(e.Events), e.Err)
+}
+
+// Unwrap returns the error of the bus
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchErrorHandler receives the events of every batch that failed, it's the
+// only one that sees the events of the publishers that already returned
+type BatchErrorHandler func(*BatchError)
+
+// Batcher decorates an EventBus, the events are published together once the
+// batch is full or the window elapses
+type Batcher struct {
+	bus     eventhus.EventBus
+	size    int
+	window  time.Duration
+	onError BatchErrorHandler
+
+	mu      sync.Mutex
+	drained *sync.Cond
+	pending []eventhus.BatchEvent
+	timer   *time.Timer
+	closed  bool
+
+	// a single batch is sent at a time, so a slow bus blocks the publishers
+	// instead of piling up batches
+	sending sync.Mutex
+}
+
+// BatchOption customizes a Batcher
+type BatchOption func(*Batcher)
+
+// WithBatchSize sets the quantity of events that triggers a publish
+func WithBatchSize(size int) BatchOption {
+	return func(b *Batcher) {
+		b.size = size
+	}
+}
+
+// WithBatchWindow sets how long an event waits for the batch to be full, zero
+// waits until the batch is full or flushed
+func WithBatchWindow(window time.Duration) BatchOption {
+	return func(b *Batcher) {
+		b.window = window
+	}
+}
+
+// DeadLetterBatches returns an error handler that saves the events of the failed
+// batches in store, target names the bus in the dead letters
+func DeadLetterBatches(store eventhus.EventDeadLetterStore, target string) BatchErrorHandler {
+	return func(err *BatchError) {
+		for _, e := range err.Events {
+			id, idErr := utils.UUID()
+			if idErr != nil {
+				continue
+			}
+
+			store.Save(eventhus.EventDeadLetter{
+				ID:       id,
+				Event:    e.Event,
+				Target:   target,
+				Bucket:   e.Bucket,
+				Subset:   e.Subset,
+				Error:    err.Err.Error(),
+				Attempts: 1,
+				FailedAt: time.Now(),
+			})
+		}
+	}
+}
+
+// NewBatcher decorates bus, onError gets the failed batches since their events
+// belong to publishers that already returned; they're logged when it's nil
+func NewBatcher(bus eventhus.EventBus, onError BatchErrorHandler, options ...BatchOption) *Batcher {
+	if onError == nil {
+		onError = func(err *BatchError) {
+			log.Println("eventbus: batch failed:", err)
+		}
+	}
+
+	b := &Batcher{
+		bus:     bus,
+		size:    DefaultBatchSize,
+		window:  DefaultBatchWindow,
+		onError: onError,
+	}
+	b.drained = sync.NewCond(&b.mu)
+
+	for _, opt := range options {
+		opt(b)
+	}
+
+	if b.size < 1 {
+		b.size = 1
+	}
+
+	return b
+}
+
+// Publish adds an event to the batch, a nil error means it was buffered, not
+// delivered; it waits while the batch is full
+func (b *Batcher) Publish(event eventhus.Event, bucket, subset string) error {
+	b.mu.Lock()
+	for !b.closed && len(b.pending) >= b.size {
+		b.drained.Wait()
+	}
+
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+
+	b.pending = append(b.pending, eventhus.BatchEvent{Event: event, Bucket: bucket, Subset: subset})
+
+	if len(b.pending) >= b.size {
+		b.mu.Unlock()
+		return b.Flush()
+	}
+
+	if b.timer == nil && b.window > 0 {
+		b.timer = time.AfterFunc(b.window, b.expire)
+	}
+
+	b.mu.Unlock()
+	return nil
+}
+
+// Flush publishes the pending events, a failed batch goes to the error handler
+func (b *Batcher) Flush() error {
+	return b.flush(false)
+}
+
+// Close flushes the pending events, the next publishes fail with ErrBatcherClosed
+func (b *Batcher) Close() error {
+	return b.flush(true)
+}
+
+// flush takes the batch once the previous one was sent, so the batches are
+// published in order
+func (b *Batcher) flush(close bool) error {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+
+	b.mu.Lock()
+	if close {
+		b.closed = true
+	}
+	batch := b.take()
+	b.drained.Broadcast()
+	b.mu.Unlock()
+
+	err := b.send(batch)
+	if err != nil {
+		b.onError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Pending returns the quantity of events waiting to be published
+func (b *Batcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending)
+}
+
+// expire publishes the batch once the window elapsed, there is no caller to
+// return the error to
+func (b *Batcher) expire() {
+	b.Flush()
+}
+
+// take must be called with the lock held, it empties the batch
+func (b *Batcher) take() []eventhus.BatchEvent {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	batch := b.pending
+	b.pending = nil
+
+	return batch
+}
+
+// send must be called with the sending lock held, the events are published in
+// order and the first failure stops the batch
+func (b *Batcher) send(batch []eventhus.BatchEvent) *BatchError {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if bp, ok := b.bus.(eventhus.BatchPublisher); ok {
+		if err := bp.PublishBatch(batch); err != nil {
+			// the bus knows which events failed
+			var batchErr *BatchError
+			if errors.As(err, &batchErr) {
+				return batchErr
+			}
+
+			return &BatchError{Events: batch, Err: err}
+		}
+
+		return nil
+	}
+
+	for i, e := range batch {
+		if err := b.bus.Publish(e.Event, e.Bucket, e.Subset); err != nil {
+			return &BatchError{Events: batch[i:], Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package eventbus
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/deadletterstore/memory"
+)
+
+type batchStub struct {
+	mu      sync.Mutex
+	batches [][]eventhus.BatchEvent
+	err     error
+}
+
+func (s *batchStub) Publish(event eventhus.Event, bucket, subset string) error {
+	return s.PublishBatch([]eventhus.BatchEvent{{Event: event, Bucket: bucket, Subset: subset}})
+}
+
+func (s *batchStub) PublishBatch(events []eventhus.BatchEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, events)
+	return s.err
+}
+
+func (s *batchStub) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.batches)
+}
+
+func TestBatcherSize(t *testing.T) {
+	bus := &batchStub{}
+	sut := NewBatcher(bus, func(*BatchError) {}, WithBatchSize(3), WithBatchWindow(0))
+
+	for i := 0; i < 7; i++ {
+		if err := sut.Publish(eventhus.Event{Version: i}, "banks", "accounts"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	if bus.len() != 2 {
+		t.Fatal("expected 2 batches, got", bus.len())
+	}
+
+	if sut.Pending() != 1 {
+		t.Error("expected 1 pending event, got", sut.Pending())
+	}
+
+	if err := sut.Close(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	version := 0
+	for _, batch := range bus.batches {
+		for _, e := range batch {
+			if e.Event.Version != version {
+				t.Errorf("expected version %d, got %d", version, e.Event.Version)
+			}
+			version++
+		}
+	}
+
+	if version != 7 {
+		t.Error("expected 7 events, got", version)
+	}
+
+	if err := sut.Publish(eventhus.Event{}, "banks", "accounts"); err != ErrBatcherClosed {
+		t.Errorf("expected %v, got %v", ErrBatcherClosed, err)
+	}
+}
+
+func TestBatcherWindow(t *testing.T) {
+	bus := &batchStub{err: errors.New("expected error")}
+	failed := make(chan *BatchError, 1)
+
+	sut := NewBatcher(bus, func(err *BatchError) {
+		failed <- err
+	},
+		WithBatchSize(10),
+		WithBatchWindow(10*time.Millisecond),
+	)
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+
+	select {
+	case err := <-failed:
+		if len(err.Events) != 2 || !errors.Is(err, bus.err) {
+			t.Errorf("expected 2 events and %v, got %v", bus.err, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the batch to be published once the window elapsed")
+	}
+
+	if bus.len() != 1 {
+		t.Error("expected 1 batch, got", bus.len())
+	}
+}
+
+func TestBatcherWithoutBatchPublisher(t *testing.T) {
+	bus := &producerStub{}
+	var failed []*BatchError
+	sut := NewBatcher(bus, func(err *BatchError) {
+		failed = append(failed, err)
+	}, WithBatchSize(2), WithBatchWindow(0))
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if len(bus.entries) != 0 {
+		t.Error("expected 0 events, got", len(bus.entries))
+	}
+
+	bus.err = errors.New("expected error")
+	err, ok := sut.Publish(eventhus.Event{}, "banks", "accounts").(*BatchError)
+	if !ok || len(err.Events) != 2 || err.Err != bus.err {
+		t.Errorf("expected 2 events and %v, got %v", bus.err, err)
+	}
+
+	if len(bus.entries) != 1 {
+		t.Error("expected the batch to stop at the first failure, got", len(bus.entries))
+	}
+
+	// the events of the other publishers reach the error handler
+	if len(failed) != 1 || len(failed[0].Events) != 2 {
+		t.Errorf("expected a failed batch of 2 events, got %v", failed)
+	}
+}
+
+func TestDeadLetterBatches(t *testing.T) {
+	bus := &batchStub{err: errors.New("expected error")}
+	store := memory.NewStore()
+	sut := NewBatcher(bus, DeadLetterBatches(store, "nats"), WithBatchSize(10), WithBatchWindow(0))
+
+	sut.Publish(eventhus.Event{Version: 1}, "banks", "accounts")
+	sut.Publish(eventhus.Event{Version: 2}, "banks", "accounts")
+	sut.Close()
+
+	letters, _ := store.List()
+	if len(letters) != 2 {
+		t.Fatal("expected 2 dead letters, got", len(letters))
+	}
+
+	if letters[0].Target != "nats" || letters[0].Bucket != "banks" || letters[0].Error != "expected error" {
+		t.Errorf("unexpected dead letter %+v", letters[0])
+	}
+}
+
+func TestBatcherWithoutErrorHandler(t *testing.T) {
+	bus := &batchStub{err: errors.New("expected error")}
+	sut := NewBatcher(bus, nil, WithBatchWindow(time.Millisecond))
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	time.Sleep(20 * time.Millisecond)
+
+	if bus.len() != 1 {
+		t.Error("expected the expired batch to be sent, got", bus.len())
+	}
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if err := sut.Close(); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// slowBatchStub holds every batch until release is closed
+type slowBatchStub struct {
+	batchStub
+	release chan struct{}
+}
+
+func (s *slowBatchStub) PublishBatch(events []eventhus.BatchEvent) error {
+	<-s.release
+	return s.batchStub.PublishBatch(events)
+}
+
+func TestBatcherBoundsPending(t *testing.T) {
+	bus := &slowBatchStub{release: make(chan struct{})}
+	sut := NewBatcher(bus, func(*BatchError) {}, WithBatchSize(2), WithBatchWindow(0))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sut.Publish(eventhus.Event{}, "banks", "accounts")
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if pending := sut.Pending(); pending > 2 {
+		t.Error("expected at most 2 pending events, got", pending)
+	}
+
+	close(bus.release)
+	wg.Wait()
+
+	if err := sut.Close(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	events := 0
+	for _, batch := range bus.batches {
+		events += len(batch)
+	}
+
+	if events != 10 {
+		t.Error("expected 10 events, got", events)
+	}
+}
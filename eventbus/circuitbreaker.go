@@ -0,0 +1,330 @@
+package eventbus
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// ErrCircuitOpen is returned while the circuit is open and there is no fallback
+var ErrCircuitOpen = errors.New("the circuit is open")
+
+// Default settings of the circuit breaker
+const (
+	DefaultRetries          = 3
+	DefaultMinBackoff       = 100 * time.Millisecond
+	DefaultMaxBackoff       = 5 * time.Second
+	DefaultJitter           = 0.2
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// Closed lets the events through
+	Closed CircuitState = iota
+	// Open fails fast or diverts the events to the fallback
+	Open
+	// HalfOpen lets a single publish through to probe the bus
+	HalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitBreaker decorates an EventBus, failed publishes are retried with backoff
+// and after too many the events fail fast or go to the fallback bus
+type CircuitBreaker struct {
+	bus         eventhus.EventBus
+	fallback    eventhus.EventBus
+	retries     int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+	threshold   int
+	openTimeout time.Duration
+	retryable   func(error) bool
+	onChange    func(from, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+	changes  []transition
+
+	now    func() time.Time
+	sleep  func(time.Duration)
+	random func() float64
+}
+
+// transition is a change of state not notified yet
+type transition struct {
+	from, to CircuitState
+}
+
+// CircuitBreakerOption customizes a CircuitBreaker
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// WithRetries sets how many times a failed publish is retried
+func WithRetries(retries int) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.retries = retries
+	}
+}
+
+// WithBackoff sets the wait before the first retry, it doubles on every retry up to max
+func WithBackoff(min, max time.Duration) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithJitter sets the fraction of the backoff that is randomized, from 0 to 1
+func WithJitter(jitter float64) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.jitter = jitter
+	}
+}
+
+// WithFailureThreshold sets the consecutive failed publishes that open the circuit
+func WithFailureThreshold(threshold int) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.threshold = threshold
+	}
+}
+
+// WithOpenTimeout sets how long the circuit stays open before probing the bus
+func WithOpenTimeout(timeout time.Duration) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.openTimeout = timeout
+	}
+}
+
+// WithFallback sets the bus that gets the events while the circuit is open or
+// when the retries are exhausted
+func WithFallback(fallback eventhus.EventBus) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.fallback = fallback
+	}
+}
+
+// WithRetryable sets which errors are transient, all of them by default; the
+// other ones are returned at once and don't count toward the failure threshold
+func WithRetryable(retryable func(error) bool) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.retryable = retryable
+	}
+}
+
+// WithStateChange is called every time the state of the circuit changes
+func WithStateChange(handler func(from, to CircuitState)) CircuitBreakerOption {
+	return func(c *CircuitBreaker) {
+		c.onChange = handler
+	}
+}
+
+// NewCircuitBreaker decorates bus
+func NewCircuitBreaker(bus eventhus.EventBus, options ...CircuitBreakerOption) *CircuitBreaker {
+	c := &CircuitBreaker{
+		bus:         bus,
+		retries:     DefaultRetries,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		jitter:      DefaultJitter,
+		threshold:   DefaultFailureThreshold,
+		openTimeout: DefaultOpenTimeout,
+		retryable: func(error) bool {
+			return true
+		},
+		now:    time.Now,
+		sleep:  time.Sleep,
+		random: rand.Float64,
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+}
+
+// State returns the current state of the circuit
+func (c *CircuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == Open && c.now().Sub(c.openedAt) >= c.openTimeout {
+		return HalfOpen
+	}
+
+	return c.state
+}
+
+// Failures returns the consecutive failed publishes
+func (c *CircuitBreaker) Failures() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.failures
+}
+
+// Publish an event through the decorated bus, the last error is returned in an
+// *AttemptsError
+func (c *CircuitBreaker) Publish(event eventhus.Event, bucket, subset string) error {
+	allowed, probe := c.allow()
+	if !allowed {
+		if c.fallback != nil {
+			return c.fallback.Publish(event, bucket, subset)
+		}
+
+		return ErrCircuitOpen
+	}
+
+	// the probe isn't retried, a failure opens the circuit again at once
+	retries := c.retries
+	if probe {
+		retries = 0
+	}
+
+	backoff := c.minBackoff
+
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		if err = c.bus.Publish(event, bucket, subset); err == nil {
+			c.success()
+			return nil
+		}
+
+		if !c.retryable(err) {
+			c.release()
+			return &AttemptsError{Err: err, Attempts: attempts}
+		}
+
+		if attempts > retries {
+			break
+		}
+
+		c.sleep(c.withJitter(backoff))
+
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+
+	c.failure()
+
+	if c.fallback != nil {
+		return c.fallback.Publish(event, bucket, subset)
+	}
+
+	return &AttemptsError{Err: err, Attempts: attempts}
+}
+
+// withJitter subtracts a random fraction of the backoff, so the clients that
+// failed together don't retry together
+func (c *CircuitBreaker) withJitter(backoff time.Duration) time.Duration {
+	return backoff - time.Duration(c.random()*c.jitter*float64(backoff))
+}
+
+// allow reports whether the publish can reach the bus and whether it probes it
+func (c *CircuitBreaker) allow() (allowed, probe bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	switch c.state {
+	case Open:
+		if c.now().Sub(c.openedAt) < c.openTimeout {
+			return false, false
+		}
+
+		c.setState(HalfOpen)
+		c.probing = true
+		return true, true
+	case HalfOpen:
+		// a probe is already running
+		if c.probing {
+			return false, false
+		}
+
+		c.probing = true
+		return true, true
+	}
+
+	return true, false
+}
+
+// release ends a probe without result, the next publish probes the bus again
+func (c *CircuitBreaker) release() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.probing = false
+}
+
+func (c *CircuitBreaker) success() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.failures = 0
+	c.probing = false
+	c.setState(Closed)
+}
+
+func (c *CircuitBreaker) failure() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.failures++
+	c.probing = false
+
+	if c.state == HalfOpen || c.failures >= c.threshold {
+		c.openedAt = c.now()
+		c.setState(Open)
+	}
+}
+
+// setState must be called with the lock held, the change is notified by unlock
+func (c *CircuitBreaker) setState(state CircuitState) {
+	if c.state == state {
+		return
+	}
+
+	c.changes = append(c.changes, transition{c.state, state})
+	c.state = state
+}
+
+// unlock releases the lock and notifies the changes of state, so the handler
+// can call the circuit breaker
+func (c *CircuitBreaker) unlock() {
+	changes := c.changes
+	c.changes = nil
+	c.mu.Unlock()
+
+	if c.onChange == nil {
+		return
+	}
+
+	for _, change := range changes {
+		c.onChange(change.from, change.to)
+	}
+}
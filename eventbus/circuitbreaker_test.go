@@ -0,0 +1,181 @@
+package eventbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func newCircuitBreaker(bus eventhus.EventBus, options ...CircuitBreakerOption) (*CircuitBreaker, *time.Time, *[]time.Duration) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+
+	c := NewCircuitBreaker(bus, options...)
+	c.now = func() time.Time { return now }
+	c.sleep = func(d time.Duration) { waits = append(waits, d) }
+	c.random = func() float64 { return 0.5 }
+
+	return c, &now, &waits
+}
+
+func TestCircuitBreakerRetries(t *testing.T) {
+	failing := &producerStub{err: errors.New("expected error")}
+	sut, _, waits := newCircuitBreaker(failing, WithRetries(3), WithBackoff(time.Second, 3*time.Second), WithJitter(0.2))
+
+	err := sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if !errors.Is(err, failing.err) {
+		t.Errorf("expected %v, got %v", failing.err, err)
+	}
+
+	if attemptsErr, ok := err.(*AttemptsError); !ok || attemptsErr.Attempts != 4 {
+		t.Errorf("expected 4 attempts, got %v", err)
+	}
+
+	if len(failing.entries) != 4 {
+		t.Error("expected 4 attempts, got", len(failing.entries))
+	}
+
+	expected := []time.Duration{900 * time.Millisecond, 1800 * time.Millisecond, 2700 * time.Millisecond}
+	if len(*waits) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, *waits)
+	}
+
+	for i := range expected {
+		if (*waits)[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, *waits)
+		}
+	}
+}
+
+func TestCircuitBreakerNotRetryable(t *testing.T) {
+	failing := &producerStub{err: errors.New("expected error")}
+	sut, _, _ := newCircuitBreaker(failing, WithFailureThreshold(1), WithRetryable(func(error) bool { return false }))
+
+	if err := sut.Publish(eventhus.Event{}, "banks", "accounts"); !errors.Is(err, failing.err) {
+		t.Errorf("expected %v, got %v", failing.err, err)
+	}
+
+	if len(failing.entries) != 1 {
+		t.Error("expected 1 attempt, got", len(failing.entries))
+	}
+
+	if sut.State() != Closed || sut.Failures() != 0 {
+		t.Errorf("expected closed without failures, got %v %d", sut.State(), sut.Failures())
+	}
+}
+
+func TestCircuitBreakerProbesOnce(t *testing.T) {
+	bus := &producerStub{err: errors.New("expected error")}
+	sut, now, waits := newCircuitBreaker(bus, WithRetries(3), WithFailureThreshold(1), WithOpenTimeout(time.Minute))
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if len(bus.entries) != 4 || sut.State() != Open {
+		t.Fatalf("expected 4 attempts and open, got %d %v", len(bus.entries), sut.State())
+	}
+
+	*now = now.Add(time.Minute)
+	err := sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if attemptsErr, ok := err.(*AttemptsError); !ok || attemptsErr.Attempts != 1 {
+		t.Errorf("expected 1 attempt, got %v", err)
+	}
+
+	if len(bus.entries) != 5 || len(*waits) != 3 {
+		t.Errorf("expected a single probe without waits, got %d attempts %v", len(bus.entries), *waits)
+	}
+
+	if sut.State() != Open {
+		t.Error("expected open, got", sut.State())
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	bus := &producerStub{err: errors.New("expected error")}
+
+	var changes []string
+	sut, now, _ := newCircuitBreaker(bus,
+		WithRetries(0),
+		WithFailureThreshold(2),
+		WithOpenTimeout(time.Minute),
+		WithStateChange(func(from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if sut.State() != Closed {
+		t.Error("expected closed, got", sut.State())
+	}
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if sut.State() != Open {
+		t.Error("expected open, got", sut.State())
+	}
+
+	// fail fast
+	if err := sut.Publish(eventhus.Event{}, "banks", "accounts"); err != ErrCircuitOpen {
+		t.Errorf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+
+	if len(bus.entries) != 2 {
+		t.Error("expected 2 attempts, got", len(bus.entries))
+	}
+
+	// the probe fails, the circuit opens again
+	*now = now.Add(time.Minute)
+	if sut.State() != HalfOpen {
+		t.Error("expected half-open, got", sut.State())
+	}
+
+	sut.Publish(eventhus.Event{}, "banks", "accounts")
+	if sut.State() != Open {
+		t.Error("expected open, got", sut.State())
+	}
+
+	// the probe succeeds
+	*now = now.Add(time.Minute)
+	bus.err = nil
+
+	if err := sut.Publish(eventhus.Event{}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if sut.State() != Closed || sut.Failures() != 0 {
+		t.Errorf("expected closed without failures, got %v %d", sut.State(), sut.Failures())
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, changes)
+		}
+	}
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	bus := &producerStub{err: errors.New("expected error")}
+	fallback := &producerStub{}
+
+	sut, _, _ := newCircuitBreaker(bus, WithRetries(1), WithFailureThreshold(1), WithFallback(fallback))
+
+	if err := sut.Publish(eventhus.Event{ID: "1"}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := sut.Publish(eventhus.Event{ID: "2"}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(bus.entries) != 2 {
+		t.Error("expected 2 attempts, got", len(bus.entries))
+	}
+
+	if len(fallback.entries) != 2 || fallback.entries[1].event.ID != "2" {
+		t.Errorf("unexpected fallback entries %+v", fallback.entries)
+	}
+}
@@ -0,0 +1,253 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// SpecVersion is the version of the CloudEvents specification implemented
+const SpecVersion = "1.0"
+
+// ContentType of the events encoded in structured mode
+const ContentType = "application/cloudevents+json"
+
+// DefaultSource is prepended to the aggregate type to build the source attribute
+const DefaultSource = "eventhus"
+
+// Mode selects how the events are encoded
+type Mode int
+
+const (
+	// Structured puts the attributes and the data in the body
+	Structured Mode = iota
+	// Binary puts the data in the body and the attributes in the message header
+	Binary
+)
+
+// Attributes of a CloudEvent, the ones not listed here are extensions
+const (
+	attrSpecVersion     = "specversion"
+	attrID              = "id"
+	attrSource          = "source"
+	attrType            = "type"
+	attrSubject         = "subject"
+	attrTime            = "time"
+	attrDataContentType = "datacontenttype"
+	attrDataSchema      = "dataschema"
+	attrData            = "data"
+	attrDataBase64      = "data_base64"
+	// attrVersion is the extension holding the version of the aggregate
+	attrVersion = "aggregateversion"
+)
+
+// Codec implements eventhus.EventCodec with the CloudEvents 1.0 format, the
+// metadata is sent as extensions
+//
+// Decode accepts both modes and falls back to the plain json encoding, so
+// subscribers can read the events published before the switch
+type Codec struct {
+	mode       Mode
+	source     string
+	typePrefix string
+	now        func() time.Time
+}
+
+// Option customizes the codec
+type Option func(*Codec)
+
+// WithSource sets the prefix of the source attribute
+func WithSource(source string) Option {
+	return func(c *Codec) {
+		c.source = strings.TrimSuffix(source, "/")
+	}
+}
+
+// WithTypePrefix is prepended to the event type, e.g. `com.example.bank.`
+func WithTypePrefix(prefix string) Option {
+	return func(c *Codec) {
+		c.typePrefix = prefix
+	}
+}
+
+// NewCodec returns a codec that encodes the events in mode
+func NewCodec(mode Mode, options ...Option) *Codec {
+	c := &Codec{
+		mode:   mode,
+		source: DefaultSource,
+		now:    time.Now,
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	return c
+}
+
+// Encode an event as a CloudEvent
+func (c *Codec) Encode(event eventhus.Event, bucket, subset string) (eventhus.Message, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return eventhus.Message{}, err
+	}
+
+	attributes := map[string]string{
+		attrSpecVersion: SpecVersion,
+		attrID:          event.ID,
+		attrSource:      c.source + "/" + event.AggregateType,
+		attrType:        c.typePrefix + event.Type,
+		attrTime:        c.now().UTC().Format(time.RFC3339Nano),
+		attrVersion:     strconv.Itoa(event.Version),
+	}
+
+	if event.AggregateID != "" {
+		attributes[attrSubject] = event.AggregateID
+	}
+
+	for key, value := range event.Metadata {
+		if _, ok := attributes[key]; ok {
+			return eventhus.Message{}, fmt.Errorf("cloudevents: metadata %q clashes with an attribute", key)
+		}
+
+		attributes[key] = value
+	}
+
+	if c.mode == Binary {
+		return eventhus.Message{
+			ContentType: eventhus.JSONContentType,
+			Header:      attributes,
+			Body:        data,
+		}, nil
+	}
+
+	structured := make(map[string]interface{}, len(attributes)+2)
+	for key, value := range attributes {
+		structured[key] = value
+	}
+
+	structured[attrDataContentType] = eventhus.JSONContentType
+	structured[attrData] = json.RawMessage(data)
+
+	blob, err := json.Marshal(structured)
+	if err != nil {
+		return eventhus.Message{}, err
+	}
+
+	return eventhus.Message{
+		ContentType: ContentType,
+		Body:        blob,
+	}, nil
+}
+
+// Decode a CloudEvent in any mode, messages without CloudEvents attributes are
+// decoded as plain json
+func (c *Codec) Decode(msg eventhus.Message, register eventhus.EventTypeRegister) (eventhus.Event, error) {
+	if strings.HasPrefix(msg.ContentType, ContentType) || msg.ContentType == "" && isStructured(msg.Body) {
+		return c.decodeStructured(msg.Body, register)
+	}
+
+	if msg.Header[attrSpecVersion] != "" {
+		return c.decode(msg.Header, msg.Body, register)
+	}
+
+	return eventhus.DecodeEvent(msg.Body, register)
+}
+
+// isStructured sniffs the body of the messages sent over transports without a
+// content type
+func isStructured(blob []byte) bool {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+
+	return json.Unmarshal(blob, &probe) == nil && probe.SpecVersion != ""
+}
+
+func (c *Codec) decodeStructured(blob []byte, register eventhus.EventTypeRegister) (eventhus.Event, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return eventhus.Event{}, err
+	}
+
+	data := fields[attrData]
+	attributes := make(map[string]string, len(fields))
+
+	for key, raw := range fields {
+		if key == attrData || key == attrDataBase64 {
+			continue
+		}
+
+		// the extensions can be strings, numbers or booleans
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+
+		attributes[key] = value
+	}
+
+	return c.decode(attributes, data, register)
+}
+
+func (c *Codec) decode(attributes map[string]string, data []byte, register eventhus.EventTypeRegister) (eventhus.Event, error) {
+	if version := attributes[attrSpecVersion]; version != SpecVersion {
+		return eventhus.Event{}, fmt.Errorf("cloudevents: unsupported specversion %q", version)
+	}
+
+	event := eventhus.Event{
+		ID:            attributes[attrID],
+		AggregateID:   attributes[attrSubject],
+		AggregateType: c.aggregateType(attributes[attrSource]),
+		Type:          strings.TrimPrefix(attributes[attrType], c.typePrefix),
+	}
+
+	if version, ok := attributes[attrVersion]; ok {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return event, fmt.Errorf("cloudevents: invalid %s %q", attrVersion, version)
+		}
+
+		event.Version = v
+	}
+
+	for key, value := range attributes {
+		switch key {
+		case attrSpecVersion, attrID, attrSource, attrType, attrSubject, attrTime,
+			attrDataContentType, attrDataSchema, attrVersion:
+		default:
+			if event.Metadata == nil {
+				event.Metadata = make(map[string]string)
+			}
+			event.Metadata[key] = value
+		}
+	}
+
+	value, err := register.Get(event.Type)
+	if err != nil {
+		return event, err
+	}
+
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, value); err != nil {
+			return event, err
+		}
+	}
+
+	event.Data = value
+	return event, nil
+}
+
+// aggregateType extracts the aggregate type from the source attribute, sources
+// set by other producers are kept as they are
+func (c *Codec) aggregateType(source string) string {
+	if strings.HasPrefix(source, c.source+"/") {
+		return strings.TrimPrefix(source, c.source+"/")
+	}
+
+	return source
+}
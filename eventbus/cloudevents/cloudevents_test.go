@@ -0,0 +1,157 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type AccountCreated struct {
+	Owner string `json:"owner"`
+}
+
+func newCodec(mode Mode, options ...Option) *Codec {
+	c := NewCodec(mode, options...)
+	c.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	return c
+}
+
+func newEvent() eventhus.Event {
+	return eventhus.Event{
+		ID:            "e-1",
+		AggregateID:   "account-1",
+		AggregateType: "Account",
+		Version:       3,
+		Type:          "AccountCreated",
+		Data:          &AccountCreated{Owner: "mishudark"},
+		Metadata:      map[string]string{"traceid": "t-1"},
+	}
+}
+
+func assertEvent(t *testing.T, expected, got eventhus.Event) {
+	t.Helper()
+
+	if got.ID != expected.ID || got.AggregateID != expected.AggregateID ||
+		got.AggregateType != expected.AggregateType || got.Version != expected.Version || got.Type != expected.Type {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	data, ok := got.Data.(*AccountCreated)
+	if !ok || data.Owner != expected.Data.(*AccountCreated).Owner {
+		t.Errorf("expected %+v, got %+v", expected.Data, got.Data)
+	}
+
+	if got.Metadata["traceid"] != "t-1" || len(got.Metadata) != 1 {
+		t.Errorf("expected %v, got %v", expected.Metadata, got.Metadata)
+	}
+}
+
+func TestStructured(t *testing.T) {
+	eventhus.NewEventRegister().Set(AccountCreated{})
+	codec := newCodec(Structured, WithSource("/bank"), WithTypePrefix("com.example."))
+
+	msg, err := codec.Encode(newEvent(), "bank", "account")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if msg.ContentType != ContentType || len(msg.Header) != 0 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal(msg.Body, &fields); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	expected := map[string]string{
+		"specversion":     "1.0",
+		"id":              "e-1",
+		"source":          "/bank/Account",
+		"subject":         "account-1",
+		"type":            "com.example.AccountCreated",
+		"time":            "2020-01-02T03:04:05Z",
+		"datacontenttype": "application/json",
+		"traceid":         "t-1",
+	}
+
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("expected %s %q, got %v", key, value, fields[key])
+		}
+	}
+
+	event, err := codec.Decode(msg, eventhus.NewEventRegister())
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	assertEvent(t, newEvent(), event)
+
+	// transports without content type
+	event, err = codec.Decode(eventhus.Message{Body: msg.Body}, eventhus.NewEventRegister())
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	assertEvent(t, newEvent(), event)
+}
+
+func TestBinary(t *testing.T) {
+	eventhus.NewEventRegister().Set(AccountCreated{})
+	codec := newCodec(Binary)
+
+	msg, err := codec.Encode(newEvent(), "bank", "account")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if msg.ContentType != eventhus.JSONContentType {
+		t.Error("expected application/json, got", msg.ContentType)
+	}
+
+	if msg.Header["source"] != "eventhus/Account" || msg.Header["aggregateversion"] != "3" {
+		t.Errorf("unexpected header %v", msg.Header)
+	}
+
+	if string(msg.Body) != `{"owner":"mishudark"}` {
+		t.Errorf("unexpected body %s", msg.Body)
+	}
+
+	event, err := codec.Decode(msg, eventhus.NewEventRegister())
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	assertEvent(t, newEvent(), event)
+}
+
+func TestDecodePlainJSON(t *testing.T) {
+	eventhus.NewEventRegister().Set(AccountCreated{})
+
+	msg, err := eventhus.JSONCodec{}.Encode(newEvent(), "bank", "account")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	event, err := newCodec(Structured).Decode(msg, eventhus.NewEventRegister())
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	assertEvent(t, newEvent(), event)
+}
+
+func TestMetadataClash(t *testing.T) {
+	event := newEvent()
+	event.Metadata = map[string]string{"source": "other"}
+
+	if _, err := newCodec(Binary).Encode(event, "bank", "account"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
@@ -0,0 +1,166 @@
+package eventbus
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/utils"
+)
+
+// ErrMixedTargets is returned by Replay when no target is given and the dead
+// letters belong to several buses
+var ErrMixedTargets = errors.New("the dead letters have several targets, replay them by target")
+
+// AttemptsError is returned by the buses that gave up after several attempts,
+// it wraps the error of the last attempt so it must be compared with errors.Is
+type AttemptsError struct {
+	Err      error
+	Attempts int
+}
+
+func (e *AttemptsError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the last attempt
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// DeadLetterBus decorates an EventBus, the events it fails to publish are saved
+// in the dead letter store so they can be replayed
+type DeadLetterBus struct {
+	bus    eventhus.EventBus
+	store  eventhus.EventDeadLetterStore
+	target string
+	// Swallow returns nil once the event is saved, so the following events
+	// of the aggregate are still published
+	Swallow bool
+}
+
+// NewDeadLetterBus decorates bus, target names it in the dead letters
+func NewDeadLetterBus(bus eventhus.EventBus, store eventhus.EventDeadLetterStore, target string) *DeadLetterBus {
+	return &DeadLetterBus{
+		bus:    bus,
+		store:  store,
+		target: target,
+	}
+}
+
+// Publish an event, it's saved in the store when the bus fails
+func (d *DeadLetterBus) Publish(event eventhus.Event, bucket, subset string) error {
+	err := d.bus.Publish(event, bucket, subset)
+	if err == nil {
+		return nil
+	}
+
+	id, idErr := utils.UUID()
+	if idErr != nil {
+		return err
+	}
+
+	attempts := 1
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		attempts = attemptsErr.Attempts
+	}
+
+	saveErr := d.store.Save(eventhus.EventDeadLetter{
+		ID:       id,
+		Event:    event,
+		Target:   d.target,
+		Bucket:   bucket,
+		Subset:   subset,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	})
+
+	if saveErr != nil || !d.Swallow {
+		return err
+	}
+
+	return nil
+}
+
+// Replay publishes again the dead letters of target with the given ids, all of
+// them when no id is given, and returns how many were replayed
+func Replay(store eventhus.EventDeadLetterStore, bus eventhus.EventBus, target string, ids ...string) (int, error) {
+	letters, err := selectLetters(store, ids)
+	if err != nil {
+		return 0, err
+	}
+
+	if target == "" {
+		for _, letter := range letters {
+			if letter.Target != letters[0].Target {
+				return 0, ErrMixedTargets
+			}
+		}
+	} else {
+		letters = byTarget(letters, target)
+	}
+
+	replayed := 0
+	errs := MultiPublisherError{}
+
+	for _, letter := range letters {
+		if err = bus.Publish(letter.Event, letter.Bucket, letter.Subset); err != nil {
+			errs.Add(err)
+
+			letter.Attempts++
+			letter.Error = err.Error()
+			letter.FailedAt = time.Now()
+
+			if err = store.Save(letter); err != nil {
+				return replayed, err
+			}
+
+			continue
+		}
+
+		if err = store.Remove(letter.ID); err != nil {
+			return replayed, err
+		}
+
+		replayed++
+	}
+
+	if errs.Len() > 0 {
+		return replayed, errs
+	}
+
+	return replayed, nil
+}
+
+func byTarget(letters []eventhus.EventDeadLetter, target string) []eventhus.EventDeadLetter {
+	selected := letters[:0]
+	for _, letter := range letters {
+		if letter.Target == target {
+			selected = append(selected, letter)
+		}
+	}
+
+	return selected
+}
+
+func selectLetters(store eventhus.EventDeadLetterStore, ids []string) ([]eventhus.EventDeadLetter, error) {
+	if len(ids) == 0 {
+		return store.List()
+	}
+
+	letters := make([]eventhus.EventDeadLetter, 0, len(ids))
+	for _, id := range ids {
+		letter, found, err := store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			letters = append(letters, letter)
+		}
+	}
+
+	return letters, nil
+}
@@ -0,0 +1,94 @@
+package eventbus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/deadletterstore/memory"
+)
+
+func TestDeadLetterBus(t *testing.T) {
+	store := memory.NewStore()
+	failing := &producerStub{err: errors.New("expected error")}
+
+	sut := NewDeadLetterBus(NewCircuitBreaker(failing, WithRetries(1), WithBackoff(0, 0)), store, "nats")
+
+	if err := sut.Publish(eventhus.Event{ID: "1"}, "banks", "accounts"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+
+	sut.Swallow = true
+	if err := sut.Publish(eventhus.Event{ID: "2"}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	letters, _ := store.List()
+	if len(letters) != 2 {
+		t.Fatal("expected 2 dead letters, got", len(letters))
+	}
+
+	letter := letters[0]
+	if letter.Event.ID != "1" || letter.Target != "nats" || letter.Bucket != "banks" || letter.Subset != "accounts" {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+
+	if letter.Attempts != 2 || letter.Error != "expected error" {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	store := memory.NewStore()
+	store.Save(eventhus.EventDeadLetter{ID: "a", Event: eventhus.Event{ID: "1"}, Bucket: "banks", Subset: "accounts", Attempts: 1})
+	store.Save(eventhus.EventDeadLetter{ID: "b", Event: eventhus.Event{ID: "2"}, Bucket: "banks", Subset: "accounts", Attempts: 1})
+
+	failing := &producerStub{err: errors.New("expected error")}
+	replayed, err := Replay(store, failing, "", "a")
+	if err == nil || replayed != 0 {
+		t.Errorf("expected an error and 0 replayed, got %v %d", err, replayed)
+	}
+
+	letter, _, _ := store.Get("a")
+	if letter.Attempts != 2 {
+		t.Error("expected 2 attempts, got", letter.Attempts)
+	}
+
+	bus := &producerStub{}
+	replayed, err = Replay(store, bus, "")
+	if err != nil || replayed != 2 {
+		t.Errorf("expected nil and 2 replayed, got %v %d", err, replayed)
+	}
+
+	if len(bus.entries) != 2 || bus.entries[0].bucket != "banks" {
+		t.Errorf("unexpected entries %+v", bus.entries)
+	}
+
+	if letters, _ := store.List(); len(letters) != 0 {
+		t.Error("expected 0 dead letters, got", len(letters))
+	}
+}
+
+func TestReplayByTarget(t *testing.T) {
+	store := memory.NewStore()
+	store.Save(eventhus.EventDeadLetter{ID: "a", Event: eventhus.Event{ID: "1"}, Target: "nats"})
+	store.Save(eventhus.EventDeadLetter{ID: "b", Event: eventhus.Event{ID: "2"}, Target: "kafka"})
+
+	bus := &producerStub{}
+	if _, err := Replay(store, bus, ""); err != ErrMixedTargets {
+		t.Errorf("expected %v, got %v", ErrMixedTargets, err)
+	}
+
+	replayed, err := Replay(store, bus, "kafka")
+	if err != nil || replayed != 1 {
+		t.Errorf("expected nil and 1 replayed, got %v %d", err, replayed)
+	}
+
+	if len(bus.entries) != 1 || bus.entries[0].event.ID != "2" {
+		t.Errorf("unexpected entries %+v", bus.entries)
+	}
+
+	if _, found, _ := store.Get("a"); !found {
+		t.Error("expected the nats dead letter to be kept")
+	}
+}
@@ -1,15 +1,47 @@
 package eventbus
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/mishudark/eventhus"
 )
 
+// ErrPublishTimeout is returned when a publisher doesn't answer on time
+var ErrPublishTimeout = errors.New("timeout publishing the event")
+
+// Policy decides when a MultiPublisher publish succeeds
+type Policy int
+
+const (
+	// AllMustSucceed fails the publish if any publisher fails
+	AllMustSucceed Policy = iota
+	// AtLeastOne fails the publish only if all the publishers fail
+	AtLeastOne
+	// BestEffort never fails the publish, the errors are only reported
+	BestEffort
+)
+
+// PublishFailure is the error of a publisher, Index is its position in the
+// MultiPublisher
+type PublishFailure struct {
+	Index     int
+	Publisher eventhus.EventBus
+	Err       error
+}
+
 // MultiPublisherError is returned from publish when
 // there is an error from a publisher.
 type MultiPublisherError struct {
-	Errors []error
+	Errors   []error
+	Failures []PublishFailure
+	Event    eventhus.Event
+	Bucket   string
+	Subset   string
+	// publish retries through the MultiPublisher that failed, by index
+	publish func(i int, event eventhus.Event, bucket, subset string) error
 }
 
 // Error will produce an error message out of all errors.
@@ -30,34 +62,210 @@ func (e *MultiPublisherError) Add(err error) {
 	}
 }
 
+// addFailure records the error of a publisher
+func (e *MultiPublisherError) addFailure(failure PublishFailure) {
+	e.Add(failure.Err)
+	e.Failures = append(e.Failures, failure)
+}
+
 // Len will return total amount of errors in error slice.
 func (e *MultiPublisherError) Len() int {
 	return len(e.Errors)
 }
 
-// MultiPublisher ...
+// Retry publishes the event again through the failed publishers, the ones that
+// timed out are skipped since they could still deliver it; use RetryAll for them
+func (e MultiPublisherError) Retry() error {
+	return e.retry(false)
+}
+
+// RetryAll is like Retry but publishes through the publishers that timed out
+// too, a consumer can receive the event twice
+func (e MultiPublisherError) RetryAll() error {
+	return e.retry(true)
+}
+
+func (e MultiPublisherError) retry(timeouts bool) error {
+	errs := MultiPublisherError{
+		Event:   e.Event,
+		Bucket:  e.Bucket,
+		Subset:  e.Subset,
+		publish: e.publish,
+	}
+
+	for _, failure := range e.Failures {
+		if failure.Err == ErrPublishTimeout && !timeouts {
+			errs.addFailure(failure)
+			continue
+		}
+
+		var err error
+		if e.publish != nil {
+			err = e.publish(failure.Index, e.Event, e.Bucket, e.Subset)
+		} else {
+			err = failure.Publisher.Publish(e.Event, e.Bucket, e.Subset)
+		}
+
+		if err != nil {
+			failure.Err = err
+			errs.addFailure(failure)
+		}
+	}
+
+	if errs.Len() > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// MultiPublisher sends every event to all the publishers concurrently, every
+// publisher has a single publish in flight so it gets the events in order
 type MultiPublisher struct {
 	publishers []eventhus.EventBus
+	policy     Policy
+	timeout    time.Duration
+	timeouts   map[int]time.Duration
+	onError    func(MultiPublisherError)
+	// slots holds the publish in flight of every publisher
+	slots []chan struct{}
+}
+
+// MultiPublisherOption customizes a MultiPublisher
+type MultiPublisherOption func(*MultiPublisher)
+
+// WithPolicy sets when a publish succeeds, AllMustSucceed by default
+func WithPolicy(policy Policy) MultiPublisherOption {
+	return func(m *MultiPublisher) {
+		m.policy = policy
+	}
+}
+
+// WithTimeout sets how long to wait for every publisher, each one has its own
+// deadline; zero waits forever
+func WithTimeout(timeout time.Duration) MultiPublisherOption {
+	return func(m *MultiPublisher) {
+		m.timeout = timeout
+	}
 }
 
-// NewMultiPublisher ...
+// WithPublisherTimeout overrides the timeout of the publisher at index
+func WithPublisherTimeout(index int, timeout time.Duration) MultiPublisherOption {
+	return func(m *MultiPublisher) {
+		m.timeouts[index] = timeout
+	}
+}
+
+// WithErrorHandler is called with the errors the policy doesn't return
+func WithErrorHandler(handler func(MultiPublisherError)) MultiPublisherOption {
+	return func(m *MultiPublisher) {
+		m.onError = handler
+	}
+}
+
+// NewMultiPublisher returns a publisher that sends the events to all
 func NewMultiPublisher(all ...eventhus.EventBus) *MultiPublisher {
+	slots := make([]chan struct{}, len(all))
+	for i := range slots {
+		slots[i] = make(chan struct{}, 1)
+	}
+
 	return &MultiPublisher{
 		publishers: all,
+		timeouts:   make(map[int]time.Duration),
+		slots:      slots,
 	}
 }
 
+// NewMultiPublisherWithOptions returns a publisher that sends the events to
+// publishers, customized with options
+func NewMultiPublisherWithOptions(publishers []eventhus.EventBus, options ...MultiPublisherOption) *MultiPublisher {
+	m := NewMultiPublisher(publishers...)
+	for _, opt := range options {
+		opt(m)
+	}
+
+	return m
+}
+
 // Publish an event through all registered publishers.
 func (c MultiPublisher) Publish(event eventhus.Event, bucket, subset string) error {
-	errs := MultiPublisherError{}
+	results := make([]error, len(c.publishers))
 
-	for _, p := range c.publishers {
-		errs.Add(p.Publish(event, bucket, subset))
+	var wg sync.WaitGroup
+	for i := range c.publishers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.publish(i, event, bucket, subset)
+		}(i)
 	}
+	wg.Wait()
 
-	if errs.Len() > 0 {
+	errs := MultiPublisherError{
+		Event:   event,
+		Bucket:  bucket,
+		Subset:  subset,
+		publish: c.publish,
+	}
+
+	for i, err := range results {
+		if err != nil {
+			errs.addFailure(PublishFailure{
+				Index:     i,
+				Publisher: c.publishers[i],
+				Err:       err,
+			})
+		}
+	}
+
+	if errs.Len() == 0 {
+		return nil
+	}
+
+	if c.policy == AllMustSucceed || c.policy == AtLeastOne && errs.Len() == len(c.publishers) {
 		return errs
 	}
 
+	if c.onError != nil {
+		c.onError(errs)
+	}
+
 	return nil
 }
+
+// publish an event through the publisher at index i within its timeout, a
+// publisher that doesn't answer keeps its slot
+func (c MultiPublisher) publish(i int, event eventhus.Event, bucket, subset string) error {
+	timeout, ok := c.timeouts[i]
+	if !ok {
+		timeout = c.timeout
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case c.slots[i] <- struct{}{}:
+	case <-expired:
+		return ErrPublishTimeout
+	}
+
+	// buffered, a publisher that times out must not block
+	result := make(chan error, 1)
+	go func() {
+		defer func() { <-c.slots[i] }()
+		result <- c.publishers[i].Publish(event, bucket, subset)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-expired:
+		return ErrPublishTimeout
+	}
+}
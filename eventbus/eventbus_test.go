@@ -2,7 +2,9 @@ package eventbus
 
 import (
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mishudark/eventhus"
 )
@@ -14,11 +16,15 @@ type producerStubEntry struct {
 }
 
 type producerStub struct {
+	mu      sync.Mutex
 	entries []producerStubEntry
 	err     error
 }
 
 func (s *producerStub) Publish(event eventhus.Event, bucket, subset string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.entries = append(s.entries, producerStubEntry{
 		event:  event,
 		bucket: bucket,
@@ -98,3 +104,197 @@ func Test_NewMultiPublisher_AggregatesErrors(t *testing.T) {
 		t.Error("error length was expected to be 2 got:", err.Len())
 	}
 }
+
+type slowStub struct {
+	delay time.Duration
+}
+
+func (s slowStub) Publish(event eventhus.Event, bucket, subset string) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func Test_MultiPublisher_Policies(t *testing.T) {
+	ok := &producerStub{}
+	failing := &producerStub{err: errors.New("expected error")}
+
+	var reported []MultiPublisherError
+	onError := WithErrorHandler(func(err MultiPublisherError) {
+		reported = append(reported, err)
+	})
+
+	atLeastOne := NewMultiPublisherWithOptions([]eventhus.EventBus{ok, failing}, WithPolicy(AtLeastOne), onError)
+	if err := atLeastOne.Publish(eventhus.Event{}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	allFailing := NewMultiPublisherWithOptions([]eventhus.EventBus{failing, failing}, WithPolicy(AtLeastOne), onError)
+	if err := allFailing.Publish(eventhus.Event{}, "banks", "accounts"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+
+	bestEffort := NewMultiPublisherWithOptions([]eventhus.EventBus{failing, failing}, WithPolicy(BestEffort), onError)
+	if err := bestEffort.Publish(eventhus.Event{}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(reported) != 2 {
+		t.Fatal("expected 2 reported errors, got", len(reported))
+	}
+
+	if reported[1].Len() != 2 {
+		t.Error("expected 2 errors, got", reported[1].Len())
+	}
+}
+
+func Test_MultiPublisher_Timeout(t *testing.T) {
+	sut := NewMultiPublisherWithOptions([]eventhus.EventBus{
+		slowStub{time.Second}, &producerStub{}, slowStub{time.Second},
+	}, WithTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	aerr := sut.Publish(eventhus.Event{}, "banks", "accounts")
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("the publishers were not called concurrently")
+	}
+
+	err, ok := aerr.(MultiPublisherError)
+	if !ok {
+		t.Fatal("error was expected to be type MultiPublisherError")
+	}
+
+	if len(err.Failures) != 2 || err.Failures[0].Index != 0 || err.Failures[1].Index != 2 {
+		t.Errorf("unexpected failures %+v", err.Failures)
+	}
+
+	if err.Failures[0].Err != ErrPublishTimeout {
+		t.Errorf("expected %v, got %v", ErrPublishTimeout, err.Failures[0].Err)
+	}
+}
+
+func Test_MultiPublisherError_Retry(t *testing.T) {
+	producerOne := &producerStub{}
+	producerTwo := &producerStub{err: errors.New("expected error")}
+	sut := NewMultiPublisher(producerOne, producerTwo)
+
+	aerr := sut.Publish(eventhus.Event{ID: "1"}, "banks", "accounts")
+	err, ok := aerr.(MultiPublisherError)
+	if !ok {
+		t.Fatal("error was expected to be type MultiPublisherError")
+	}
+
+	if err.Failures[0].Publisher != producerTwo {
+		t.Error("expected the second publisher to fail")
+	}
+
+	producerTwo.err = nil
+	if err := err.Retry(); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(producerOne.entries) != 1 || len(producerTwo.entries) != 2 {
+		t.Error("expected the event to be published again only to the failed publisher")
+	}
+
+	if producerTwo.entries[1].event.ID != "1" || producerTwo.entries[1].bucket != "banks" {
+		t.Errorf("unexpected entry %+v", producerTwo.entries[1])
+	}
+}
+
+// blockingStub holds every publish until release is closed
+type blockingStub struct {
+	producerStub
+	release chan struct{}
+	calls   chan struct{}
+}
+
+func (s *blockingStub) Publish(event eventhus.Event, bucket, subset string) error {
+	s.calls <- struct{}{}
+	<-s.release
+	return s.producerStub.Publish(event, bucket, subset)
+}
+
+func Test_MultiPublisher_PublisherTimeout(t *testing.T) {
+	sut := NewMultiPublisherWithOptions([]eventhus.EventBus{
+		slowStub{50 * time.Millisecond}, slowStub{50 * time.Millisecond},
+	}, WithTimeout(time.Second), WithPublisherTimeout(1, 10*time.Millisecond))
+
+	err, ok := sut.Publish(eventhus.Event{}, "banks", "accounts").(MultiPublisherError)
+	if !ok || len(err.Failures) != 1 || err.Failures[0].Index != 1 {
+		t.Errorf("expected only the second publisher to time out, got %+v", err)
+	}
+}
+
+func Test_MultiPublisher_SinglePublishInFlight(t *testing.T) {
+	stuck := &blockingStub{release: make(chan struct{}), calls: make(chan struct{}, 10)}
+	sut := NewMultiPublisherWithOptions([]eventhus.EventBus{stuck}, WithTimeout(10*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if err := sut.Publish(eventhus.Event{Version: i}, "banks", "accounts"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	}
+
+	// the next events waited for the stuck publish instead of starting new ones
+	if len(stuck.calls) != 1 {
+		t.Error("expected 1 publish in flight, got", len(stuck.calls))
+	}
+
+	close(stuck.release)
+	time.Sleep(10 * time.Millisecond)
+
+	if err := sut.Publish(eventhus.Event{Version: 3}, "banks", "accounts"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(stuck.entries) != 2 || stuck.entries[0].event.Version != 0 || stuck.entries[1].event.Version != 3 {
+		t.Errorf("expected the events 0 and 3 in order, got %+v", stuck.entries)
+	}
+}
+
+func Test_MultiPublisherError_RetryWaitsForThePublishInFlight(t *testing.T) {
+	stuck := &blockingStub{release: make(chan struct{}), calls: make(chan struct{}, 10)}
+	sut := NewMultiPublisherWithOptions([]eventhus.EventBus{stuck}, WithTimeout(10*time.Millisecond))
+
+	err, ok := sut.Publish(eventhus.Event{Version: 0}, "banks", "accounts").(MultiPublisherError)
+	if !ok {
+		t.Fatal("error was expected to be type MultiPublisherError")
+	}
+
+	// the retry waits for the stuck publish instead of overtaking it
+	if err := err.RetryAll(); err == nil {
+		t.Error("expected an error, got nil")
+	}
+
+	if len(stuck.calls) != 1 {
+		t.Error("expected 1 publish in flight, got", len(stuck.calls))
+	}
+
+	close(stuck.release)
+}
+
+func Test_MultiPublisherError_RetrySkipsTimeouts(t *testing.T) {
+	late := &producerStub{}
+	failing := &producerStub{}
+	err := MultiPublisherError{Event: eventhus.Event{ID: "1"}}
+	err.addFailure(PublishFailure{Index: 0, Publisher: late, Err: ErrPublishTimeout})
+	err.addFailure(PublishFailure{Index: 1, Publisher: failing, Err: errors.New("expected error")})
+
+	retryErr, ok := err.Retry().(MultiPublisherError)
+	if !ok || len(retryErr.Failures) != 1 || retryErr.Failures[0].Err != ErrPublishTimeout {
+		t.Errorf("expected the timeout to be kept, got %v", retryErr)
+	}
+
+	if len(late.entries) != 0 || len(failing.entries) != 1 {
+		t.Errorf("expected only the failed publisher to be retried, got %d and %d", len(late.entries), len(failing.entries))
+	}
+
+	if err := err.RetryAll(); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(late.entries) != 1 {
+		t.Error("expected the timed out publisher to be retried, got", len(late.entries))
+	}
+}
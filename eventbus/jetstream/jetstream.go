@@ -0,0 +1,317 @@
+package jetstream
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ErrNoSubjects the stream needs at least one subject
+var ErrNoSubjects = errors.New("the stream needs at least one subject")
+
+// Default settings of the stream and consumers
+const (
+	DefaultDuplicates = 2 * time.Minute
+	DefaultAckWait    = 30 * time.Second
+	DefaultMaxDeliver = 10
+	DefaultRetryDelay = time.Second
+)
+
+// Config of the stream that stores the events and the consumers created by Subscribe
+type Config struct {
+	// Stream is the name of the stream, it's created if missing
+	Stream string
+	// Subjects captured by the stream, the events are published to `bucket.subset`
+	// so `bank.*` captures all the subsets of the bank bucket
+	Subjects []string
+	// Duplicates is the window in which events with the same ID are discarded
+	Duplicates time.Duration
+	// Durable prefixes the name of the consumers created by Subscribe
+	Durable string
+	// AckWait is the time to wait for an ack before redelivering an event
+	AckWait time.Duration
+	// MaxDeliver is the max quantity of deliveries of an event
+	MaxDeliver int
+	// RetryDelay is the wait before a failed event is redelivered, it should be
+	// shorter than AckWait
+	RetryDelay time.Duration
+	// OnError is notified when an event can't be decoded or the handler fails,
+	// the errors are logged by default
+	OnError func(error)
+	// Codec encodes the events, eventhus.JSONCodec by default
+	Codec eventhus.EventCodec
+	// Router computes the subjects, DefaultRouter by default
+	Router eventhus.Router
+}
+
+// DefaultRouter publishes the events to the subject `bucket.subset`
+var DefaultRouter = eventhus.MustTopicTemplate("{bucket}.{subset}")
+
+// Wildcard matches a token of a subject
+const Wildcard = "*"
+
+// headerPrefix is prepended to the names of the message header, following the
+// CloudEvents nats binding
+const headerPrefix = "ce-"
+
+// contentTypeHeader holds the content type of the messages
+const contentTypeHeader = "Content-Type"
+
+// Client publishes the events into a JetStream stream, they are kept
+// until the durable consumers acknowledge them
+type Client struct {
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	config Config
+}
+
+// NewClient connects to nats and creates the stream if it doesn't exist
+func NewClient(urls string, config Config, options ...nats.Option) (*Client, error) {
+	if len(config.Subjects) == 0 {
+		return nil, ErrNoSubjects
+	}
+
+	if config.Duplicates == 0 {
+		config.Duplicates = DefaultDuplicates
+	}
+
+	if config.AckWait == 0 {
+		config.AckWait = DefaultAckWait
+	}
+
+	if config.MaxDeliver == 0 {
+		config.MaxDeliver = DefaultMaxDeliver
+	}
+
+	if config.RetryDelay == 0 {
+		config.RetryDelay = DefaultRetryDelay
+	}
+
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.Println("jetstream: subscription failed:", err)
+		}
+	}
+
+	if config.Durable == "" {
+		config.Durable = config.Stream
+	}
+
+	if config.Codec == nil {
+		config.Codec = eventhus.JSONCodec{}
+	}
+
+	if config.Router == nil {
+		config.Router = DefaultRouter
+	}
+
+	conn, err := nats.Connect(urls, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		conn:   conn,
+		js:     js,
+		config: config,
+	}
+
+	if err = c.ensureStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) ensureStream() error {
+	cfg := &nats.StreamConfig{
+		Name:       c.config.Stream,
+		Subjects:   c.config.Subjects,
+		Storage:    nats.FileStorage,
+		Duplicates: c.config.Duplicates,
+	}
+
+	if _, err := c.js.StreamInfo(c.config.Stream); err == nil {
+		_, err = c.js.UpdateStream(cfg)
+		return err
+	}
+
+	_, err := c.js.AddStream(cfg)
+	return err
+}
+
+// Close the connection
+func (c *Client) Close() error {
+	c.conn.Close()
+	return nil
+}
+
+// MsgID returns the id used to discard duplicated events, the event ID or the
+// aggregate ID and version when the event doesn't have one
+func MsgID(event eventhus.Event) string {
+	if event.ID != "" {
+		return event.ID
+	}
+
+	return fmt.Sprintf("%s:%d", event.AggregateID, event.Version)
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.config.Codec = codec
+}
+
+// SetRouter sets how the subjects of the events are computed, the stream
+// subjects must capture them
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.config.Router = router
+}
+
+// Publish a event, it returns once the stream stored it
+func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	msg, err := c.config.Codec.Encode(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	subj, err := c.config.Router.Route(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	m := nats.NewMsg(subj)
+	m.Data = msg.Body
+	m.Header.Set(contentTypeHeader, msg.ContentType)
+
+	for key, value := range msg.Header {
+		m.Header.Set(headerPrefix+key, value)
+	}
+
+	_, err = c.js.PublishMsg(m, nats.MsgId(MsgID(event)))
+	return err
+}
+
+// message converts a nats message to the one decoded by the codec
+func message(msg *nats.Msg) eventhus.Message {
+	m := eventhus.Message{
+		Body:        msg.Data,
+		ContentType: msg.Header.Get(contentTypeHeader),
+	}
+
+	for key := range msg.Header {
+		// the names are canonicalized by the header
+		if strings.HasPrefix(strings.ToLower(key), headerPrefix) {
+			if m.Header == nil {
+				m.Header = make(map[string]string)
+			}
+			m.Header[strings.ToLower(key[len(headerPrefix):])] = msg.Header.Get(key)
+		}
+	}
+
+	return m
+}
+
+// Subscribe to the events published to bucket and subset with a durable consumer
+// named after the configured prefix, bucket and subset
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.SubscribeDurable(durableName(c.config.Durable, bucket, subset), bucket, subset, handler)
+}
+
+// SubscribeDurable subscribes with the durable consumer, the failed events are
+// redelivered up to MaxDeliver times
+func (c *Client) SubscribeDurable(durable, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	subj, err := c.config.Router.Pattern(bucket, subset, Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(durable, subj, "", handler)
+}
+
+// SubscribeGroup joins the group, its members share a durable consumer
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	subj, err := c.config.Router.Pattern(bucket, subset, Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(durableName(group, bucket, subset), subj, group, handler)
+}
+
+// SubscribeTopic subscribes to a subject with a durable consumer named after the
+// configured prefix and the subject, it can contain wildcards
+func (c *Client) SubscribeTopic(subj string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe(durableName(c.config.Durable, subj), subj, "", handler)
+}
+
+// subscribe with the durable consumer, the subscriptions sharing a non empty
+// group take turns
+func (c *Client) subscribe(durable, subj, group string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	register := eventhus.NewEventRegister()
+
+	sub, err := c.js.QueueSubscribe(subj, group, func(msg *nats.Msg) {
+		event, err := c.config.Codec.Decode(message(msg), register)
+		if err != nil {
+			msg.Term()
+			c.config.OnError(fmt.Errorf("decode message of %s: %w", msg.Subject, err))
+			return
+		}
+
+		if err = handler.Handle(event); err != nil {
+			// the client has no delayed nak, the event stays unacked until
+			// the delay elapses
+			time.AfterFunc(c.config.RetryDelay, func() { msg.Nak() })
+
+			if md, mdErr := msg.Metadata(); mdErr == nil && int(md.NumDelivered) >= c.config.MaxDeliver {
+				err = &eventbus.AttemptsError{Err: err, Attempts: int(md.NumDelivered)}
+			}
+
+			c.config.OnError(fmt.Errorf("handle event %s of %s: %w", event.ID, msg.Subject, err))
+			return
+		}
+
+		msg.Ack()
+	},
+		nats.Durable(durable),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.DeliverAll(),
+		nats.AckWait(c.config.AckWait),
+		nats.MaxDeliver(c.config.MaxDeliver),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription{sub}, nil
+}
+
+// durableName joins the parts, durable names can't contain dots nor wildcards
+func durableName(parts ...string) string {
+	return strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(strings.Join(parts, "-"))
+}
+
+type subscription struct {
+	sub *nats.Subscription
+}
+
+// Close stops the delivery, the durable consumer keeps its position,
+// Unsubscribe would delete it
+func (s *subscription) Close() error {
+	return s.sub.Drain()
+}
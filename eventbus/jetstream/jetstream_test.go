@@ -0,0 +1,303 @@
+package jetstream
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+	"github.com/mishudark/eventhus/eventbus/cloudevents"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+type ItemAdded struct {
+	SKU string `json:"sku"`
+}
+
+func runServer(t *testing.T) (*server.Server, func()) {
+	dir, err := ioutil.TempDir("", "jetstream")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  dir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("the server is not ready")
+	}
+
+	return s, func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func newClient(t *testing.T, s *server.Server, options ...func(*Config)) *Client {
+	config := Config{
+		Stream:     "shop",
+		Subjects:   []string{"shop.*"},
+		AckWait:    100 * time.Millisecond,
+		MaxDeliver: 3,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	cli, err := NewClient(s.ClientURL(), config)
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return cli
+}
+
+func TestNewClientRequiresSubjects(t *testing.T) {
+	if _, err := NewClient("nats://127.0.0.1:4222", Config{Stream: "shop"}); err != ErrNoSubjects {
+		t.Error("expected ErrNoSubjects, got", err)
+	}
+}
+
+func TestClientPublishDeduplicates(t *testing.T) {
+	s, stop := runServer(t)
+	defer stop()
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	event := eventhus.Event{AggregateID: "1", Version: 1, Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	for i := 0; i < 2; i++ {
+		if err := cli.Publish(event, "shop", "cart"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	info, err := cli.js.StreamInfo("shop")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if info.State.Msgs != 1 {
+		t.Error("expected 1 message, got", info.State.Msgs)
+	}
+}
+
+func TestClientSubscribeRedelivers(t *testing.T) {
+	s, stop := runServer(t)
+	defer stop()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	var mu sync.Mutex
+	deliveries := 0
+	done := make(chan bool, 1)
+
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		deliveries++
+		if deliveries < 2 {
+			return errors.New("read model unavailable")
+		}
+
+		done <- true
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	event := eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the event was not redelivered")
+	}
+}
+
+func TestClientCloudEvents(t *testing.T) {
+	s, stop := runServer(t)
+	defer stop()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	cli.SetCodec(cloudevents.NewCodec(cloudevents.Binary))
+
+	received := make(chan eventhus.Event, 1)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	event := eventhus.Event{
+		ID:            "1",
+		AggregateID:   "cart-1",
+		AggregateType: "Cart",
+		Type:          "ItemAdded",
+		Data:          &ItemAdded{SKU: "123"},
+		Metadata:      map[string]string{"tenant": "acme"},
+	}
+
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	select {
+	case e := <-received:
+		if e.AggregateID != "cart-1" || e.AggregateType != "Cart" || e.Metadata["tenant"] != "acme" {
+			t.Errorf("unexpected event %+v", e)
+		}
+
+		if data, ok := e.Data.(*ItemAdded); !ok || data.SKU != "123" {
+			t.Errorf("unexpected data %+v", e.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the event was not received")
+	}
+}
+
+func TestClientSubscribeGroup(t *testing.T) {
+	s, stop := runServer(t)
+	defer stop()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	received := make(chan string, 10)
+	for i := 0; i < 2; i++ {
+		sub, err := cli.SubscribeGroup("projection", "shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+			received <- event.ID
+			return nil
+		}))
+
+		if err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+		defer sub.Close()
+	}
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if err := cli.Publish(eventhus.Event{ID: id, Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		select {
+		case id := <-received:
+			if seen[id] {
+				t.Error("the event was delivered twice", id)
+			}
+			seen[id] = true
+		case <-time.After(3 * time.Second):
+			t.Fatal("the events were not received")
+		}
+	}
+
+	select {
+	case id := <-received:
+		t.Error("unexpected delivery", id)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestClientReportsSubscriptionErrors(t *testing.T) {
+	s, stop := runServer(t)
+	defer stop()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	reported := make(chan error, 10)
+	cli := newClient(t, s, func(config *Config) {
+		config.AckWait = time.Second
+		config.RetryDelay = 50 * time.Millisecond
+		config.OnError = func(err error) { reported <- err }
+	})
+	defer cli.Close()
+
+	var mu sync.Mutex
+	var deliveries []time.Time
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		deliveries = append(deliveries, time.Now())
+		return errors.New("read model unavailable")
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	if err = cli.conn.Publish("shop.cart", []byte("not json")); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if err = cli.Publish(eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// the undecodable message and the 3 deliveries of the event
+	var attemptsErr *eventbus.AttemptsError
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-reported:
+			errors.As(err, &attemptsErr)
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected 4 errors, got", i)
+		}
+	}
+
+	if attemptsErr == nil || attemptsErr.Attempts != 3 {
+		t.Errorf("expected the last delivery to be reported with 3 attempts, got %v", attemptsErr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 1; i < len(deliveries); i++ {
+		if wait := deliveries[i].Sub(deliveries[i-1]); wait < 50*time.Millisecond {
+			t.Error("expected the redelivery to wait the retry delay, got", wait)
+		}
+	}
+}
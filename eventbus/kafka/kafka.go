@@ -0,0 +1,410 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+)
+
+// DefaultGroup is the consumer group used by Subscribe
+const DefaultGroup = "eventhus"
+
+// headerPrefix is prepended to the names of the message header, following the
+// CloudEvents kafka binding
+const headerPrefix = "ce_"
+
+// contentTypeHeader holds the content type of the messages
+const contentTypeHeader = "content-type"
+
+// RetryInterval is the default wait before calling a failed handler again
+const RetryInterval = time.Second
+
+// DefaultMaxAttempts is the default quantity of times an event is handled
+// before it's skipped
+const DefaultMaxAttempts = 10
+
+// Client kafka, the events are keyed by aggregate ID so they keep their order
+type Client struct {
+	brokers  []string
+	config   *sarama.Config
+	group    string
+	producer sarama.SyncProducer
+	codec    eventhus.EventCodec
+	router   eventhus.Router
+	retry    time.Duration
+	attempts int
+	onError  func(error)
+}
+
+// DefaultRouter publishes the events to the topic `bucket.subset`
+var DefaultRouter = eventhus.MustTopicTemplate("{bucket}.{subset}")
+
+// Option customizes the kafka client
+type Option func(*Client)
+
+// WithGroup sets the consumer group used by Subscribe
+func WithGroup(group string) Option {
+	return func(c *Client) {
+		c.group = group
+	}
+}
+
+// WithCodec sets how the events are encoded
+func WithCodec(codec eventhus.EventCodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithRouter sets how the topics of the events are computed, kafka has no
+// wildcards so Subscribe fails with the templates that depend on the event
+func WithRouter(router eventhus.Router) Option {
+	return func(c *Client) {
+		c.router = router
+	}
+}
+
+// WithRetryInterval sets the wait before calling a failed handler again
+func WithRetryInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.retry = interval
+	}
+}
+
+// WithMaxAttempts sets how many times an event is handled before it's reported
+// and skipped, so it doesn't block its partition; zero never skips it
+func WithMaxAttempts(attempts int) Option {
+	return func(c *Client) {
+		c.attempts = attempts
+	}
+}
+
+// WithErrorHandler sets the func notified when a subscription fails, the errors
+// are logged by default
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.onError = handler
+	}
+}
+
+// WithVersion sets the kafka version of the cluster, it should be at least 0.11
+// for the idempotent producer
+func WithVersion(version sarama.KafkaVersion) Option {
+	return func(c *Client) {
+		c.config.Version = version
+	}
+}
+
+// WithConfig customizes the sarama config
+func WithConfig(fn func(*sarama.Config)) Option {
+	return func(c *Client) {
+		fn(c.config)
+	}
+}
+
+// NewConfig returns the sarama config used by the client
+func NewConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_0_0_0
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = 5
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Net.MaxOpenRequests = 1
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	return config
+}
+
+// NewClient returns a client connected to the brokers
+func NewClient(brokers []string, options ...Option) (*Client, error) {
+	c := &Client{
+		brokers:  brokers,
+		config:   NewConfig(),
+		group:    DefaultGroup,
+		codec:    eventhus.JSONCodec{},
+		router:   DefaultRouter,
+		retry:    RetryInterval,
+		attempts: DefaultMaxAttempts,
+		onError: func(err error) {
+			log.Println("kafka: subscription failed:", err)
+		},
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	producer, err := sarama.NewSyncProducer(brokers, c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	c.producer = producer
+	return c, nil
+}
+
+// Close the producer
+func (c *Client) Close() error {
+	return c.producer.Close()
+}
+
+// Topic returns the topic of a bucket and subset with the DefaultRouter
+func Topic(bucket, subset string) string {
+	return bucket + "." + subset
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// SetRouter sets how the topics of the events are computed
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.router = router
+}
+
+// Publish a event, it returns once the brokers acknowledged it
+func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	msg, err := c.message(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = c.producer.SendMessage(msg)
+	return err
+}
+
+// PublishBatch sends the events in a single produce request, it returns once
+// the brokers acknowledged all of them
+func (c *Client) PublishBatch(events []eventhus.BatchEvent) error {
+	msgs := make([]*sarama.ProducerMessage, len(events))
+	for i, e := range events {
+		msg, err := c.message(e.Event, e.Bucket, e.Subset)
+		if err != nil {
+			return err
+		}
+
+		// the index finds the event of a failed message
+		msg.Metadata = i
+		msgs[i] = msg
+	}
+
+	err := c.producer.SendMessages(msgs)
+
+	// only the failed messages are reported, the others were delivered
+	var errs sarama.ProducerErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	failedAt := make(map[int]bool, len(errs))
+	for _, e := range errs {
+		if i, ok := e.Msg.Metadata.(int); ok {
+			failedAt[i] = true
+		}
+	}
+
+	// the failed events keep the order of the batch
+	failed := make([]eventhus.BatchEvent, 0, len(errs))
+	for i, e := range events {
+		if failedAt[i] {
+			failed = append(failed, e)
+		}
+	}
+
+	return &eventbus.BatchError{Events: failed, Err: err}
+}
+
+// message encodes an event as a kafka message, keyed by aggregate so the
+// events of an aggregate keep their order
+func (c *Client) message(event eventhus.Event, bucket, subset string) (*sarama.ProducerMessage, error) {
+	msg, err := c.codec.Encode(event, bucket, subset)
+	if err != nil {
+		return nil, err
+	}
+
+	topic, err := c.router.Route(event, bucket, subset)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []sarama.RecordHeader{
+		{Key: []byte(contentTypeHeader), Value: []byte(msg.ContentType)},
+	}
+
+	for key, value := range msg.Header {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(headerPrefix + key), Value: []byte(value)})
+	}
+
+	return &sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.StringEncoder(event.AggregateID),
+		Value:   sarama.ByteEncoder(msg.Body),
+		Headers: headers,
+	}, nil
+}
+
+// message converts a kafka message to the one decoded by the codec
+func message(msg *sarama.ConsumerMessage) eventhus.Message {
+	m := eventhus.Message{
+		Body: msg.Value,
+	}
+
+	for _, header := range msg.Headers {
+		key := string(header.Key)
+
+		switch {
+		case key == contentTypeHeader:
+			m.ContentType = string(header.Value)
+		case strings.HasPrefix(key, headerPrefix):
+			if m.Header == nil {
+				m.Header = make(map[string]string)
+			}
+			m.Header[key[len(headerPrefix):]] = string(header.Value)
+		}
+	}
+
+	return m
+}
+
+// Subscribe to the events published to bucket and subset as part of the consumer
+// group, the offset is committed once the handler succeeds
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	topic, err := c.router.Pattern(bucket, subset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SubscribeTopic(topic, handler)
+}
+
+// SubscribeGroup joins the consumer group, the partitions are shared among its
+// members
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	topic, err := c.router.Pattern(bucket, subset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(group, topic, handler)
+}
+
+// SubscribeTopic subscribes to a topic as part of the consumer group
+func (c *Client) SubscribeTopic(topic string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe(c.group, topic, handler)
+}
+
+func (c *Client) subscribe(name, topic string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	group, err := sarama.NewConsumerGroup(c.brokers, name, c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{
+		group:  group,
+		cancel: cancel,
+	}
+
+	consumer := &consumer{
+		handler:  handler,
+		register: eventhus.NewEventRegister(),
+		codec:    c.codec,
+		retry:    c.retry,
+		attempts: c.attempts,
+		onError:  c.onError,
+	}
+
+	topics := []string{topic}
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+
+		// Consume returns on every rebalance
+		for ctx.Err() == nil {
+			if err := group.Consume(ctx, topics, consumer); err != nil {
+				c.onError(fmt.Errorf("consume %s: %w", topic, err))
+				time.Sleep(c.retry)
+			}
+		}
+	}()
+
+	return sub, nil
+}
+
+type subscription struct {
+	group  sarama.ConsumerGroup
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Close leaves the consumer group
+func (s *subscription) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return s.group.Close()
+}
+
+// consumer implements sarama.ConsumerGroupHandler
+type consumer struct {
+	handler  eventhus.EventHandle
+	register eventhus.EventTypeRegister
+	codec    eventhus.EventCodec
+	retry    time.Duration
+	attempts int
+	onError  func(error)
+}
+
+// Setup is run at the beginning of a new session
+func (c *consumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a session
+func (c *consumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim handles the messages of a partition in order
+func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		event, err := c.codec.Decode(message(msg), c.register)
+		if err != nil {
+			// it will never be decoded, skip it
+			c.onError(fmt.Errorf("decode message of %s: %w", msg.Topic, err))
+			session.MarkMessage(msg, "")
+			continue
+		}
+
+		for attempts := 1; ; attempts++ {
+			if err = c.handler.Handle(event); err == nil {
+				break
+			}
+
+			if c.attempts > 0 && attempts >= c.attempts {
+				c.onError(fmt.Errorf("handle event %s of %s: %w", event.ID, msg.Topic, &eventbus.AttemptsError{Err: err, Attempts: attempts}))
+				break
+			}
+
+			// the message is not marked, it's delivered again after a rebalance
+			select {
+			case <-session.Context().Done():
+				return nil
+			case <-time.After(c.retry):
+			}
+		}
+
+		session.MarkMessage(msg, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+)
+
+type ItemAdded struct {
+	SKU string `json:"sku"`
+}
+
+type producerStub struct {
+	sarama.SyncProducer
+	messages []*sarama.ProducerMessage
+	// fail holds the indexes of the messages that fail in SendMessages
+	fail []int
+}
+
+func (p *producerStub) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, i := range p.fail {
+		errs = append(errs, &sarama.ProducerError{Msg: msgs[i], Err: sarama.ErrNotEnoughReplicas})
+	}
+
+	p.messages = append(p.messages, msgs...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *producerStub) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.messages = append(p.messages, msg)
+	return 0, int64(len(p.messages)), nil
+}
+
+type sessionStub struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *sessionStub) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *sessionStub) Context() context.Context {
+	return s.ctx
+}
+
+type claimStub struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *claimStub) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func TestNewConfig(t *testing.T) {
+	if err := NewConfig().Validate(); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestClientPublish(t *testing.T) {
+	producer := &producerStub{}
+	cli := &Client{producer: producer, codec: eventhus.JSONCodec{}, router: DefaultRouter}
+
+	event := eventhus.Event{AggregateID: "cart-1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	if err := cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	msg := producer.messages[0]
+	key, _ := msg.Key.Encode()
+	if msg.Topic != "shop.cart" || string(key) != "cart-1" {
+		t.Errorf("unexpected message topic: %s key: %s", msg.Topic, key)
+	}
+}
+
+func TestClientPublishError(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, NewConfig())
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	cli := &Client{producer: producer, codec: eventhus.JSONCodec{}, router: DefaultRouter}
+
+	if err := cli.Publish(eventhus.Event{}, "shop", "cart"); err != sarama.ErrNotEnoughReplicas {
+		t.Error("expected ErrNotEnoughReplicas, got", err)
+	}
+}
+
+func TestClientPublishBatchReportsFailedMessages(t *testing.T) {
+	producer := &producerStub{fail: []int{2, 0}}
+	cli := &Client{producer: producer, codec: eventhus.JSONCodec{}, router: DefaultRouter}
+
+	var events []eventhus.BatchEvent
+	for i := 0; i < 3; i++ {
+		events = append(events, eventhus.BatchEvent{Event: eventhus.Event{Version: i}, Bucket: "shop", Subset: "cart"})
+	}
+
+	var batchErr *eventbus.BatchError
+	if err := cli.PublishBatch(events); !errors.As(err, &batchErr) {
+		t.Fatal("expected a batch error, got", err)
+	}
+
+	if len(batchErr.Events) != 2 || batchErr.Events[0].Event.Version != 0 || batchErr.Events[1].Event.Version != 2 {
+		t.Errorf("expected the events 0 and 2, got %+v", batchErr.Events)
+	}
+}
+
+func TestConsumerConsumeClaim(t *testing.T) {
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	var received []string
+	failures := 1
+	c := &consumer{
+		codec:    eventhus.JSONCodec{},
+		register: eventhus.NewEventRegister(),
+		retry:    time.Millisecond,
+		onError:  func(error) {},
+		handler: eventhus.EventHandleFunc(func(event eventhus.Event) error {
+			if event.ID == "2" && failures > 0 {
+				failures--
+				return errors.New("read model unavailable")
+			}
+
+			received = append(received, event.ID)
+			return nil
+		}),
+	}
+
+	claim := &claimStub{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte(`{"id":"1","type":"ItemAdded","data":{}}`)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte(`{"id":"2","type":"ItemAdded","data":{}}`)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 3, Value: []byte(`not json`)}
+	close(claim.messages)
+
+	session := &sessionStub{ctx: context.Background()}
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(received) != 2 || received[0] != "1" || received[1] != "2" {
+		t.Error("expected [1 2], got", received)
+	}
+
+	if len(session.marked) != 3 {
+		t.Error("expected 3 marked offsets, got", session.marked)
+	}
+}
+
+func TestClientPublishThroughBroker(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	handlers := func(produce *sarama.MockProduceResponse) map[string]sarama.MockResponse {
+		return map[string]sarama.MockResponse{
+			"MetadataRequest": sarama.NewMockMetadataResponse(t).
+				SetBroker(broker.Addr(), broker.BrokerID()).
+				SetLeader("shop.cart", 0, broker.BrokerID()),
+			"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1}),
+			"ProduceRequest":        produce.SetVersion(3),
+		}
+	}
+	broker.SetHandlerByMap(handlers(sarama.NewMockProduceResponse(t)))
+
+	cli, err := NewClient([]string{broker.Addr()}, WithConfig(func(config *sarama.Config) {
+		config.Producer.Retry.Backoff = time.Millisecond
+	}))
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	event := eventhus.Event{AggregateID: "cart-1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	broker.SetHandlerByMap(handlers(sarama.NewMockProduceResponse(t).SetError("shop.cart", 0, sarama.ErrNotEnoughReplicas)))
+	if err = cli.Publish(event, "shop", "cart"); err != sarama.ErrNotEnoughReplicas {
+		t.Errorf("expected %v, got %v", sarama.ErrNotEnoughReplicas, err)
+	}
+}
+
+func TestClientSubscribeThroughBroker(t *testing.T) {
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	member := "member-1"
+	metadata := &sarama.ConsumerGroupMemberMetadata{Topics: []string{"shop.cart"}}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("shop.cart", 0, broker.BrokerID()),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1}),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "projection", broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName).
+			SetMemberId(member).
+			SetLeaderId(member).
+			SetMember(member, metadata),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).
+			SetMemberAssignment(&sarama.ConsumerGroupMemberAssignment{
+				Topics: map[string][]int32{"shop.cart": {0}},
+			}),
+		"HeartbeatRequest":  sarama.NewMockHeartbeatResponse(t),
+		"LeaveGroupRequest": sarama.NewMockLeaveGroupResponse(t),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("projection", "shop.cart", 0, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetVersion(1).
+			SetOffset("shop.cart", 0, sarama.OffsetOldest, 0).
+			SetOffset("shop.cart", 0, sarama.OffsetNewest, 2),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 2).
+			SetVersion(7).
+			SetMessage("shop.cart", 0, 0, sarama.StringEncoder(`{"id":"1","type":"ItemAdded","data":{"sku":"123"}}`)).
+			SetMessage("shop.cart", 0, 1, sarama.StringEncoder(`{"id":"2","type":"ItemAdded","data":{"sku":"456"}}`)).
+			SetHighWaterMark("shop.cart", 0, 2),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t).
+			SetError("projection", "shop.cart", 0, sarama.ErrNoError),
+	})
+
+	cli, err := NewClient([]string{broker.Addr()}, WithRetryInterval(time.Millisecond), WithConfig(func(config *sarama.Config) {
+		config.Consumer.Offsets.AutoCommit.Interval = 10 * time.Millisecond
+	}))
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	received := make(chan string, 3)
+	failures := 1
+	sub, err := cli.SubscribeGroup("projection", "shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		if event.ID == "2" && failures > 0 {
+			failures--
+			return errors.New("read model unavailable")
+		}
+
+		received <- event.ID
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	for _, expected := range []string{"1", "2"} {
+		select {
+		case id := <-received:
+			if id != expected {
+				t.Errorf("expected %s, got %s", expected, id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the event", expected)
+		}
+	}
+}
+
+func TestConsumerReportsAndSkipsPoisonEvents(t *testing.T) {
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	var reported []error
+	var received []string
+	c := &consumer{
+		codec:    eventhus.JSONCodec{},
+		register: eventhus.NewEventRegister(),
+		retry:    time.Millisecond,
+		attempts: 3,
+		onError:  func(err error) { reported = append(reported, err) },
+		handler: eventhus.EventHandleFunc(func(event eventhus.Event) error {
+			if event.ID == "1" {
+				return errors.New("read model unavailable")
+			}
+
+			received = append(received, event.ID)
+			return nil
+		}),
+	}
+
+	claim := &claimStub{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 1, Value: []byte(`{"id":"1","type":"ItemAdded","data":{}}`)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 2, Value: []byte(`not json`)}
+	claim.messages <- &sarama.ConsumerMessage{Offset: 3, Value: []byte(`{"id":"3","type":"ItemAdded","data":{}}`)}
+	close(claim.messages)
+
+	session := &sessionStub{ctx: context.Background()}
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(received) != 1 || received[0] != "3" || len(session.marked) != 3 {
+		t.Errorf("expected the event 3 and 3 marked offsets, got %v %v", received, session.marked)
+	}
+
+	if len(reported) != 2 {
+		t.Fatal("expected 2 errors, got", reported)
+	}
+
+	var attemptsErr *eventbus.AttemptsError
+	if !errors.As(reported[0], &attemptsErr) || attemptsErr.Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %v", reported[0])
+	}
+}
@@ -1,25 +1,324 @@
 package eventbus
 
 import (
+	"encoding/json"
 	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/mishudark/eventhus"
 )
 
-// Logger logs messages sent to the event bus.
+// Redacted replaces the values of the fields tagged `eventhus:"sensitive"`
+const Redacted = "[REDACTED]"
+
+// Printer writes the log lines, *log.Logger implements it
+type Printer interface {
+	Print(v ...interface{})
+}
+
+// Logger logs messages sent to the event bus as json lines, the event data
+// fields tagged `eventhus:"sensitive"` are redacted
 type Logger struct {
-	log *log.Logger
+	log            Printer
+	register       eventhus.EventTypeRegister
+	eventTypes     []string
+	aggregateTypes []string
+	now            func() time.Time
 }
 
-// NewLogger returns new logger struct.
+// LoggerOption customizes a Logger
+type LoggerOption func(*Logger)
+
+// LogEventTypes logs only the events of the given types
+func LogEventTypes(types ...string) LoggerOption {
+	return func(l *Logger) {
+		l.eventTypes = types
+	}
+}
+
+// LogAggregateTypes logs only the events of the given aggregate types
+func LogAggregateTypes(types ...string) LoggerOption {
+	return func(l *Logger) {
+		l.aggregateTypes = types
+	}
+}
+
+// NewLogger returns new logger struct, a nil l writes to stderr like the
+// standard logger.
 func NewLogger(l *log.Logger) *Logger {
-	return &Logger{
-		log: l,
+	if l == nil {
+		return NewLoggerWithOptions(nil)
 	}
+
+	return NewLoggerWithOptions(l)
+}
+
+// NewLoggerWithOptions returns a logger writing through p
+func NewLoggerWithOptions(p Printer, options ...LoggerOption) *Logger {
+	if p == nil {
+		p = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	l := &Logger{
+		log:      p,
+		register: eventhus.NewEventRegister(),
+		now:      time.Now,
+	}
+
+	for _, opt := range options {
+		opt(l)
+	}
+
+	return l
+}
+
+// logEntry is a line of the log
+type logEntry struct {
+	Time          time.Time         `json:"time"`
+	Bucket        string            `json:"bucket"`
+	Subset        string            `json:"subset"`
+	ID            string            `json:"id"`
+	AggregateID   string            `json:"aggregate_id"`
+	AggregateType string            `json:"aggregate_type"`
+	Version       int               `json:"version"`
+	Type          string            `json:"type"`
+	Data          interface{}       `json:"data"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
 }
 
-// Publish logs event details out.
+// Publish logs event details out, the events of a batch are logged one by one
 func (l *Logger) Publish(e eventhus.Event, b, s string) error {
-	log.Printf("bucket: %s subset: %s event: %+v", b, s, e)
+	if batch, ok := e.Data.(*eventhus.EventBatch); ok && e.Type == eventhus.EventBatchType {
+		for _, event := range batch.Events {
+			if err := l.Publish(event, b, s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(l.eventTypes) > 0 && !contains(l.eventTypes, e.Type) {
+		return nil
+	}
+
+	if len(l.aggregateTypes) > 0 && !contains(l.aggregateTypes, e.AggregateType) {
+		return nil
+	}
+
+	line, err := json.Marshal(logEntry{
+		Time:          l.now().UTC(),
+		Bucket:        b,
+		Subset:        s,
+		ID:            e.ID,
+		AggregateID:   e.AggregateID,
+		AggregateType: e.AggregateType,
+		Version:       e.Version,
+		Type:          e.Type,
+		Data:          redact(reflect.ValueOf(l.decode(e))),
+		Metadata:      e.Metadata,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	l.log.Print(string(line))
 	return nil
 }
+
+// decode returns the data of the event, raw json is decoded into its registered
+// type so the sensitive fields are known
+func (l *Logger) decode(e eventhus.Event) interface{} {
+	raw, ok := e.Data.(json.RawMessage)
+	if !ok {
+		return e.Data
+	}
+
+	if data, err := l.register.Get(e.Type); err == nil && json.Unmarshal(raw, data) == nil {
+		return data
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return raw
+	}
+
+	return data
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// marshaler returns the value json encodes with its own MarshalJSON, nil if
+// v has none; the pointer methods are used when v is addressable, like json does
+func marshaler(v reflect.Value) interface{} {
+	t := v.Type()
+	if t.Implements(marshalerType) {
+		return v.Interface()
+	}
+
+	if v.CanAddr() && reflect.PtrTo(t).Implements(marshalerType) {
+		return v.Addr().Interface()
+	}
+
+	return nil
+}
+
+// redact returns a copy of v that encodes as v does, without the values of the
+// sensitive fields
+func redact(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	// the types with their own encoding are kept as they are, unless they have
+	// sensitive fields: the redaction wins over the custom encoding
+	if m := marshaler(v); m != nil && !sensitive(v.Type(), make(map[reflect.Type]bool)) {
+		return m
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return redact(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		redactStruct(v, fields)
+		return fields
+	case reflect.Slice:
+		if v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = redact(v.Index(i))
+		}
+
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := json.Marshal(iter.Key().Interface())
+			if err != nil {
+				continue
+			}
+
+			values[strings.Trim(string(key), `"`)] = redact(iter.Value())
+		}
+
+		return values
+	}
+
+	return v.Interface()
+}
+
+// sensitive reports whether t holds a field tagged `eventhus:"sensitive"`,
+// seen guards the recursive types
+func sensitive(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return sensitive(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			if field.Tag.Get("eventhus") == "sensitive" || sensitive(field.Type, seen) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// redactStruct adds the exported fields of v to fields following their json tags,
+// the fields of the embedded structs are promoted
+func redactStruct(v reflect.Value, fields map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// the values of the unexported fields can't be read
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := field.Name
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			name = parts[0]
+		}
+
+		value := v.Field(i)
+		if field.Anonymous && parts[0] == "" {
+			embedded := value
+			if embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					continue
+				}
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				redactStruct(embedded, fields)
+				continue
+			}
+		}
+
+		if len(parts) > 1 && strings.Contains(tag, "omitempty") && isEmpty(value) {
+			continue
+		}
+
+		if field.Tag.Get("eventhus") == "sensitive" {
+			fields[name] = Redacted
+			continue
+		}
+
+		fields[name] = redact(value)
+	}
+}
+
+// isEmpty reports whether json omits the value with omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
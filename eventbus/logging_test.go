@@ -0,0 +1,157 @@
+package eventbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type Card struct {
+	Number string `json:"number" eventhus:"sensitive"`
+	Brand  string `json:"brand"`
+}
+
+type PaymentPerformed struct {
+	Amount int               `json:"amount"`
+	Card   *Card             `json:"card"`
+	Notes  []string          `json:"notes,omitempty"`
+	Extra  map[string]string `json:"-"`
+}
+
+func TestLoggerPublish(t *testing.T) {
+	var buf bytes.Buffer
+	sut := NewLogger(log.New(&buf, "", 0))
+	sut.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	event := eventhus.Event{
+		ID:            "1",
+		AggregateID:   "2",
+		AggregateType: "Payment",
+		Version:       1,
+		Type:          "PaymentPerformed",
+		Data: &PaymentPerformed{
+			Amount: 10,
+			Card:   &Card{Number: "4242424242424242", Brand: "visa"},
+			Extra:  map[string]string{"a": "b"},
+		},
+	}
+
+	if err := sut.Publish(event, "bank", "payments"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	expected := `{"time":"2020-01-02T03:04:05Z","bucket":"bank","subset":"payments","id":"1","aggregate_id":"2","aggregate_type":"Payment","version":1,"type":"PaymentPerformed","data":{"amount":10,"card":{"brand":"visa","number":"[REDACTED]"}}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+
+	// the original event is untouched
+	if event.Data.(*PaymentPerformed).Card.Number != "4242424242424242" {
+		t.Error("expected the event data to be kept")
+	}
+}
+
+func TestLoggerFilters(t *testing.T) {
+	var buf bytes.Buffer
+	sut := NewLoggerWithOptions(log.New(&buf, "", 0), LogEventTypes("PaymentPerformed"), LogAggregateTypes("Payment"))
+
+	sut.Publish(eventhus.Event{Type: "PaymentPerformed", AggregateType: "Payment"}, "bank", "payments")
+	sut.Publish(eventhus.Event{Type: "PaymentRefunded", AggregateType: "Payment"}, "bank", "payments")
+	sut.Publish(eventhus.Event{Type: "PaymentPerformed", AggregateType: "Account"}, "bank", "payments")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatal("expected 1 line, got", len(lines))
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if entry["type"] != "PaymentPerformed" || entry["aggregate_type"] != "Payment" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestLoggerPublishBatch(t *testing.T) {
+	var buf bytes.Buffer
+	sut := NewLoggerWithOptions(log.New(&buf, "", 0), LogEventTypes("PaymentPerformed"))
+
+	batch, _ := eventhus.NewBatchEvent([]eventhus.Event{
+		{Type: "PaymentPerformed", Data: &PaymentPerformed{Card: &Card{Number: "4242424242424242"}}},
+		{Type: "PaymentRefunded"},
+	})
+
+	sut.Publish(batch, "bank", "payments")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatal("expected 1 line, got", len(lines))
+	}
+
+	if !bytes.Contains(lines[0], []byte(Redacted)) || bytes.Contains(lines[0], []byte("4242")) {
+		t.Errorf("expected the card number to be redacted, got %s", lines[0])
+	}
+}
+
+// Token encodes itself, its secret is tagged sensitive
+type Token struct {
+	Secret string `json:"secret" eventhus:"sensitive"`
+	Owner  string `json:"owner"`
+}
+
+func (t *Token) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"secret": t.Secret, "owner": t.Owner})
+}
+
+type TokenIssued struct {
+	Token Token     `json:"token"`
+	At    time.Time `json:"at"`
+}
+
+func TestLoggerRedactsMarshalers(t *testing.T) {
+	var buf bytes.Buffer
+	sut := NewLogger(log.New(&buf, "", 0))
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	sut.Publish(eventhus.Event{Type: "TokenIssued", Data: &TokenIssued{Token: Token{Secret: "s3cr3t", Owner: "ana"}, At: at}}, "auth", "tokens")
+
+	if bytes.Contains(buf.Bytes(), []byte("s3cr3t")) {
+		t.Errorf("expected the secret to be redacted, got %s", buf.Bytes())
+	}
+
+	// the types without sensitive fields keep their encoding
+	if !bytes.Contains(buf.Bytes(), []byte(`"at":"2020-01-02T03:04:05Z"`)) || !bytes.Contains(buf.Bytes(), []byte(`"owner":"ana"`)) {
+		t.Errorf("unexpected line %s", buf.Bytes())
+	}
+}
+
+func TestLoggerRedactsRawData(t *testing.T) {
+	eventhus.NewEventRegister().Set(PaymentPerformed{})
+
+	var buf bytes.Buffer
+	sut := NewLogger(log.New(&buf, "", 0))
+
+	// the dead letter stores return the data as raw json
+	raw := json.RawMessage(`{"amount":10,"card":{"number":"4242424242424242","brand":"visa"}}`)
+	sut.Publish(eventhus.Event{Type: "PaymentPerformed", Data: raw}, "bank", "payments")
+
+	if bytes.Contains(buf.Bytes(), []byte("4242")) || !bytes.Contains(buf.Bytes(), []byte(`"brand":"visa"`)) {
+		t.Errorf("expected the card number to be redacted, got %s", buf.Bytes())
+	}
+
+	// the types that aren't registered are logged as plain values
+	buf.Reset()
+	sut.Publish(eventhus.Event{Type: "Unknown", Data: json.RawMessage(`{"a":1}`)}, "bank", "payments")
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"data":{"a":1}`)) {
+		t.Errorf("unexpected line %s", buf.Bytes())
+	}
+}
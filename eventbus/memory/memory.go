@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mishudark/eventhus"
+)
+
+// ErrClosed is returned when publishing to a closed async bus
+var ErrClosed = errors.New("the bus is closed")
+
+// QueueSize is the quantity of events an async bus buffers before Publish blocks
+const QueueSize = 1024
+
+type message struct {
+	event          eventhus.Event
+	bucket, subset string
+}
+
+type subscriber struct {
+	id             int
+	bucket, subset string
+	group          string
+	handler        eventhus.EventHandle
+}
+
+// Bus dispatches the events to the handlers of the register in the same process,
+// the handlers are called in registration order
+type Bus struct {
+	// ErrorHandler is called when a handler fails in async mode
+	ErrorHandler func(event eventhus.Event, err error)
+	register     eventhus.EventHandlerRegister
+	mu           sync.RWMutex
+	subs         []subscriber
+	nextID       int
+	queue        chan message
+	stop         chan struct{}
+	done         chan struct{}
+	// publishing counts the publishers, the queue is closed once they return
+	publishing sync.WaitGroup
+	closing    sync.Mutex
+	closed     bool
+}
+
+// NewBus returns a synchronous bus, Publish returns once all the handlers were called
+func NewBus(register eventhus.EventHandlerRegister) *Bus {
+	return &Bus{
+		register: register,
+	}
+}
+
+// NewAsyncBus returns a bus that calls the handlers in a background goroutine,
+// the events are dispatched in the order they were published
+func NewAsyncBus(register eventhus.EventHandlerRegister) *Bus {
+	b := NewBus(register)
+	b.queue = make(chan message, QueueSize)
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+
+	go b.run()
+	return b
+}
+
+// Publish an event to its handlers, in sync mode it returns the first error
+func (b *Bus) Publish(event eventhus.Event, bucket, subset string) error {
+	if b.queue == nil {
+		return b.dispatch(event, bucket, subset)
+	}
+
+	b.closing.Lock()
+	if b.closed {
+		b.closing.Unlock()
+		return ErrClosed
+	}
+	b.publishing.Add(1)
+	b.closing.Unlock()
+
+	defer b.publishing.Done()
+
+	select {
+	case b.queue <- message{event, bucket, subset}:
+		return nil
+	case <-b.stop:
+		return ErrClosed
+	}
+}
+
+// Close waits for the queued events to be dispatched, the publishers waiting
+// for room get ErrClosed; it's a noop in sync mode
+func (b *Bus) Close() {
+	if b.queue == nil {
+		return
+	}
+
+	b.closing.Lock()
+	if b.closed {
+		b.closing.Unlock()
+		<-b.done
+		return
+	}
+	b.closed = true
+	close(b.stop)
+	b.closing.Unlock()
+
+	b.publishing.Wait()
+	close(b.queue)
+	<-b.done
+}
+
+func (b *Bus) run() {
+	defer close(b.done)
+
+	for msg := range b.queue {
+		if err := b.dispatch(msg.event, msg.bucket, msg.subset); err != nil && b.ErrorHandler != nil {
+			b.ErrorHandler(msg.event, err)
+		}
+	}
+}
+
+// dispatch an event to its handlers, the events of a batch are dispatched in
+// order until one fails
+func (b *Bus) dispatch(event eventhus.Event, bucket, subset string) error {
+	if batch, ok := event.Data.(*eventhus.EventBatch); ok && event.Type == eventhus.EventBatchType {
+		for _, e := range batch.Events {
+			if err := b.dispatch(e, bucket, subset); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var first error
+
+	handlers := b.register.Get(event, bucket, subset)
+
+	// the members of a group are picked by aggregate, so the events of an
+	// aggregate go to the same member
+	var groups []string
+	members := make(map[string][]eventhus.EventHandle)
+
+	b.mu.RLock()
+	for _, sub := range b.subs {
+		if sub.bucket != bucket || sub.subset != subset {
+			continue
+		}
+
+		if sub.group == "" {
+			handlers = append(handlers, sub.handler)
+			continue
+		}
+
+		if _, ok := members[sub.group]; !ok {
+			groups = append(groups, sub.group)
+		}
+		members[sub.group] = append(members[sub.group], sub.handler)
+	}
+	b.mu.RUnlock()
+
+	for _, group := range groups {
+		h := fnv.New32a()
+		h.Write([]byte(event.AggregateID))
+		handlers = append(handlers, members[group][h.Sum32()%uint32(len(members[group]))])
+	}
+
+	for _, handler := range handlers {
+		if err := handler.Handle(event); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+type subscription struct {
+	bus *Bus
+	id  int
+}
+
+// Close removes the handler from the bus
+func (s *subscription) Close() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	for i, sub := range s.bus.subs {
+		if sub.id == s.id {
+			s.bus.subs = append(s.bus.subs[:i:i], s.bus.subs[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Subscribe a handler to the events published to bucket and subset, it's
+// called after the handlers of the register
+func (b *Bus) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return b.SubscribeGroup("", bucket, subset, handler)
+}
+
+// SubscribeGroup joins the group, every event is handled by a single member
+// chosen by its aggregate
+func (b *Bus) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subs = append(b.subs, subscriber{id, bucket, subset, group, handler})
+
+	return &subscription{
+		bus: b,
+		id:  id,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type ItemAdded struct{}
+
+type recorder struct {
+	sync.Mutex
+	calls []string
+}
+
+func (r *recorder) handler(name string, err error) eventhus.EventHandle {
+	return eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		r.Lock()
+		r.calls = append(r.calls, name+":"+event.ID)
+		r.Unlock()
+		return err
+	})
+}
+
+func TestBusPublish(t *testing.T) {
+	rec := &recorder{}
+	register := eventhus.NewEventHandlerRegistry()
+	register.Add(ItemAdded{}, rec.handler("type", nil))
+	register.AddForAggregate("Cart", rec.handler("aggregate", errors.New("failed")))
+	register.AddForSubset("shop", "cart", rec.handler("subset", nil))
+
+	bus := NewBus(register)
+	sub, _ := bus.Subscribe("shop", "cart", rec.handler("subscriber", nil))
+
+	err := bus.Publish(eventhus.Event{ID: "1", Type: "ItemAdded", AggregateType: "Cart"}, "shop", "cart")
+	if err == nil || err.Error() != "failed" {
+		t.Error("expected failed, got", err)
+	}
+
+	sub.Close()
+	bus.Publish(eventhus.Event{ID: "2", Type: "ItemAdded"}, "shop", "orders")
+
+	expected := []string{"type:1", "aggregate:1", "subset:1", "subscriber:1", "type:2"}
+	if len(rec.calls) != len(expected) {
+		t.Fatal("expected", expected, "got", rec.calls)
+	}
+
+	for i := range expected {
+		if rec.calls[i] != expected[i] {
+			t.Fatal("expected", expected, "got", rec.calls)
+		}
+	}
+}
+
+func TestAsyncBusPublish(t *testing.T) {
+	rec := &recorder{}
+	register := eventhus.NewEventHandlerRegistry()
+	register.AddForSubset("shop", "cart", rec.handler("subset", errors.New("failed")))
+
+	var failed []string
+	bus := NewAsyncBus(register)
+	bus.ErrorHandler = func(event eventhus.Event, err error) {
+		failed = append(failed, event.ID)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := bus.Publish(eventhus.Event{ID: id}, "shop", "cart"); err != nil {
+			t.Error("expected nil, got", err)
+		}
+	}
+
+	bus.Close()
+
+	expected := []string{"subset:1", "subset:2", "subset:3"}
+	if len(rec.calls) != len(expected) || len(failed) != 3 {
+		t.Fatal("expected", expected, "got", rec.calls, failed)
+	}
+
+	for i := range expected {
+		if rec.calls[i] != expected[i] {
+			t.Fatal("expected", expected, "got", rec.calls)
+		}
+	}
+}
+
+func TestAsyncBusPublishAfterClose(t *testing.T) {
+	bus := NewAsyncBus(eventhus.NewEventHandlerRegistry())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := bus.Publish(eventhus.Event{}, "shop", "cart"); err != nil && err != ErrClosed {
+					t.Error("expected nil or ErrClosed, got", err)
+				}
+			}
+		}()
+	}
+
+	bus.Close()
+	wg.Wait()
+
+	if err := bus.Publish(eventhus.Event{}, "shop", "cart"); err != ErrClosed {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+
+	// closing twice is safe
+	bus.Close()
+}
+
+func TestAsyncBusCloseWhileHandlerPublishes(t *testing.T) {
+	bus := NewAsyncBus(eventhus.NewEventHandlerRegistry())
+
+	started := make(chan struct{})
+	failed := make(chan error, 1)
+	bus.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		if event.ID != "start" {
+			return nil
+		}
+
+		close(started)
+
+		// the queue fills up, the handler waits for room until Close
+		for i := 0; i <= QueueSize; i++ {
+			if err := bus.Publish(eventhus.Event{}, "shop", "cart"); err != nil {
+				failed <- err
+				return nil
+			}
+		}
+
+		failed <- nil
+		return nil
+	}))
+
+	bus.Publish(eventhus.Event{ID: "start"}, "shop", "cart")
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("expected Close to return")
+	}
+
+	if err := <-failed; err != ErrClosed {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestBusPublishBatch(t *testing.T) {
+	rec := &recorder{}
+	register := eventhus.NewEventHandlerRegistry()
+	register.Add(ItemAdded{}, rec.handler("type", nil))
+
+	bus := NewBus(register)
+	batch := eventhus.Event{
+		Type: eventhus.EventBatchType,
+		Data: &eventhus.EventBatch{
+			Count: 2,
+			Events: []eventhus.Event{
+				{ID: "1", Type: "ItemAdded"},
+				{ID: "2", Type: "ItemAdded"},
+			},
+		},
+	}
+
+	if err := bus.Publish(batch, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(rec.calls) != 2 || rec.calls[0] != "type:1" || rec.calls[1] != "type:2" {
+		t.Error("expected [type:1 type:2], got", rec.calls)
+	}
+}
+
+func TestBusSubscribeGroup(t *testing.T) {
+	rec := &recorder{}
+	bus := NewBus(eventhus.NewEventHandlerRegistry())
+
+	bus.SubscribeGroup("projection", "shop", "cart", rec.handler("a", nil))
+	bus.SubscribeGroup("projection", "shop", "cart", rec.handler("b", nil))
+	bus.Subscribe("shop", "cart", rec.handler("audit", nil))
+
+	members := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		rec.calls = nil
+		aggregateID := string(rune('a' + i%5))
+		bus.Publish(eventhus.Event{ID: aggregateID, AggregateID: aggregateID}, "shop", "cart")
+
+		if len(rec.calls) != 2 || rec.calls[0] != "audit:"+aggregateID {
+			t.Fatal("expected the audit and a member, got", rec.calls)
+		}
+
+		// the events of an aggregate go to the same member
+		if member, ok := members[aggregateID]; ok && member != rec.calls[1] {
+			t.Errorf("expected %s, got %s", member, rec.calls[1])
+		}
+		members[aggregateID] = rec.calls[1]
+	}
+}
@@ -1,24 +1,60 @@
 package mosquitto
 
 import (
-	"encoding/json"
-	"github.com/mishudark/eventhus"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
 	"log"
-	"os"
+	"sync"
+	"time"
+
 	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/utils"
 )
 
-var info = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+// discard is the default logger, the client is quiet unless WithLogger is set
+var discard = log.New(ioutil.Discard, "", 0)
+
+// Logger receives the messages of the client, *log.Logger implements it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
 
-var fatal = log.New(os.Stderr, "FATAL: ", log.Ldate|log.Ltime|log.Lshortfile)
+// TopicSettings defines how the events are published to a topic
+type TopicSettings struct {
+	QoS      byte
+	Retained bool
+}
 
-// Client nats
+// Client mqtt, it keeps a single connection that is reconnected automatically
 type Client struct {
-	options  *MQTT.ClientOptions
-	client   MQTT.Client
+	options   *MQTT.ClientOptions
+	client    MQTT.Client
+	brokerURL string
+	mu        sync.Mutex
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	reconnect time.Duration
+	logger    Logger
+	defaults  TopicSettings
+	topics    map[string]TopicSettings
+	codec     eventhus.EventCodec
+	router    eventhus.Router
+	onError   func(error)
+	newClient func(*MQTT.ClientOptions) MQTT.Client
 }
 
+// DefaultRouter publishes the events to the topic `bucket/subset`
+var DefaultRouter = eventhus.MustTopicTemplate("{bucket}/{subset}")
+
+// Wildcard matches a level of a topic
+const Wildcard = "+"
+
+// Option customizes the mqtt client
+type Option func(*Client)
+
 //MqttDefaultPort is the default port
 const MqttDefaultPort = 1883
 
@@ -31,55 +67,325 @@ const MqttDefaultMethod = "tcp"
 //MqttDefaultClientId is the default method
 const MqttDefaultClientId = "cqrs-es"
 
+//MqttDefaultMaxReconnectInterval is the default max time between reconnect attempts
+const MqttDefaultMaxReconnectInterval = time.Minute
+
+//MqttDefaultQoS is the QoS of the topics without specific settings, at most once
+const MqttDefaultQoS = 0
 
 //NewClient create a new client with default parameters
 func NewClient() (*Client, error) {
 	return NewClientWithPort(MqttDefaultMethod, MqttDefaultHost, MqttDefaultPort, MqttDefaultClientId)
 }
 
+//NewClientWithPort create a new client with options
+func NewClientWithPort(method string, host string, port int, clientID string) (*Client, error) {
+	return NewClientWithOptions(method, host, port, clientID)
+}
+
+//NewClientWithOptions create a new client customized with options
+func NewClientWithOptions(method string, host string, port int, clientID string, options ...Option) (*Client, error) {
+	d := &Client{
+		brokerURL: fmt.Sprintf("%s://%s:%d", method, host, port),
+		reconnect: MqttDefaultMaxReconnectInterval,
+		logger:    discard,
+		defaults:  TopicSettings{QoS: MqttDefaultQoS},
+		topics:    make(map[string]TopicSettings),
+		codec:     eventhus.JSONCodec{},
+		router:    DefaultRouter,
+		onError: func(err error) {
+			log.Println("mosquitto: subscription failed:", err)
+		},
+		newClient: MQTT.NewClient,
+	}
+
+	for _, opt := range options {
+		opt(d)
+	}
+
+	if err := d.CheckCodec(d.codec); err != nil {
+		return nil, err
+	}
+
+	d.options = d.newOptions(clientID)
+	d.logger.Printf("Created Client for broker %s", d.brokerURL)
+
+	return d, nil
+}
+
+// WithCredentials authenticates with username and password
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithTLS uses config to establish a secure connection, the method should be ssl or tls
+func WithTLS(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithLogger routes the messages of the client to logger, they're discarded by default
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithMaxReconnectInterval sets the max time between reconnect attempts
+func WithMaxReconnectInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.reconnect = interval
+	}
+}
+
+// WithQoS sets the QoS and retain flag used for the topics without specific
+// settings, MqttDefaultQoS and not retained by default
+func WithQoS(qos byte, retained bool) Option {
+	return func(c *Client) {
+		c.defaults = TopicSettings{qos, retained}
+	}
+}
+
+// WithCodec sets how the events are encoded, mqtt 3.1.1 has no headers so the
+// client fails with eventhus.ErrHeaderUnsupported for the codecs that use them
+func WithCodec(codec eventhus.EventCodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithRouter sets how the topics of the events are computed
+func WithRouter(router eventhus.Router) Option {
+	return func(c *Client) {
+		c.router = router
+	}
+}
+
+// WithErrorHandler sets the func notified when a subscription can't decode a
+// message or its handler fails, the errors are logged by default
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.onError = handler
+	}
+}
+
+// WithTopic sets the QoS and retain flag of a topic, `bucket/subset`
+func WithTopic(topic string, qos byte, retained bool) Option {
+	return func(c *Client) {
+		c.topics[topic] = TopicSettings{qos, retained}
+	}
+}
+
+func (c *Client) newOptions(clientID string) *MQTT.ClientOptions {
+	options := MQTT.NewClientOptions()
+	options.AddBroker(c.brokerURL)
+	options.SetClientID(clientID)
+	options.SetAutoReconnect(true)
+	options.SetMaxReconnectInterval(c.reconnect)
+	options.SetDefaultPublishHandler(c.defaultPublishHandler)
+	options.SetOnConnectHandler(func(MQTT.Client) {
+		c.logger.Printf("Connected to broker %s", c.brokerURL)
+	})
+	options.SetConnectionLostHandler(func(_ MQTT.Client, err error) {
+		c.logger.Printf("Connection lost to broker %s: %s", c.brokerURL, err)
+	})
+
+	if c.username != "" {
+		options.SetUsername(c.username)
+		options.SetPassword(c.password)
+	}
+
+	if c.tlsConfig != nil {
+		options.SetTLSConfig(c.tlsConfig)
+	}
+
+	return options
+}
+
 // defaultPublishHandler is called when there is a message that is matching no other subscriber
-var defaultPublishHandler MQTT.MessageHandler = func(client MQTT.Client, msg MQTT.Message) {
-	fmt.Printf("TOPIC: %s\n", msg.Topic())
-	fmt.Printf("MSG: %s\n", msg.Payload())
+func (c *Client) defaultPublishHandler(client MQTT.Client, msg MQTT.Message) {
+	c.logger.Printf("TOPIC: %s MSG: %s", msg.Topic(), msg.Payload())
 }
 
-//NewClientWithPort create a new client with options
-func NewClientWithPort(method string, host string, port int, clientID string) (*Client, error) {
-	var d Client
+// connection returns the shared client, it's connected on first use
+func (c *Client) connection() (MQTT.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	d.options = MQTT.NewClientOptions()
-	brokerURL := fmt.Sprintf("%s://%s:%d", method, host, port)
-	d.options.AddBroker(brokerURL)
-	d.options.SetClientID(clientID)
-	d.options.SetDefaultPublishHandler(defaultPublishHandler)
+	if c.client != nil {
+		return c.client, nil
+	}
 
-	info.Printf("Created Client for broker %s", brokerURL)
+	client := c.newClient(c.options)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	c.client = client
+	return client, nil
+}
+
+// Close disconnects the client, waiting up to 250 milliseconds for the pending work
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		c.client.Disconnect(250)
+		c.client = nil
+	}
+
+	return nil
+}
+
+func (c *Client) settings(topic string) TopicSettings {
+	if settings, ok := c.topics[topic]; ok {
+		return settings
+	}
+
+	return c.defaults
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// CheckCodec fails with eventhus.ErrHeaderUnsupported when the codec puts
+// attributes in the message header, mqtt messages have none
+func (c *Client) CheckCodec(codec eventhus.EventCodec) error {
+	if eventhus.UsesHeader(codec) {
+		return eventhus.ErrHeaderUnsupported
+	}
+
+	return nil
+}
 
-	return &d, nil
+// SetRouter sets how the topics of the events are computed
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.router = router
 }
 
 // Publish a event
 func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	client, err := c.connection()
+	if err != nil {
+		return err
+	}
 
-	info.Println("Publish Begin")
-
-	c.client = MQTT.NewClient(c.options)
-	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
-		return token.Error()
+	msg, err := c.codec.Encode(event, bucket, subset)
+	if err != nil {
+		return err
 	}
 
-	defer c.client.Disconnect(5000)
+	if len(msg.Header) > 0 {
+		return eventhus.ErrHeaderUnsupported
+	}
 
-	msg, err := json.Marshal(event)
+	subj, err := c.router.Route(event, bucket, subset)
 	if err != nil {
 		return err
 	}
 
-	subj := bucket + "/" + subset
-	token := c.client.Publish(subj, 0, false, msg)
+	settings := c.settings(subj)
+
+	token := client.Publish(subj, settings.QoS, settings.Retained, msg.Body)
 	token.Wait()
 
-	info.Println("Publish End")
+	return token.Error()
+}
+
+// subscription owns the mqtt client used to receive the events
+type subscription struct {
+	client MQTT.Client
+	topic  string
+}
 
+// Close the subscription and disconnect its client
+func (s *subscription) Close() error {
+	defer s.client.Disconnect(250)
+
+	token := s.client.Unsubscribe(s.topic)
+	token.Wait()
 	return token.Error()
 }
+
+// Subscribe to the events published to bucket and subset, the subscription
+// uses its own connection with a client ID derived from the configured one
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	topic, err := c.router.Pattern(bucket, subset, Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SubscribeTopic(topic, handler)
+}
+
+// SubscribeGroup joins the group with a shared subscription, mosquitto supports
+// them since 1.6
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	topic, err := c.router.Pattern(bucket, subset, Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(SharedTopic(group, topic), c.settings(topic).QoS, handler)
+}
+
+// SharedTopic is the topic of the shared subscription of group
+func SharedTopic(group, topic string) string {
+	return "$share/" + group + "/" + topic
+}
+
+// SubscribeTopic subscribes to a topic, it can contain wildcards
+func (c *Client) SubscribeTopic(topic string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe(topic, c.settings(topic).QoS, handler)
+}
+
+func (c *Client) subscribe(topic string, qos byte, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	suffix, err := utils.UUID()
+	if err != nil {
+		return nil, err
+	}
+
+	register := eventhus.NewEventRegister()
+	onMessage := func(_ MQTT.Client, msg MQTT.Message) {
+		event, err := c.codec.Decode(eventhus.Message{Body: msg.Payload()}, register)
+		if err != nil {
+			c.onError(fmt.Errorf("decode message of %s: %w", msg.Topic(), err))
+			return
+		}
+
+		if err = handler.Handle(event); err != nil {
+			c.onError(fmt.Errorf("handle event %s of %s: %w", event.ID, msg.Topic(), err))
+		}
+	}
+
+	// two connections can't share the client ID, the subscription is
+	// created again when the client reconnects
+	options := c.newOptions(c.options.ClientID + "-" + suffix)
+	options.SetOnConnectHandler(func(client MQTT.Client) {
+		c.logger.Printf("Connected to broker %s", c.brokerURL)
+		client.Subscribe(topic, qos, onMessage)
+	})
+
+	client := c.newClient(options)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	// wait until the broker confirms the subscription, subscribing twice is harmless
+	if token := client.Subscribe(topic, qos, onMessage); token.Wait() && token.Error() != nil {
+		client.Disconnect(250)
+		return nil, token.Error()
+	}
+
+	return &subscription{
+		client: client,
+		topic:  topic,
+	}, nil
+}
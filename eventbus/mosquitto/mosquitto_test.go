@@ -0,0 +1,162 @@
+package mosquitto
+
+import (
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus/cloudevents"
+)
+
+type subscribed struct {
+	topic string
+	qos   byte
+}
+
+type clientStub struct {
+	MQTT.Client
+	options    *MQTT.ClientOptions
+	subscribed []subscribed
+	published  []subscribed
+}
+
+func (c *clientStub) Connect() MQTT.Token {
+	return &MQTT.DummyToken{}
+}
+
+func (c *clientStub) Disconnect(quiesce uint) {}
+
+func (c *clientStub) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	c.subscribed = append(c.subscribed, subscribed{topic, qos})
+	return &MQTT.DummyToken{}
+}
+
+func (c *clientStub) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	c.published = append(c.published, subscribed{topic, qos})
+	return &MQTT.DummyToken{}
+}
+
+func newClient(t *testing.T, options ...Option) (*Client, *[]*clientStub) {
+	c, err := NewClientWithOptions("tcp", "localhost", 1883, "bank", options...)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	var clients []*clientStub
+	c.newClient = func(options *MQTT.ClientOptions) MQTT.Client {
+		client := &clientStub{options: options}
+		clients = append(clients, client)
+		return client
+	}
+
+	return c, &clients
+}
+
+func TestNewClientWithOptions(t *testing.T) {
+	c, _ := newClient(t,
+		WithCredentials("user", "secret"),
+		WithMaxReconnectInterval(10*time.Second),
+		WithQoS(2, true),
+		WithTopic("bank/account", 0, false),
+	)
+
+	if len(c.options.Servers) != 1 || c.options.Servers[0].String() != "tcp://localhost:1883" {
+		t.Errorf("unexpected servers %v", c.options.Servers)
+	}
+
+	if c.options.ClientID != "bank" || c.options.Username != "user" || c.options.Password != "secret" {
+		t.Errorf("unexpected options %+v", c.options)
+	}
+
+	if !c.options.AutoReconnect || c.options.MaxReconnectInterval != 10*time.Second {
+		t.Errorf("expected auto reconnect every 10s, got %v", c.options.MaxReconnectInterval)
+	}
+
+	if settings := c.settings("bank/account"); settings != (TopicSettings{0, false}) {
+		t.Errorf("expected the topic settings, got %+v", settings)
+	}
+
+	if settings := c.settings("bank/transfer"); settings != (TopicSettings{2, true}) {
+		t.Errorf("expected the default settings, got %+v", settings)
+	}
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	c, _ := newClient(t)
+
+	if settings := c.settings("bank/account"); settings != (TopicSettings{MqttDefaultQoS, false}) {
+		t.Errorf("expected QoS %d, got %+v", MqttDefaultQoS, settings)
+	}
+
+	if c.logger != discard {
+		t.Error("expected the client to be quiet by default")
+	}
+}
+
+func TestNewClientRejectsBinaryCodec(t *testing.T) {
+	_, err := NewClientWithOptions("tcp", "localhost", 1883, "bank", WithCodec(cloudevents.NewCodec(cloudevents.Binary)))
+	if err != eventhus.ErrHeaderUnsupported {
+		t.Errorf("expected %v, got %v", eventhus.ErrHeaderUnsupported, err)
+	}
+}
+
+func TestClientPublishUsesTopicQoS(t *testing.T) {
+	c, clients := newClient(t, WithTopic("bank/account", 2, false))
+
+	c.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account")
+	c.Publish(eventhus.Event{Type: "TransferSent"}, "bank", "transfer")
+
+	published := (*clients)[0].published
+	expected := []subscribed{{"bank/account", 2}, {"bank/transfer", MqttDefaultQoS}}
+	if len(published) != len(expected) || published[0] != expected[0] || published[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, published)
+	}
+}
+
+func TestClientSubscribeQoS(t *testing.T) {
+	c, clients := newClient(t, WithTopic("bank/account", 2, false))
+	handler := eventhus.EventHandleFunc(func(eventhus.Event) error { return nil })
+
+	if _, err := c.SubscribeTopic("bank/account", handler); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if _, err := c.Subscribe("bank", "transfer", handler); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(*clients) != 2 {
+		t.Fatal("expected a client per subscription, got", len(*clients))
+	}
+
+	if sub := (*clients)[0].subscribed; len(sub) != 1 || sub[0] != (subscribed{"bank/account", 2}) {
+		t.Errorf("unexpected subscriptions %v", sub)
+	}
+
+	if sub := (*clients)[1].subscribed; len(sub) != 1 || sub[0] != (subscribed{"bank/transfer", MqttDefaultQoS}) {
+		t.Errorf("unexpected subscriptions %v", sub)
+	}
+
+	if (*clients)[0].options.ClientID == "bank" || (*clients)[0].options.ClientID == (*clients)[1].options.ClientID {
+		t.Error("expected a client ID per subscription, got", (*clients)[0].options.ClientID)
+	}
+}
+
+func TestClientSubscribeGroup(t *testing.T) {
+	c, clients := newClient(t, WithTopic("bank/account", 2, false))
+	handler := eventhus.EventHandleFunc(func(eventhus.Event) error { return nil })
+
+	if topic := SharedTopic("balances", "bank/account"); topic != "$share/balances/bank/account" {
+		t.Error("expected $share/balances/bank/account, got", topic)
+	}
+
+	if _, err := c.SubscribeGroup("balances", "bank", "account", handler); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// the QoS is the one of the topic, not of the shared one
+	if sub := (*clients)[0].subscribed; len(sub) != 1 || sub[0] != (subscribed{"$share/balances/bank/account", 2}) {
+		t.Errorf("unexpected subscriptions %v", sub)
+	}
+}
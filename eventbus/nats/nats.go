@@ -1,21 +1,43 @@
 package nats
 
 import (
-	"encoding/json"
-	"github.com/mishudark/eventhus"
+	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
-// Client nats
+// Option customizes the nats connection
+type Option = nats.Option
+
+// Client nats, it keeps a single connection that is reconnected by the nats
+// client when the server goes away, the events published meanwhile are buffered
 type Client struct {
 	Options nats.Options
+	mu      sync.Mutex
+	conn    *nats.Conn
+	codec   eventhus.EventCodec
+	router  eventhus.Router
+	onError func(error)
 }
 
+// DefaultRouter publishes the events to the subject `bucket.subset`
+var DefaultRouter = eventhus.MustTopicTemplate("{bucket}.{subset}")
+
+// Wildcard matches a token of a subject
+const Wildcard = "*"
+
+// CloseTimeout bounds the flush of the buffered events when the client is closed
+const CloseTimeout = 2 * time.Second
+
 // NewClient returns the basic client to access to nats
 func NewClient(urls string, useTLS bool) (*Client, error) {
-	opts := nats.DefaultOptions
+	opts := nats.GetDefaultOptions()
 	opts.Secure = useTLS
 	opts.Servers = strings.Split(urls, ",")
 
@@ -24,28 +46,270 @@ func NewClient(urls string, useTLS bool) (*Client, error) {
 	}
 
 	return &Client{
-		opts,
+		Options: opts,
+		codec:   eventhus.JSONCodec{},
+		router:  DefaultRouter,
+		onError: func(err error) {
+			log.Println("nats: subscription failed:", err)
+		},
 	}, nil
 }
 
+// NewClientWithOptions returns a client to access to nats customized with options
+func NewClientWithOptions(urls string, options ...Option) (*Client, error) {
+	c, err := NewClient(urls, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range options {
+		if err = opt(&c.Options); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Reconnect waits wait between reconnect attempts and gives up after max attempts,
+// a negative max never gives up
+func Reconnect(wait time.Duration, max int) Option {
+	return func(o *nats.Options) error {
+		o.ReconnectWait = wait
+		o.MaxReconnect = max
+		return nil
+	}
+}
+
+// ReconnectDelay computes the wait before a reconnect attempt from the attempts
+// made over the list of servers, it replaces the wait of Reconnect
+func ReconnectDelay(delay func(attempts int) time.Duration) Option {
+	return nats.CustomReconnectDelay(delay)
+}
+
+// ReconnectBuffer sets the size in bytes of the events buffered while disconnected
+func ReconnectBuffer(size int) Option {
+	return nats.ReconnectBufSize(size)
+}
+
+// OnDisconnect is called when the connection is lost
+func OnDisconnect(handler func()) Option {
+	return nats.DisconnectHandler(func(*nats.Conn) {
+		handler()
+	})
+}
+
+// OnReconnect is called when the connection is established again
+func OnReconnect(handler func()) Option {
+	return nats.ReconnectHandler(func(*nats.Conn) {
+		handler()
+	})
+}
+
+// Credentials authenticates with a chained credentials file (JWT and NKey seed)
+func Credentials(file string) Option {
+	return nats.UserCredentials(file)
+}
+
+// NkeyFromSeed authenticates with the NKey stored in the seed file
+func NkeyFromSeed(seedFile string) Option {
+	return func(o *nats.Options) error {
+		opt, err := nats.NkeyOptionFromSeed(seedFile)
+		if err != nil {
+			return err
+		}
+
+		return opt(o)
+	}
+}
+
+// TLSCertificates uses the client certificate and the root CAs to
+// establish a secure connection
+func TLSCertificates(certFile, keyFile string, rootCAs ...string) Option {
+	return func(o *nats.Options) error {
+		if err := nats.ClientCert(certFile, keyFile)(o); err != nil {
+			return err
+		}
+
+		if len(rootCAs) == 0 {
+			return nil
+		}
+
+		return nats.RootCAs(rootCAs...)(o)
+	}
+}
+
+// connection returns the shared connection, it's established on first use
+func (c *Client) connection() (*nats.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && !c.conn.IsClosed() {
+		return c.conn, nil
+	}
+
+	nc, err := c.Options.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	c.conn = nc
+	return nc, nil
+}
+
+// Close the connection, the buffered events are flushed first waiting up to
+// CloseTimeout; the error tells they may be lost, the connection is closed anyway
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.FlushTimeout(CloseTimeout)
+	c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// SetCodec sets how the events are encoded, the codecs that use the message header
+// aren't supported
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// CheckCodec fails with eventhus.ErrHeaderUnsupported when the codec puts
+// attributes in the message header, nats messages have none
+func (c *Client) CheckCodec(codec eventhus.EventCodec) error {
+	if eventhus.UsesHeader(codec) {
+		return eventhus.ErrHeaderUnsupported
+	}
+
+	return nil
+}
+
+// SetRouter sets how the subjects of the events are computed
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.router = router
+}
+
+// SetErrorHandler sets the func notified when a subscription can't decode a
+// message or its handler fails, the errors are logged by default
+func (c *Client) SetErrorHandler(handler func(error)) {
+	c.onError = handler
+}
+
 // Publish a event
 func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
-	nc, err := c.Options.Connect()
+	return c.PublishBatch([]eventhus.BatchEvent{{Event: event, Bucket: bucket, Subset: subset}})
+}
+
+// PublishBatch publishes the events and flushes the connection once
+func (c *Client) PublishBatch(events []eventhus.BatchEvent) error {
+	nc, err := c.connection()
 	if err != nil {
 		return err
 	}
 
-	defer nc.Close()
+	// the events are encoded and routed first, so an event that can't be
+	// doesn't leave the batch half published
+	subjects := make([]string, len(events))
+	bodies := make([][]byte, len(events))
+	for i, e := range events {
+		msg, err := c.codec.Encode(e.Event, e.Bucket, e.Subset)
+		if err != nil {
+			return err
+		}
+
+		// the nats protocol used by the client has no headers
+		if len(msg.Header) > 0 {
+			return eventhus.ErrHeaderUnsupported
+		}
+
+		if subjects[i], err = c.router.Route(e.Event, e.Bucket, e.Subset); err != nil {
+			return err
+		}
+
+		bodies[i] = msg.Body
+	}
+
+	for i, subj := range subjects {
+		if err = nc.Publish(subj, bodies[i]); err != nil {
+			return err
+		}
+	}
+
+	// while reconnecting the events stay in the buffer, they're sent once connected
+	if nc.IsReconnecting() {
+		return nil
+	}
+
+	return nc.Flush()
+}
 
-	blob, err := json.Marshal(event)
+// Subscribe to the events published to bucket and subset
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	subj, err := c.router.Pattern(bucket, subset, Wildcard)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	subj := bucket + "." + subset
-	nc.Publish(subj, blob)
-	nc.Flush()
+	return c.SubscribeTopic(subj, handler)
+}
 
-	err = nc.LastError()
-	return err
+// SubscribeGroup joins the queue group, every event is delivered to a single member
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	subj, err := c.router.Pattern(bucket, subset, Wildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(subj, group, handler)
+}
+
+// SubscribeTopic subscribes to a subject, it can contain wildcards
+func (c *Client) SubscribeTopic(subj string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe(subj, "", handler)
+}
+
+// subscribe to a subject, as a member of the queue group when it isn't empty
+func (c *Client) subscribe(subj, group string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	nc, err := c.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	register := eventhus.NewEventRegister()
+	sub, err := nc.QueueSubscribe(subj, group, func(msg *nats.Msg) {
+		event, err := c.codec.Decode(eventhus.Message{Body: msg.Data}, register)
+		if err != nil {
+			c.onError(fmt.Errorf("decode message of %s: %w", msg.Subject, err))
+			return
+		}
+
+		if err = handler.Handle(event); err != nil {
+			c.onError(fmt.Errorf("handle event %s of %s: %w", event.ID, msg.Subject, err))
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = nc.Flush(); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+
+	return &subscription{sub}, nil
+}
+
+type subscription struct {
+	sub *nats.Subscription
+}
+
+// Close the subscription, the connection remains open
+func (s *subscription) Close() error {
+	return s.sub.Unsubscribe()
 }
@@ -0,0 +1,428 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus/cloudevents"
+	"github.com/nats-io/nats-server/v2/test"
+)
+
+type ItemAdded struct {
+	SKU string `json:"sku"`
+}
+
+func TestClientSubscribe(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8370
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli, err := NewClient("nats://127.0.0.1:8370", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	received := make(chan eventhus.Event, 1)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	event := eventhus.Event{
+		ID:          "1",
+		AggregateID: "2",
+		Type:        "ItemAdded",
+		Data:        &ItemAdded{SKU: "123"},
+	}
+
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	select {
+	case e := <-received:
+		data, ok := e.Data.(*ItemAdded)
+		if !ok || data.SKU != "123" || e.AggregateID != "2" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the event was not received")
+	}
+}
+
+func TestClientBuffersWhileDisconnected(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8371
+	s := test.RunServer(&opts)
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	disconnected := make(chan bool, 1)
+	reconnected := make(chan bool, 1)
+
+	cli, err := NewClientWithOptions(
+		"nats://127.0.0.1:8371",
+		Reconnect(20*time.Millisecond, -1),
+		OnDisconnect(func() { disconnected <- true }),
+		OnReconnect(func() { reconnected <- true }),
+	)
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	received := make(chan eventhus.Event, 1)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	s.Shutdown()
+	<-disconnected
+
+	event := eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	s = test.RunServer(&opts)
+	defer s.Shutdown()
+
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the client didn't reconnect")
+	}
+
+	select {
+	case e := <-received:
+		if e.ID != "1" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the buffered event was not received")
+	}
+}
+
+type ItemRemoved struct {
+	SKU string `json:"sku"`
+}
+
+func TestClientSubscribeTopic(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8372
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+	eventhus.NewEventRegister().Set(ItemRemoved{})
+
+	cli, err := NewClient("nats://127.0.0.1:8372", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	router := eventhus.MustTopicTemplate("{bucket}.{aggregateType}.{eventType}")
+	cli.SetRouter(router)
+
+	all := make(chan eventhus.Event, 2)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		all <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	subj, _ := router.Filter(map[string]string{
+		eventhus.FieldBucket:    "shop",
+		eventhus.FieldEventType: "ItemRemoved",
+	}, Wildcard)
+
+	removed := make(chan eventhus.Event, 2)
+	sub, err = cli.SubscribeTopic(subj, eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		removed <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	cli.Publish(eventhus.Event{AggregateType: "Cart", Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart")
+	cli.Publish(eventhus.Event{AggregateType: "Cart", Type: "ItemRemoved", Data: &ItemRemoved{}}, "shop", "cart")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-all:
+		case <-time.After(time.Second):
+			t.Fatal("the events were not received")
+		}
+	}
+
+	select {
+	case e := <-removed:
+		if e.Type != "ItemRemoved" {
+			t.Error("expected ItemRemoved, got", e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the event was not received")
+	}
+
+	select {
+	case e := <-removed:
+		t.Error("unexpected event", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientPublishBatch(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8373
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli, err := NewClient("nats://127.0.0.1:8373", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	received := make(chan eventhus.Event, 3)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	var events []eventhus.BatchEvent
+	for _, sku := range []string{"1", "2", "3"} {
+		events = append(events, eventhus.BatchEvent{
+			Event:  eventhus.Event{Type: "ItemAdded", Data: &ItemAdded{SKU: sku}},
+			Bucket: "shop",
+			Subset: "cart",
+		})
+	}
+
+	if err = cli.PublishBatch(events); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	for _, sku := range []string{"1", "2", "3"} {
+		select {
+		case e := <-received:
+			if data, ok := e.Data.(*ItemAdded); !ok || data.SKU != sku {
+				t.Errorf("expected sku %s, got %+v", sku, e.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the events were not received")
+		}
+	}
+
+	// an event that can't be encoded fails the batch before any is published
+	events[1].Event.Data = make(chan int)
+	if err = cli.PublishBatch(events); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	select {
+	case e := <-received:
+		t.Errorf("expected no events, got %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestClientSubscribeGroup(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8374
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli, err := NewClient("nats://127.0.0.1:8374", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	received := make(chan string, 10)
+	for _, member := range []string{"a", "b"} {
+		member := member
+		sub, err := cli.SubscribeGroup("projection", "shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+			received <- member + ":" + event.ID
+			return nil
+		}))
+
+		if err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+		defer sub.Close()
+	}
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		cli.Publish(eventhus.Event{ID: id, Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart")
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		select {
+		case r := <-received:
+			id := r[2:]
+			if seen[id] {
+				t.Error("the event was delivered twice", id)
+			}
+			seen[id] = true
+		case <-time.After(time.Second):
+			t.Fatal("the events were not received")
+		}
+	}
+
+	select {
+	case r := <-received:
+		t.Error("unexpected delivery", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestClientReportsSubscriptionErrors(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8375
+	s := test.RunServer(&opts)
+	defer s.Shutdown()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli, err := NewClient("nats://127.0.0.1:8375", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.Close()
+
+	failed := make(chan error, 2)
+	cli.SetErrorHandler(func(err error) {
+		failed <- err
+	})
+
+	handlerErr := errors.New("projection down")
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		return handlerErr
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	nc, err := cli.connection()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	nc.Publish("shop.cart", []byte("not json"))
+
+	cli.Publish(eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}, "shop", "cart")
+
+	for _, expected := range []error{nil, handlerErr} {
+		select {
+		case err := <-failed:
+			if expected != nil && !errors.Is(err, expected) {
+				t.Errorf("expected %v, got %v", expected, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the error was not reported")
+		}
+	}
+}
+
+func TestClientCheckCodec(t *testing.T) {
+	cli, err := NewClient("nats://127.0.0.1:4222", false)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if err = cli.CheckCodec(cloudevents.NewCodec(cloudevents.Binary)); err != eventhus.ErrHeaderUnsupported {
+		t.Errorf("expected %v, got %v", eventhus.ErrHeaderUnsupported, err)
+	}
+
+	if err = cli.CheckCodec(cloudevents.NewCodec(cloudevents.Structured)); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestClientCloseWhileDisconnected(t *testing.T) {
+	opts := test.DefaultTestOptions
+	opts.Port = 8376
+	s := test.RunServer(&opts)
+
+	disconnected := make(chan bool, 1)
+	cli, err := NewClientWithOptions(
+		"nats://127.0.0.1:8376",
+		Reconnect(20*time.Millisecond, -1),
+		OnDisconnect(func() { disconnected <- true }),
+	)
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if err = cli.Publish(eventhus.Event{ID: "1"}, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	s.Shutdown()
+	<-disconnected
+
+	if err = cli.Publish(eventhus.Event{ID: "2"}, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	start := time.Now()
+	if err = cli.Close(); err == nil {
+		t.Error("expected the buffered event to be reported")
+	}
+
+	if elapsed := time.Since(start); elapsed > CloseTimeout+time.Second {
+		t.Errorf("expected Close to return within %s, got %s", CloseTimeout, elapsed)
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	cli, err := NewClientWithOptions("nats://127.0.0.1:4222", ReconnectDelay(func(attempts int) time.Duration {
+		return time.Duration(attempts) * time.Second
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if delay := cli.Options.CustomReconnectDelayCB(3); delay != 3*time.Second {
+		t.Error("expected 3s, got", delay)
+	}
+}
@@ -1,66 +1,787 @@
 package rabbitmq
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mishudark/eventhus"
 
 	"github.com/streadway/amqp"
 )
 
-// Client rabbitmq
+// ErrNack the broker refused the event
+var ErrNack = errors.New("the broker didn't acknowledge the event")
+
+// ErrConfirmTimeout the broker didn't confirm the event on time
+var ErrConfirmTimeout = errors.New("timeout waiting for the broker confirmation")
+
+// ErrClosed the client was closed
+var ErrClosed = errors.New("the client is closed")
+
+// Default settings of the client
+const (
+	DefaultExchangeType   = "direct"
+	DefaultVHost          = "/"
+	DefaultPoolSize       = 8
+	DefaultConfirmTimeout = 5 * time.Second
+	DefaultMinBackoff     = 100 * time.Millisecond
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultHandlerRetries = 3
+	DefaultRetryBackoff   = time.Second
+)
+
+// headerPrefix is prepended to the names of the message header, following the
+// CloudEvents amqp binding
+const headerPrefix = "cloudEvents:"
+
+// DefaultRouter uses the subset as routing key, the exchange is the bucket
+var DefaultRouter = eventhus.MustTopicTemplate("{subset}")
+
+// Wildcard matches a word of a routing key, it needs a topic exchange
+const Wildcard = "*"
+
+// wildcard returns the wildcard of the exchanges, only the topic ones have it
+func (c *Client) wildcard() string {
+	if c.exchangeType == "topic" {
+		return Wildcard
+	}
+
+	return ""
+}
+
+// maxInFlight is the max quantity of unconfirmed events of a channel, the
+// confirmations are buffered so the connection is never blocked
+const maxInFlight = 256
+
+// Client rabbitmq, the channels are reused from a pool and every event is
+// published in confirm mode; the connection is restored when it drops
 type Client struct {
-	conn *amqp.Connection
+	url            string
+	vhost          string
+	exchangeType   string
+	poolSize       int
+	confirmTimeout time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	codec          eventhus.EventCodec
+	router         eventhus.Router
+	orderedGroups  bool
+	retries        int
+	retryBackoff   time.Duration
+	deadLetter     string
+	onError        func(error)
+	dial           func(url string) (connection, error)
+
+	mu            sync.Mutex
+	conn          connection
+	pool          chan *channel
+	declared      map[string]bool
+	subscriptions map[*subscription]bool
+	closed        bool
+}
+
+// Option customizes the rabbitmq client
+type Option func(*Client)
+
+// WithVHost connects to a virtual host
+func WithVHost(vhost string) Option {
+	return func(c *Client) {
+		c.vhost = vhost
+	}
+}
+
+// WithExchangeType sets the type of the exchanges: direct, topic or fanout
+func WithExchangeType(kind string) Option {
+	return func(c *Client) {
+		c.exchangeType = kind
+	}
+}
+
+// WithPoolSize sets the quantity of idle channels kept open
+func WithPoolSize(size int) Option {
+	return func(c *Client) {
+		c.poolSize = size
+	}
+}
+
+// WithConfirmTimeout sets the time to wait for the broker confirmation
+func WithConfirmTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.confirmTimeout = timeout
+	}
+}
+
+// WithReconnectBackoff sets the wait between reconnect attempts, it starts at min
+// and doubles up to max
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithCodec sets how the events are encoded
+func WithCodec(codec eventhus.EventCodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithRouter sets how the routing keys of the events are computed, the templates
+// that depend on the event need a topic exchange
+func WithRouter(router eventhus.Router) Option {
+	return func(c *Client) {
+		c.router = router
+	}
+}
+
+// WithOrderedGroups keeps the order of the events in the consumer groups, a
+// single member is active at a time
+func WithOrderedGroups() Option {
+	return func(c *Client) {
+		c.orderedGroups = true
+	}
+}
+
+// WithHandlerRetries sets how many times a failed event is handled again, waiting
+// backoff between attempts, before it's rejected without requeue
+func WithHandlerRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithDeadLetterExchange declares the queues with the exchange that gets the
+// rejected events, otherwise they're dropped
+func WithDeadLetterExchange(exchange string) Option {
+	return func(c *Client) {
+		c.deadLetter = exchange
+	}
+}
+
+// WithErrorHandler sets the func notified when a subscription can't decode a
+// message or rejects a failed event, the errors are logged by default
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.onError = handler
+	}
 }
 
 // NewClient returns a Client to acces to rabbitmq
 func NewClient(username, password, host string, port int) (*Client, error) {
-	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%d/", username, password, host, port))
-	return &Client{
-		conn: conn,
-	}, err
+	return NewClientWithOptions(username, password, host, port)
 }
 
-// Publish a event
-func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
-	ch, err := c.conn.Channel()
+// NewClientWithOptions returns a Client to acces to rabbitmq customized with options
+func NewClientWithOptions(username, password, host string, port int, options ...Option) (*Client, error) {
+	c := &Client{
+		vhost:          DefaultVHost,
+		exchangeType:   DefaultExchangeType,
+		poolSize:       DefaultPoolSize,
+		confirmTimeout: DefaultConfirmTimeout,
+		minBackoff:     DefaultMinBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		codec:          eventhus.JSONCodec{},
+		router:         DefaultRouter,
+		retries:        DefaultHandlerRetries,
+		retryBackoff:   DefaultRetryBackoff,
+		subscriptions:  make(map[*subscription]bool),
+		onError: func(err error) {
+			log.Println("rabbitmq: subscription failed:", err)
+		},
+		dial: dial,
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	c.url = uri(username, password, host, port, c.vhost)
+
+	conn, err := c.dial(c.url)
+	if err != nil {
+		return c, err
+	}
+
+	return c, c.setConnection(conn)
+}
+
+// uri returns the amqp URI, the default vhost is represented by an empty path
+func uri(username, password, host string, port int, vhost string) string {
+	if vhost == DefaultVHost {
+		vhost = ""
+	}
+
+	return fmt.Sprintf("amqp://%s@%s:%d/%s", url.UserPassword(username, password), host, port, url.PathEscape(vhost))
+}
+
+// setConnection replaces the connection, the channels and declarations of the
+// old one are discarded; the connection is closed when the client already is
+func (c *Client) setConnection(conn connection) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+
+	c.conn = conn
+	c.pool = make(chan *channel, c.poolSize)
+	c.declared = make(map[string]bool)
+	c.mu.Unlock()
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		// the channel is closed without error on a graceful Close
+		if err := <-closed; err != nil {
+			c.reconnect()
+		}
+	}()
+
+	return nil
+}
+
+// isClosed reports whether the client was closed
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// reconnect restores the connection until it succeeds or the client is closed,
+// the failed attempts are reported to the error handler
+func (c *Client) reconnect() {
+	backoff := c.minBackoff
+
+	for !c.isClosed() {
+		err := c.restore()
+		if err == nil || c.isClosed() {
+			return
+		}
+
+		c.onError(fmt.Errorf("reconnect: %w", err))
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// restore dials and starts the subscriptions again, the new connection is closed
+// when one of them fails so the next attempt starts them all from scratch
+func (c *Client) restore() error {
+	conn, err := c.dial(c.url)
 	if err != nil {
 		return err
 	}
 
-	defer ch.Close()
+	if err = c.setConnection(conn); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	subs := make([]*subscription, 0, len(c.subscriptions))
+	for sub := range c.subscriptions {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		if err = sub.start(); err != nil {
+			conn.Close()
+			return fmt.Errorf("subscribe to %s of %s: %w", sub.key, sub.exchange, err)
+		}
+	}
+
+	return nil
+}
+
+// Close the connection, the client can't be used afterwards
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
 
-	err = ch.ExchangeDeclare(
-		bucket,   // name
-		"direct", // type
-		true,     // durable
-		false,    // auto-deleted
-		false,    // internal
-		false,    // no-wait
-		nil,      // arguments
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+
+	return c.conn.Close()
+}
+
+// channel is an amqp channel in confirm mode
+type channel struct {
+	ch       amqpChannel
+	confirms chan amqp.Confirmation
+}
+
+// acquire a channel from the pool or open a new one
+func (c *Client) acquire() (*channel, connection, error) {
+	c.mu.Lock()
+	conn, pool, closed := c.conn, c.pool, c.closed
+	c.mu.Unlock()
+
+	if closed {
+		return nil, nil, ErrClosed
+	}
+
+	select {
+	case ch := <-pool:
+		return ch, conn, nil
+	default:
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	return &channel{
+		ch:       ch,
+		confirms: ch.NotifyPublish(make(chan amqp.Confirmation, maxInFlight)),
+	}, conn, nil
+}
+
+// release a channel back to the pool, it's closed if the pool is full or
+// it belongs to a previous connection
+func (c *Client) release(ch *channel, conn connection) {
+	c.mu.Lock()
+	current, pool := c.conn, c.pool
+	c.mu.Unlock()
+
+	if current == conn {
+		select {
+		case pool <- ch:
+			return
+		default:
+		}
+	}
+
+	ch.ch.Close()
+}
+
+// declare the exchange once per connection
+func (c *Client) declare(ch *channel, conn connection, exchange string) error {
+	c.mu.Lock()
+	declared := c.conn == conn && c.declared[exchange]
+	c.mu.Unlock()
+
+	if declared {
+		return nil
+	}
+
+	err := ch.ch.ExchangeDeclare(
+		exchange,       // name
+		c.exchangeType, // type
+		true,           // durable
+		false,          // auto-deleted
+		false,          // internal
+		false,          // no-wait
+		nil,            // arguments
 	)
 
 	if err != nil {
 		return err
 	}
 
-	body, err := json.Marshal(event)
+	c.mu.Lock()
+	if c.conn == conn {
+		c.declared[exchange] = true
+	}
+	c.mu.Unlock()
+
+	return nil
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// SetRouter sets how the routing keys of the events are computed
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.router = router
+}
+
+// Publish a event, it returns once the broker acknowledged it
+func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	return c.PublishBatch([]eventhus.BatchEvent{{Event: event, Bucket: bucket, Subset: subset}})
+}
+
+// PublishBatch publishes the events through a single channel and waits for
+// all the confirmations at once
+func (c *Client) PublishBatch(events []eventhus.BatchEvent) error {
+	keys := make([]string, len(events))
+	publishings := make([]amqp.Publishing, len(events))
+	for i, e := range events {
+		msg, err := c.codec.Encode(e.Event, e.Bucket, e.Subset)
+		if err != nil {
+			return err
+		}
+
+		if keys[i], err = c.router.Route(e.Event, e.Bucket, e.Subset); err != nil {
+			return err
+		}
+
+		var headers amqp.Table
+		if len(msg.Header) > 0 {
+			headers = make(amqp.Table, len(msg.Header))
+			for key, value := range msg.Header {
+				headers[headerPrefix+key] = value
+			}
+		}
+
+		publishings[i] = amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  msg.ContentType,
+			Headers:      headers,
+			Body:         msg.Body,
+		}
+	}
+
+	ch, conn, err := c.acquire()
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(events); start += maxInFlight {
+		end := start + maxInFlight
+		if end > len(events) {
+			end = len(events)
+		}
+
+		if err = c.publish(ch, conn, events[start:end], keys[start:end], publishings[start:end]); err != nil {
+			// a failed declaration closes the channel and a late confirmation
+			// would be taken by the next publisher
+			ch.ch.Close()
+			return err
+		}
+	}
+
+	c.release(ch, conn)
+	return nil
+}
+
+// publish the events and wait for their confirmations
+func (c *Client) publish(ch *channel, conn connection, events []eventhus.BatchEvent, keys []string, publishings []amqp.Publishing) error {
+	for i, e := range events {
+		if err := c.declare(ch, conn, e.Bucket); err != nil {
+			return err
+		}
+
+		err := ch.ch.Publish(
+			e.Bucket, // exchange
+			keys[i],  // routing key
+			false,    // mandatory
+			false,    // immediate
+			publishings[i],
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.wait(ch, len(events))
+}
+
+// wait for n confirmations of the channel
+func (c *Client) wait(ch *channel, n int) error {
+	timeout := time.NewTimer(c.confirmTimeout)
+	defer timeout.Stop()
+
+	var err error
+	for i := 0; i < n; i++ {
+		select {
+		case confirm, ok := <-ch.confirms:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			if !confirm.Ack {
+				err = ErrNack
+			}
+		case <-timeout.C:
+			return ErrConfirmTimeout
+		}
+	}
+
+	return err
+}
+
+// subscription consumes the events of an exchange with a routing key, it's
+// started again when the client reconnects
+type subscription struct {
+	client        *Client
+	exchange, key string
+	group         string
+	handler       eventhus.EventHandle
+	mu            sync.Mutex
+	ch            amqpChannel
+	tag           string
+	closed        bool
+}
+
+// Close the subscription and its channel
+func (s *subscription) Close() error {
+	s.client.mu.Lock()
+	delete(s.client.subscriptions, s)
+	s.client.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+	if s.ch == nil {
+		return nil
+	}
+
+	if err := s.ch.Cancel(s.tag, false); err != nil {
+		return err
+	}
+
+	return s.ch.Close()
+}
+
+// start consuming through a new channel of the current connection, the lock is
+// held so a reconnect doesn't start a subscription closed meanwhile
+func (s *subscription) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.client.mu.Lock()
+	conn := s.client.conn
+	s.client.mu.Unlock()
+
+	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 
-	err = ch.Publish(
-		bucket, // exchange
-		subset, // routing key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/plain",
-			Body:         body,
-		},
-	)
+	deliveries, tag, err := s.consume(ch)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	// the previous channel belongs to a dropped connection, or to this one when
+	// a reconnect raced the subscribe
+	if s.ch != nil {
+		s.ch.Close()
+	}
+
+	s.ch = ch
+	s.tag = tag
+
+	register := eventhus.NewEventRegister()
+	go func() {
+		for d := range deliveries {
+			event, err := s.client.codec.Decode(message(d), register)
+			if err != nil {
+				s.client.onError(fmt.Errorf("decode message of %s: %w", d.RoutingKey, err))
+				d.Reject(false)
+				continue
+			}
+
+			if err = s.handle(event); err != nil {
+				s.client.onError(fmt.Errorf("handle event %s of %s: %w", event.ID, d.RoutingKey, err))
+				d.Reject(false)
+				continue
+			}
+
+			d.Ack(false)
+		}
+	}()
+
+	return nil
+}
+
+// handle the event, it's retried in place so a failed event isn't redelivered
+// in a loop
+func (s *subscription) handle(event eventhus.Event) error {
+	err := s.handler.Handle(event)
+	for attempt := 0; err != nil && attempt < s.client.retries; attempt++ {
+		time.Sleep(s.client.retryBackoff)
+		err = s.handler.Handle(event)
+	}
 
 	return err
 }
+
+// message converts a delivery to the message decoded by the codec
+func message(d amqp.Delivery) eventhus.Message {
+	m := eventhus.Message{
+		ContentType: d.ContentType,
+		Body:        d.Body,
+	}
+
+	for key, value := range d.Headers {
+		if !strings.HasPrefix(key, headerPrefix) {
+			continue
+		}
+
+		if m.Header == nil {
+			m.Header = make(map[string]string)
+		}
+		m.Header[key[len(headerPrefix):]] = fmt.Sprint(value)
+	}
+
+	return m
+}
+
+// Subscribe to the events published to bucket and subset with an exclusive queue
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	key, err := c.router.Pattern(bucket, subset, c.wildcard())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SubscribeRoutingKey(bucket, key, handler)
+}
+
+// SubscribeGroup joins the consumer group, its members share a durable queue
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	key, err := c.router.Pattern(bucket, subset, c.wildcard())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(group, bucket, key, handler)
+}
+
+// SubscribeRoutingKey subscribes to the events of exchange with the routing key,
+// it can contain wildcards when the exchanges are of topic type
+func (c *Client) SubscribeRoutingKey(exchange, key string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe("", exchange, key, handler)
+}
+
+// subscribe with an exclusive queue, or the shared queue of the group when it
+// isn't empty
+func (c *Client) subscribe(group, exchange, key string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	sub := &subscription{
+		client:   c,
+		exchange: exchange,
+		key:      key,
+		group:    group,
+		handler:  handler,
+	}
+
+	// it's registered first so a reconnect meanwhile starts it again
+	c.mu.Lock()
+	c.subscriptions[sub] = true
+	c.mu.Unlock()
+
+	if err := sub.start(); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// GroupQueue is the name of the queue shared by the members of a group
+func GroupQueue(group, exchange, key string) string {
+	return group + "." + exchange + "." + key
+}
+
+func (s *subscription) consume(ch amqpChannel) (<-chan amqp.Delivery, string, error) {
+	err := ch.ExchangeDeclare(
+		s.exchange,            // name
+		s.client.exchangeType, // type
+		true,                  // durable
+		false,                 // auto-deleted
+		false,                 // internal
+		false,                 // no-wait
+		nil,                   // arguments
+	)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := amqp.Table{}
+	if s.client.deadLetter != "" {
+		args["x-dead-letter-exchange"] = s.client.deadLetter
+	}
+
+	var q amqp.Queue
+	shared := s.group != ""
+	if shared {
+		if s.client.orderedGroups {
+			args["x-single-active-consumer"] = true
+		}
+
+		q, err = ch.QueueDeclare(
+			GroupQueue(s.group, s.exchange, s.key), // name
+			true,                                   // durable
+			false,                                  // delete when unused
+			false,                                  // exclusive
+			false,                                  // no-wait
+			args,                                   // arguments
+		)
+	} else {
+		q, err = ch.QueueDeclare(
+			"",    // name, generated by the server
+			false, // durable
+			true,  // delete when unused
+			true,  // exclusive
+			false, // no-wait
+			args,  // arguments
+		)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = ch.QueueBind(
+		q.Name,     // queue name
+		s.key,      // routing key
+		s.exchange, // exchange
+		false,      // no-wait
+		nil,        // arguments
+	)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	tag := "eventhus-" + q.Name
+	deliveries, err := ch.Consume(
+		q.Name,  // queue
+		tag,     // consumer
+		false,   // auto-ack
+		!shared, // exclusive
+		false,   // no-local
+		false,   // no-wait
+		nil,     // args
+	)
+
+	return deliveries, tag, err
+}
@@ -0,0 +1,428 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+	"github.com/mishudark/eventhus/utils"
+)
+
+// Default settings of the client
+const (
+	DefaultGroup     = "eventhus"
+	DefaultMaxLen    = 100000
+	DefaultClaimIdle = time.Minute
+	DefaultBlock     = time.Second
+	// DefaultMaxDeliveries is the default quantity of deliveries of an entry
+	// before it's given up
+	DefaultMaxDeliveries = 10
+	// eventField is the field of the stream entries that holds the event
+	eventField = "event"
+	// contentTypeField holds the content type of the event
+	contentTypeField = "content-type"
+	// headerPrefix is prepended to the fields that hold the message header
+	headerPrefix = "ce_"
+)
+
+// Client redis, the events are appended to the stream `bucket:subset` and
+// consumed by consumer groups
+type Client struct {
+	rdb       *redis.Client
+	maxLen    int64
+	group     string
+	consumer  string
+	claimIdle time.Duration
+	block     time.Duration
+	codec     eventhus.EventCodec
+	router    eventhus.Router
+	// deliveries is the max quantity of deliveries of an entry
+	deliveries int64
+	deadLetter string
+	onError    func(error)
+}
+
+// DefaultRouter appends the events to the stream `bucket:subset`
+var DefaultRouter = eventhus.MustTopicTemplate("{bucket}:{subset}")
+
+// Option customizes the redis client
+type Option func(*Client)
+
+// WithMaxLen trims the streams to approximately maxLen entries, zero disables it
+func WithMaxLen(maxLen int64) Option {
+	return func(c *Client) {
+		c.maxLen = maxLen
+	}
+}
+
+// WithCodec sets how the events are encoded
+func WithCodec(codec eventhus.EventCodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// WithRouter sets the stream of the events, redis has no wildcards so Subscribe
+// fails with the templates that depend on the event
+func WithRouter(router eventhus.Router) Option {
+	return func(c *Client) {
+		c.router = router
+	}
+}
+
+// WithGroup sets the consumer group used by Subscribe
+func WithGroup(group string) Option {
+	return func(c *Client) {
+		c.group = group
+	}
+}
+
+// WithConsumer sets the name of this consumer inside the group, a stable name
+// lets a restarted process resume its pending entries
+func WithConsumer(consumer string) Option {
+	return func(c *Client) {
+		c.consumer = consumer
+	}
+}
+
+// WithClaimIdle sets the time after which the entries pending in a crashed
+// consumer are claimed by another one
+func WithClaimIdle(idle time.Duration) Option {
+	return func(c *Client) {
+		c.claimIdle = idle
+	}
+}
+
+// WithBlock sets the max time a read waits for new entries
+func WithBlock(block time.Duration) Option {
+	return func(c *Client) {
+		c.block = block
+	}
+}
+
+// WithMaxDeliveries sets how many times an entry is delivered before it's given
+// up, zero keeps delivering it
+func WithMaxDeliveries(deliveries int64) Option {
+	return func(c *Client) {
+		c.deliveries = deliveries
+	}
+}
+
+// WithDeadLetterStream sets the stream that gets the entries given up
+func WithDeadLetterStream(stream string) Option {
+	return func(c *Client) {
+		c.deadLetter = stream
+	}
+}
+
+// WithErrorHandler sets the func notified when a subscription fails, the errors
+// are logged by default
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.onError = handler
+	}
+}
+
+// NewClient returns a client for the redis server
+func NewClient(opts *redis.Options, options ...Option) (*Client, error) {
+	c := &Client{
+		rdb:        redis.NewClient(opts),
+		maxLen:     DefaultMaxLen,
+		group:      DefaultGroup,
+		claimIdle:  DefaultClaimIdle,
+		block:      DefaultBlock,
+		codec:      eventhus.JSONCodec{},
+		router:     DefaultRouter,
+		deliveries: DefaultMaxDeliveries,
+		onError: func(err error) {
+			log.Println("redis: subscription failed:", err)
+		},
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	if c.consumer == "" {
+		id, err := utils.UUID()
+		if err != nil {
+			return nil, err
+		}
+
+		c.consumer = id
+	}
+
+	if err := c.rdb.Ping(context.Background()).Err(); err != nil {
+		c.rdb.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close the connection
+func (c *Client) Close() error {
+	return c.rdb.Close()
+}
+
+// Stream returns the stream of a bucket and subset with the DefaultRouter
+func Stream(bucket, subset string) string {
+	return bucket + ":" + subset
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// SetRouter sets the stream of the events
+func (c *Client) SetRouter(router eventhus.Router) {
+	c.router = router
+}
+
+// Publish a event
+func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	msg, err := c.codec.Encode(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{
+		eventField:       msg.Body,
+		contentTypeField: msg.ContentType,
+	}
+
+	for key, value := range msg.Header {
+		values[headerPrefix+key] = value
+	}
+
+	stream, err := c.router.Route(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	args := &redis.XAddArgs{
+		Stream: stream,
+		Values: values,
+	}
+
+	if c.maxLen > 0 {
+		args.MaxLen = c.maxLen
+		args.Approx = true
+	}
+
+	return c.rdb.XAdd(context.Background(), args).Err()
+}
+
+// Subscribe to the events of bucket and subset as part of the consumer group,
+// an entry is acknowledged once the handler succeeds
+func (c *Client) Subscribe(bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	stream, err := c.router.Pattern(bucket, subset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SubscribeTopic(stream, handler)
+}
+
+// SubscribeGroup joins the consumer group, every entry is delivered to a single member
+func (c *Client) SubscribeGroup(group, bucket, subset string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	stream, err := c.router.Pattern(bucket, subset, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.subscribe(group, stream, handler)
+}
+
+// SubscribeTopic subscribes to a stream as part of the consumer group
+func (c *Client) SubscribeTopic(stream string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	return c.subscribe(c.group, stream, handler)
+}
+
+func (c *Client) subscribe(group, stream string, handler eventhus.EventHandle) (eventhus.Subscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := c.rdb.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		cancel()
+		return nil, err
+	}
+
+	sub := &subscription{
+		cancel: cancel,
+	}
+
+	s := &consumer{
+		Client:   c,
+		group:    group,
+		stream:   stream,
+		handler:  handler,
+		register: eventhus.NewEventRegister(),
+	}
+
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		s.run(ctx)
+	}()
+
+	return sub, nil
+}
+
+type subscription struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Close stops reading, it waits for the current read to finish
+func (s *subscription) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+type consumer struct {
+	*Client
+	group    string
+	stream   string
+	handler  eventhus.EventHandle
+	register eventhus.EventTypeRegister
+}
+
+func (c *consumer) run(ctx context.Context) {
+	// the entries left pending by a previous run of this consumer
+	c.read(ctx, "0")
+
+	for ctx.Err() == nil {
+		c.claim(ctx)
+		c.read(ctx, ">")
+	}
+}
+
+// read the entries from id, `>` reads the new ones and `0` the pending ones
+func (c *consumer) read(ctx context.Context, id string) {
+	streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, id},
+		Count:    100,
+		Block:    c.block,
+	}).Result()
+
+	if err != nil {
+		if err != redis.Nil && ctx.Err() == nil {
+			c.onError(fmt.Errorf("read %s: %w", c.stream, err))
+			time.Sleep(c.block)
+		}
+		return
+	}
+
+	for _, stream := range streams {
+		c.handle(ctx, stream.Messages)
+	}
+}
+
+// claim the entries pending in other consumers for too long
+func (c *consumer) claim(ctx context.Context) {
+	messages, _, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		MinIdle:  c.claimIdle,
+		Start:    "0-0",
+		Count:    100,
+	}).Result()
+
+	if err != nil {
+		if err != redis.Nil && ctx.Err() == nil {
+			c.onError(fmt.Errorf("claim %s: %w", c.stream, err))
+		}
+		return
+	}
+
+	c.handle(ctx, messages)
+}
+
+// message converts a stream entry to the message decoded by the codec
+func message(msg redis.XMessage) eventhus.Message {
+	blob, _ := msg.Values[eventField].(string)
+	contentType, _ := msg.Values[contentTypeField].(string)
+
+	m := eventhus.Message{
+		ContentType: contentType,
+		Body:        []byte(blob),
+	}
+
+	for key, value := range msg.Values {
+		if !strings.HasPrefix(key, headerPrefix) {
+			continue
+		}
+
+		if m.Header == nil {
+			m.Header = make(map[string]string)
+		}
+		m.Header[key[len(headerPrefix):]], _ = value.(string)
+	}
+
+	return m
+}
+
+func (c *consumer) handle(ctx context.Context, messages []redis.XMessage) {
+	for _, msg := range messages {
+		event, err := c.codec.Decode(message(msg), c.register)
+		if err != nil {
+			// it will never be handled
+			c.giveUp(ctx, msg, fmt.Errorf("decode entry %s of %s: %w", msg.ID, c.stream, err))
+			continue
+		}
+
+		if err = c.handler.Handle(event); err != nil {
+			// it stays pending until it's claimed again
+			deliveries := c.deliveryCount(ctx, msg.ID)
+			if c.deliveries > 0 && deliveries >= c.deliveries {
+				c.giveUp(ctx, msg, fmt.Errorf("handle event %s of %s: %w", event.ID, c.stream, &eventbus.AttemptsError{Err: err, Attempts: int(deliveries)}))
+			}
+			continue
+		}
+
+		c.rdb.XAck(ctx, c.stream, c.group, msg.ID)
+	}
+}
+
+// deliveryCount returns the times the pending entry was delivered
+func (c *consumer) deliveryCount(ctx context.Context, id string) int64 {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+
+	return pending[0].RetryCount
+}
+
+// giveUp moves the entry to the dead letter stream, acknowledges and reports it
+func (c *consumer) giveUp(ctx context.Context, msg redis.XMessage, err error) {
+	if c.deadLetter != "" {
+		if dlErr := c.rdb.XAdd(ctx, &redis.XAddArgs{Stream: c.deadLetter, Values: msg.Values}).Err(); dlErr != nil {
+			// it stays pending, so it isn't lost
+			c.onError(fmt.Errorf("dead letter entry %s of %s: %w", msg.ID, c.stream, dlErr))
+			return
+		}
+	}
+
+	c.rdb.XAck(ctx, c.stream, c.group, msg.ID)
+	c.onError(err)
+}
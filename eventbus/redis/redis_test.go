@@ -0,0 +1,322 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/eventbus"
+	"github.com/mishudark/eventhus/eventbus/cloudevents"
+)
+
+type ItemAdded struct {
+	SKU string `json:"sku"`
+}
+
+func newClient(t *testing.T, s *miniredis.Miniredis, options ...Option) *Client {
+	options = append([]Option{WithBlock(20 * time.Millisecond)}, options...)
+
+	cli, err := NewClient(&redis.Options{Addr: s.Addr()}, options...)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return cli
+}
+
+func TestClientPublishTrimsStream(t *testing.T) {
+	s := miniredis.RunT(t)
+	cli := newClient(t, s, WithMaxLen(2))
+	defer cli.Close()
+
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	for i := 0; i < 5; i++ {
+		if err := cli.Publish(eventhus.Event{AggregateID: "1", Version: i, Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	// miniredis trims exactly, redis may keep a few more entries with ~
+	entries, err := cli.rdb.XRange(context.Background(), "shop:cart", "-", "+").Result()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatal("expected 2 entries, got", len(entries))
+	}
+
+	register := eventhus.NewEventRegister()
+	for i, entry := range entries {
+		event, err := cli.codec.Decode(message(entry), register)
+		if err != nil || event.Version != i+3 {
+			t.Errorf("expected version %d, got %d and %v", i+3, event.Version, err)
+		}
+	}
+}
+
+func TestClientSubscribe(t *testing.T) {
+	s := miniredis.RunT(t)
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	received := make(chan eventhus.Event, 1)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	event := eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{SKU: "123"}}
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	select {
+	case e := <-received:
+		if data, ok := e.Data.(*ItemAdded); !ok || data.SKU != "123" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the event was not received")
+	}
+
+	// wait for the ack
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		pending, _ := cli.rdb.XPending(context.Background(), "shop:cart", DefaultGroup).Result()
+		if pending.Count == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Error("expected the entry to be acknowledged")
+}
+
+func TestClientClaimsPendingEntries(t *testing.T) {
+	s := miniredis.RunT(t)
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	crashed := newClient(t, s, WithConsumer("crashed"))
+	defer crashed.Close()
+
+	failed := make(chan bool, 1)
+	sub, err := crashed.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		select {
+		case failed <- true:
+		default:
+		}
+		return errors.New("crashed")
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	crashed.Publish(eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart")
+	<-failed
+	sub.Close()
+
+	var mu sync.Mutex
+	var received []string
+
+	healthy := newClient(t, s, WithConsumer("healthy"), WithClaimIdle(time.Millisecond))
+	defer healthy.Close()
+
+	sub, err = healthy.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		mu.Lock()
+		received = append(received, event.ID)
+		mu.Unlock()
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		count := len(received)
+		mu.Unlock()
+
+		if count > 0 {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("the pending entry was not claimed")
+}
+
+func TestClientSubscribeGroup(t *testing.T) {
+	s := miniredis.RunT(t)
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	received := make(chan string, 10)
+	for _, member := range []string{"a", "b"} {
+		cli := newClient(t, s, WithConsumer(member))
+		defer cli.Close()
+
+		sub, err := cli.SubscribeGroup("projection", "shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+			received <- event.ID
+			return nil
+		}))
+
+		if err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+		defer sub.Close()
+	}
+
+	cli := newClient(t, s)
+	defer cli.Close()
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if err := cli.Publish(eventhus.Event{ID: id, Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		select {
+		case id := <-received:
+			if seen[id] {
+				t.Error("the event was delivered twice", id)
+			}
+			seen[id] = true
+		case <-time.After(time.Second):
+			t.Fatal("the events were not received")
+		}
+	}
+
+	// only the group of the members was created
+	groups, err := cli.rdb.XInfoGroups(context.Background(), "shop:cart").Result()
+	if err != nil || len(groups) != 1 || groups[0].Name != "projection" {
+		t.Errorf("expected the projection group, got %v and %v", groups, err)
+	}
+}
+
+func TestClientBinaryCodecRoundTrip(t *testing.T) {
+	s := miniredis.RunT(t)
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	cli := newClient(t, s, WithCodec(cloudevents.NewCodec(cloudevents.Binary)))
+	defer cli.Close()
+
+	received := make(chan eventhus.Event, 1)
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		received <- event
+		return nil
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	event := eventhus.Event{
+		ID:            "1",
+		AggregateID:   "cart-1",
+		AggregateType: "Cart",
+		Type:          "ItemAdded",
+		Version:       3,
+		Metadata:      map[string]string{"tenant": "acme"},
+		Data:          &ItemAdded{SKU: "123"},
+	}
+
+	if err = cli.Publish(event, "shop", "cart"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	entries, _ := cli.rdb.XRange(context.Background(), "shop:cart", "-", "+").Result()
+	if len(entries) != 1 || entries[0].Values["ce_id"] != "1" {
+		t.Fatalf("expected the attributes in the entry fields, got %+v", entries)
+	}
+
+	select {
+	case e := <-received:
+		data, ok := e.Data.(*ItemAdded)
+		if !ok || data.SKU != "123" || e.ID != "1" || e.AggregateID != "cart-1" || e.Version != 3 || e.Metadata["tenant"] != "acme" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the event was not received")
+	}
+}
+
+func TestClientGivesUpFailedEntries(t *testing.T) {
+	s := miniredis.RunT(t)
+	eventhus.NewEventRegister().Set(ItemAdded{})
+
+	reported := make(chan error, 10)
+	cli := newClient(t, s,
+		WithClaimIdle(time.Millisecond),
+		WithMaxDeliveries(3),
+		WithDeadLetterStream("shop:cart:dead"),
+		WithErrorHandler(func(err error) { reported <- err }),
+	)
+	defer cli.Close()
+
+	var mu sync.Mutex
+	attempts := 0
+	sub, err := cli.Subscribe("shop", "cart", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		return errors.New("read model unavailable")
+	}))
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer sub.Close()
+
+	ctx := context.Background()
+	cli.rdb.XAdd(ctx, &redis.XAddArgs{Stream: "shop:cart", Values: map[string]interface{}{eventField: "not json"}})
+	cli.Publish(eventhus.Event{ID: "1", Type: "ItemAdded", Data: &ItemAdded{}}, "shop", "cart")
+
+	var attemptsErr *eventbus.AttemptsError
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-reported:
+			if errors.As(err, &attemptsErr) && attemptsErr.Attempts != 3 {
+				t.Errorf("expected 3 attempts, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected 2 errors, got", i)
+		}
+	}
+
+	if attemptsErr == nil {
+		t.Error("expected the failed event to be reported")
+	}
+
+	mu.Lock()
+	if attempts != 3 {
+		t.Error("expected 3 attempts, got", attempts)
+	}
+	mu.Unlock()
+
+	dead, _ := cli.rdb.XLen(ctx, "shop:cart:dead").Result()
+	pending, _ := cli.rdb.XPending(ctx, "shop:cart", DefaultGroup).Result()
+	if dead != 2 || pending.Count != 0 {
+		t.Errorf("expected 2 dead letters and no pending entries, got %d and %d", dead, pending.Count)
+	}
+}
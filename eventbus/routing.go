@@ -0,0 +1,183 @@
+package eventbus
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/mishudark/eventhus"
+)
+
+// ErrNoRoute is returned when no route matches an event and there is no fallback
+var ErrNoRoute = errors.New("no route matches the event")
+
+// Rule selects events, the empty fields match everything and all the set ones
+// must match; an EventBatch matches EventTypes when one of its events does
+type Rule struct {
+	EventTypes     []string
+	AggregateTypes []string
+	Bucket         string
+	Subset         string
+	// Metadata values the event must have
+	Metadata map[string]string
+	// Match is an extra predicate
+	Match func(event eventhus.Event, bucket, subset string) bool
+}
+
+// Matches reports whether the event published to bucket and subset matches the rule
+func (r Rule) Matches(event eventhus.Event, bucket, subset string) bool {
+	if r.Bucket != "" && r.Bucket != bucket {
+		return false
+	}
+
+	if r.Subset != "" && r.Subset != subset {
+		return false
+	}
+
+	if len(r.EventTypes) > 0 && !matchesType(r.EventTypes, event) {
+		return false
+	}
+
+	if len(r.AggregateTypes) > 0 && !contains(r.AggregateTypes, event.AggregateType) {
+		return false
+	}
+
+	for key, value := range r.Metadata {
+		if v, ok := event.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return r.Match == nil || r.Match(event, bucket, subset)
+}
+
+// matchesType reports whether the event, or one of the events of a batch, has
+// one of types
+func matchesType(types []string, event eventhus.Event) bool {
+	if contains(types, event.Type) {
+		return true
+	}
+
+	batch, ok := event.Data.(*eventhus.EventBatch)
+	if !ok || event.Type != eventhus.EventBatchType {
+		return false
+	}
+
+	for _, e := range batch.Events {
+		if contains(types, e.Type) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Route sends the events matching Rule to Publishers
+type Route struct {
+	Rule       Rule
+	Publishers []eventhus.EventBus
+}
+
+// RoutingBus sends every event to the publishers of the routes it matches, the
+// others go to the fallback publishers
+type RoutingBus struct {
+	routes   []Route
+	fallback []eventhus.EventBus
+}
+
+// NewRoutingBus returns a bus that dispatches the events through routes, the
+// nil publishers are skipped
+func NewRoutingBus(routes []Route, fallback ...eventhus.EventBus) *RoutingBus {
+	b := &RoutingBus{
+		routes:   make([]Route, len(routes)),
+		fallback: withoutNil(fallback),
+	}
+
+	for i, route := range routes {
+		b.routes[i] = Route{Rule: route.Rule, Publishers: withoutNil(route.Publishers)}
+	}
+
+	return b
+}
+
+// withoutNil returns the publishers that aren't nil
+func withoutNil(publishers []eventhus.EventBus) []eventhus.EventBus {
+	var kept []eventhus.EventBus
+	for _, p := range publishers {
+		if p != nil {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
+
+// Publishers returns the publishers that receive an event
+func (b *RoutingBus) Publishers(event eventhus.Event, bucket, subset string) []eventhus.EventBus {
+	var publishers []eventhus.EventBus
+	seen := make(map[eventhus.EventBus]bool)
+
+	for _, route := range b.routes {
+		if !route.Rule.Matches(event, bucket, subset) {
+			continue
+		}
+
+		for _, p := range route.Publishers {
+			// only the comparable publishers can be used as keys
+			if reflect.TypeOf(p).Comparable() {
+				if seen[p] {
+					continue
+				}
+				seen[p] = true
+			}
+
+			publishers = append(publishers, p)
+		}
+	}
+
+	if len(publishers) == 0 {
+		return b.fallback
+	}
+
+	return publishers
+}
+
+// Publish an event through the publishers of the matching routes, the errors
+// are returned in a MultiPublisherError
+func (b *RoutingBus) Publish(event eventhus.Event, bucket, subset string) error {
+	publishers := b.Publishers(event, bucket, subset)
+	if len(publishers) == 0 {
+		return ErrNoRoute
+	}
+
+	errs := MultiPublisherError{}
+	for _, p := range publishers {
+		errs.Add(p.Publish(event, bucket, subset))
+	}
+
+	if errs.Len() > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// discard drops the events
+type discard struct{}
+
+func (discard) Publish(event eventhus.Event, bucket, subset string) error {
+	return nil
+}
+
+// Discard is a publisher that drops the events, it can be used as fallback to
+// ignore the events without route
+var Discard eventhus.EventBus = discard{}
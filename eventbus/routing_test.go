@@ -0,0 +1,127 @@
+package eventbus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mishudark/eventhus"
+)
+
+func TestRoutingBus(t *testing.T) {
+	kafka := &producerStub{}
+	mqtt := &producerStub{}
+	fallback := &producerStub{}
+
+	sut := NewRoutingBus([]Route{
+		{Rule: Rule{AggregateTypes: []string{"Account"}}, Publishers: []eventhus.EventBus{kafka}},
+		{Rule: Rule{EventTypes: []string{"WithdrawalPerformed"}}, Publishers: []eventhus.EventBus{kafka, mqtt}},
+		{Rule: Rule{Metadata: map[string]string{"notify": "true"}}, Publishers: []eventhus.EventBus{mqtt}},
+	}, fallback)
+
+	events := []eventhus.Event{
+		{AggregateType: "Account", Type: "AccountCreated"},
+		{AggregateType: "Account", Type: "WithdrawalPerformed"},
+		{AggregateType: "Transfer", Type: "TransferSent", Metadata: map[string]string{"notify": "true"}},
+		{AggregateType: "Transfer", Type: "TransferReceived"},
+	}
+
+	for _, event := range events {
+		if err := sut.Publish(event, "bank", "account"); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	if len(kafka.entries) != 2 {
+		t.Error("expected 2 events, got", len(kafka.entries))
+	}
+
+	if len(mqtt.entries) != 2 {
+		t.Error("expected 2 events, got", len(mqtt.entries))
+	}
+
+	if len(fallback.entries) != 1 || fallback.entries[0].event.Type != "TransferReceived" {
+		t.Errorf("unexpected fallback entries %+v", fallback.entries)
+	}
+}
+
+func TestRoutingBusBucketAndPredicate(t *testing.T) {
+	big := &producerStub{}
+	sut := NewRoutingBus([]Route{
+		{
+			Rule: Rule{
+				Bucket: "bank",
+				Subset: "account",
+				Match: func(event eventhus.Event, bucket, subset string) bool {
+					return event.Version > 10
+				},
+			},
+			Publishers: []eventhus.EventBus{big},
+		},
+	}, Discard)
+
+	sut.Publish(eventhus.Event{Version: 11}, "bank", "account")
+	sut.Publish(eventhus.Event{Version: 11}, "bank", "transfer")
+	sut.Publish(eventhus.Event{Version: 1}, "bank", "account")
+
+	if len(big.entries) != 1 {
+		t.Error("expected 1 event, got", len(big.entries))
+	}
+}
+
+func TestRoutingBusErrors(t *testing.T) {
+	sut := NewRoutingBus([]Route{
+		{Rule: Rule{EventTypes: []string{"AccountCreated"}}, Publishers: []eventhus.EventBus{
+			&producerStub{err: errors.New("expected error")},
+		}},
+	})
+
+	if err := sut.Publish(eventhus.Event{Type: "TransferSent"}, "bank", "account"); err != ErrNoRoute {
+		t.Errorf("expected %v, got %v", ErrNoRoute, err)
+	}
+
+	err := sut.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account")
+	if errs, ok := err.(MultiPublisherError); !ok || errs.Len() != 1 {
+		t.Error("expected a MultiPublisherError, got", err)
+	}
+}
+
+func TestRoutingBusSkipsNilPublishers(t *testing.T) {
+	kafka := &producerStub{}
+	sut := NewRoutingBus([]Route{
+		{Rule: Rule{EventTypes: []string{"AccountCreated"}}, Publishers: []eventhus.EventBus{nil, kafka}},
+		{Rule: Rule{EventTypes: []string{"TransferSent"}}, Publishers: []eventhus.EventBus{nil}},
+	}, nil)
+
+	if err := sut.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(kafka.entries) != 1 {
+		t.Error("expected 1 event, got", len(kafka.entries))
+	}
+
+	if err := sut.Publish(eventhus.Event{Type: "TransferSent"}, "bank", "account"); err != ErrNoRoute {
+		t.Errorf("expected %v, got %v", ErrNoRoute, err)
+	}
+}
+
+func TestRuleMatchesEventsOfBatch(t *testing.T) {
+	rule := Rule{EventTypes: []string{"FeeCharged"}}
+
+	batch, err := eventhus.NewBatchEvent([]eventhus.Event{
+		{AggregateID: "1", Type: "WithdrawalPerformed", Version: 1},
+		{AggregateID: "1", Type: "FeeCharged", Version: 2},
+	})
+
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if !rule.Matches(batch, "bank", "account") {
+		t.Error("expected the batch to match its FeeCharged event")
+	}
+
+	if (Rule{EventTypes: []string{"AccountCreated"}}).Matches(batch, "bank", "account") {
+		t.Error("expected the batch not to match")
+	}
+}
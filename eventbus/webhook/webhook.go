@@ -0,0 +1,521 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/utils"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Eventhus-Signature"
+	TimestampHeader = "X-Eventhus-Timestamp"
+	DeliveryHeader  = "X-Eventhus-Delivery"
+	EventTypeHeader = "X-Eventhus-Event-Type"
+	// headerPrefix is prepended to the names of the message header, following
+	// the CloudEvents http binding
+	headerPrefix = "ce-"
+)
+
+// Default settings of the client, Publish is in the command path so the
+// deliveries are retried briefly, Redeliver sends the failed ones later
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = 500 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+	DefaultTimeout     = 5 * time.Second
+	DefaultMaxElapsed  = 2 * time.Second
+	DefaultTolerance   = 5 * time.Minute
+	DefaultMaxFailures = 10000
+)
+
+// ErrInvalidSignature is returned by Verify when the signature doesn't match the body
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// ErrStaleTimestamp is returned by Verify when the timestamp of the delivery is
+// missing or out of the tolerance, it may be a replay
+var ErrStaleTimestamp = errors.New("webhook: stale timestamp")
+
+// ErrUnknownEndpoint is the error of a delivery whose endpoint isn't configured anymore
+var ErrUnknownEndpoint = errors.New("webhook: unknown endpoint")
+
+// ErrFailureStoreFull is returned by MemoryFailureStore when it holds its max deliveries
+var ErrFailureStoreFull = errors.New("webhook: failure store full")
+
+// Endpoint is an URL that receives the events of a bucket and subset, empty
+// fields match everything
+type Endpoint struct {
+	Name       string
+	URL        string
+	Secret     string
+	Bucket     string
+	Subset     string
+	EventTypes []string
+}
+
+// name returns the reference of the endpoint kept by its deliveries
+func (e Endpoint) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+
+	return e.URL
+}
+
+// Matches reports whether the event published to bucket and subset must be sent to the endpoint
+func (e Endpoint) Matches(event eventhus.Event, bucket, subset string) bool {
+	if e.Bucket != "" && e.Bucket != bucket {
+		return false
+	}
+
+	if e.Subset != "" && e.Subset != subset {
+		return false
+	}
+
+	if len(e.EventTypes) == 0 {
+		return true
+	}
+
+	for _, eventType := range e.EventTypes {
+		if eventType == event.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Delivery is an event that couldn't be delivered to the endpoint named Endpoint
+type Delivery struct {
+	ID          string            `json:"id"`
+	Endpoint    string            `json:"endpoint"`
+	URL         string            `json:"url"`
+	Bucket      string            `json:"bucket"`
+	Subset      string            `json:"subset"`
+	EventType   string            `json:"event_type"`
+	ContentType string            `json:"content_type"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body"`
+	Attempts    int               `json:"attempts"`
+	Error       string            `json:"error"`
+	FailedAt    time.Time         `json:"failed_at"`
+}
+
+// FailureStore persists the failed deliveries until they are delivered again
+type FailureStore interface {
+	Save(delivery Delivery) error
+	Remove(id string) error
+	All() ([]Delivery, error)
+}
+
+// DeliveryError is returned by Publish when the event couldn't be delivered to
+// some endpoints, the deliveries are kept in the FailureStore
+type DeliveryError struct {
+	Deliveries []Delivery
+}
+
+func (e *DeliveryError) Error() string {
+	urls := make([]string, len(e.Deliveries))
+	for i, delivery := range e.Deliveries {
+		urls[i] = delivery.URL + ": " + delivery.Error
+	}
+
+	return "webhook: delivery failed to " + strings.Join(urls, ", ")
+}
+
+// Client webhook, it POSTs the events to the endpoints that match them
+type Client struct {
+	endpoints   []Endpoint
+	client      *http.Client
+	failures    FailureStore
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	maxElapsed  time.Duration
+	codec       eventhus.EventCodec
+	now         func() time.Time
+	sleep       func(time.Duration)
+}
+
+// Option customizes the webhook client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client used for the deliveries
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithFailureStore sets where the failed deliveries are kept
+func WithFailureStore(store FailureStore) Option {
+	return func(c *Client) {
+		c.failures = store
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is tried before it's tracked as failed
+func WithMaxAttempts(attempts int) Option {
+	return func(c *Client) {
+		c.maxAttempts = attempts
+	}
+}
+
+// WithBackoff sets the wait before the first retry, it doubles on every attempt up to max
+func WithBackoff(initial, max time.Duration) Option {
+	return func(c *Client) {
+		c.backoff = initial
+		c.maxBackoff = max
+	}
+}
+
+// WithMaxElapsed sets the time after which a delivery isn't retried anymore
+func WithMaxElapsed(max time.Duration) Option {
+	return func(c *Client) {
+		c.maxElapsed = max
+	}
+}
+
+// WithCodec sets how the events are encoded
+func WithCodec(codec eventhus.EventCodec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// NewClient returns a client that sends the events to endpoints
+func NewClient(endpoints []Endpoint, options ...Option) *Client {
+	c := &Client{
+		endpoints:   endpoints,
+		client:      &http.Client{Timeout: DefaultTimeout},
+		failures:    NewMemoryFailureStore(),
+		maxAttempts: DefaultMaxAttempts,
+		backoff:     DefaultBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		maxElapsed:  DefaultMaxElapsed,
+		codec:       eventhus.JSONCodec{},
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}
+
+	for _, opt := range options {
+		opt(c)
+	}
+
+	if c.maxAttempts < 1 {
+		c.maxAttempts = 1
+	}
+
+	return c
+}
+
+// Publish sends the event to every matching endpoint, the failed ones are
+// reported in a *DeliveryError
+func (c *Client) Publish(event eventhus.Event, bucket, subset string) error {
+	msg, err := c.codec.Encode(event, bucket, subset)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []Delivery
+	var secrets []string
+	for _, endpoint := range c.endpoints {
+		if !endpoint.Matches(event, bucket, subset) {
+			continue
+		}
+
+		id, err := utils.UUID()
+		if err != nil {
+			return err
+		}
+
+		deliveries = append(deliveries, Delivery{
+			ID:          id,
+			Endpoint:    endpoint.name(),
+			URL:         endpoint.URL,
+			Bucket:      bucket,
+			Subset:      subset,
+			EventType:   event.Type,
+			ContentType: msg.ContentType,
+			Header:      msg.Header,
+			Body:        msg.Body,
+		})
+		secrets = append(secrets, endpoint.Secret)
+	}
+
+	errs := make([]error, len(deliveries))
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.deliver(&deliveries[i], secrets[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []Delivery
+	for i, delivery := range deliveries {
+		if errs[i] == nil {
+			continue
+		}
+
+		if err = c.failures.Save(delivery); err != nil {
+			return err
+		}
+
+		failed = append(failed, delivery)
+	}
+
+	if len(failed) > 0 {
+		return &DeliveryError{Deliveries: failed}
+	}
+
+	return nil
+}
+
+// SetCodec sets how the events are encoded
+func (c *Client) SetCodec(codec eventhus.EventCodec) {
+	c.codec = codec
+}
+
+// Failed returns the deliveries waiting to be sent again
+func (c *Client) Failed() ([]Delivery, error) {
+	return c.failures.All()
+}
+
+// Redeliver sends again the failed deliveries, the ones that succeed are removed
+// from the store; it returns how many were delivered
+func (c *Client) Redeliver() (int, error) {
+	deliveries, err := c.failures.All()
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		if c.redeliver(&delivery) != nil {
+			if err = c.failures.Save(delivery); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if err = c.failures.Remove(delivery.ID); err != nil {
+			return delivered, err
+		}
+
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// redeliver sends a failed delivery with the current secret of its endpoint
+func (c *Client) redeliver(delivery *Delivery) error {
+	for _, endpoint := range c.endpoints {
+		if endpoint.name() == delivery.Endpoint {
+			return c.deliver(delivery, endpoint.Secret)
+		}
+	}
+
+	delivery.Error = ErrUnknownEndpoint.Error()
+	delivery.FailedAt = c.now()
+	return ErrUnknownEndpoint
+}
+
+// deliver tries to send the delivery up to maxAttempts times within maxElapsed,
+// Attempts, Error and FailedAt are updated on failure
+func (c *Client) deliver(delivery *Delivery, secret string) error {
+	backoff := c.backoff
+	deadline := c.now().Add(c.maxElapsed)
+
+	var err error
+	for attempt := 0; attempt < c.maxAttempts; attempt++ {
+		if attempt > 0 {
+			if c.now().Add(backoff).After(deadline) {
+				break
+			}
+
+			c.sleep(backoff)
+
+			backoff *= 2
+			if backoff > c.maxBackoff {
+				backoff = c.maxBackoff
+			}
+		}
+
+		delivery.Attempts++
+
+		var retry bool
+		if retry, err = c.post(*delivery, secret); err == nil || !retry {
+			break
+		}
+	}
+
+	if err != nil {
+		delivery.Error = err.Error()
+		delivery.FailedAt = c.now()
+	}
+
+	return err
+}
+
+// post sends the delivery once, retry reports whether the failure is temporary
+func (c *Client) post(delivery Delivery, secret string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(c.now().Unix(), 10)
+	req.Header.Set("Content-Type", delivery.ContentType)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, delivery.Body))
+
+	for key, value := range delivery.Header {
+		req.Header.Set(headerPrefix+key, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	// drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+
+	// the other client errors won't change on a retry
+	retry = resp.StatusCode >= 500 ||
+		resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+
+	return retry, err
+}
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256 of
+// `timestamp.body` keyed with secret, prefixed with `sha256=`
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery, a zero tolerance uses
+// DefaultTolerance
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	return verify(secret, header, body, tolerance, time.Now())
+}
+
+func verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp := header.Get(TimestampHeader)
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(SignatureHeader))) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	return nil
+}
+
+// MemoryFailureStore keeps the failed deliveries in memory
+type MemoryFailureStore struct {
+	mu         sync.RWMutex
+	deliveries []Delivery
+	size       int
+}
+
+// NewMemoryFailureStore returns an empty store of DefaultMaxFailures deliveries
+func NewMemoryFailureStore() *MemoryFailureStore {
+	return NewMemoryFailureStoreWithSize(DefaultMaxFailures)
+}
+
+// NewMemoryFailureStoreWithSize returns an empty store of size deliveries
+func NewMemoryFailureStoreWithSize(size int) *MemoryFailureStore {
+	return &MemoryFailureStore{size: size}
+}
+
+// Save adds or replaces a delivery, a new one fails with ErrFailureStoreFull
+// once the store holds its size
+func (m *MemoryFailureStore) Save(delivery Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			m.deliveries[i] = delivery
+			return nil
+		}
+	}
+
+	if len(m.deliveries) >= m.size {
+		return ErrFailureStoreFull
+	}
+
+	m.deliveries = append(m.deliveries, delivery)
+	return nil
+}
+
+// Remove a delivery
+func (m *MemoryFailureStore) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == id {
+			m.deliveries = append(m.deliveries[:i], m.deliveries[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// All the failed deliveries, oldest first
+func (m *MemoryFailureStore) All() ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := make([]Delivery, len(m.deliveries))
+	copy(deliveries, m.deliveries)
+	return deliveries, nil
+}
@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func newClient(endpoints []Endpoint, options ...Option) (*Client, *[]time.Duration) {
+	var waits []time.Duration
+
+	c := NewClient(endpoints, options...)
+	c.sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+
+	return c, &waits
+}
+
+func TestPublishSignsDeliveries(t *testing.T) {
+	rec := &recorder{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c, _ := newClient([]Endpoint{{URL: server.URL, Secret: "s3cr3t"}})
+
+	event := eventhus.Event{ID: "1", AggregateID: "a", Type: "AccountCreated"}
+	if err := c.Publish(event, "bank", "account"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if rec.count() != 1 {
+		t.Fatal("expected 1 request, got", rec.count())
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+	if err := Verify("s3cr3t", req.Header, body, 0); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := Verify("other", req.Header, body, 0); err != ErrInvalidSignature {
+		t.Errorf("expected %v, got %v", ErrInvalidSignature, err)
+	}
+
+	if req.Header.Get(EventTypeHeader) != "AccountCreated" {
+		t.Error("expected AccountCreated, got", req.Header.Get(EventTypeHeader))
+	}
+
+	var received eventhus.Event
+	if err := json.Unmarshal(body, &received); err != nil || received.ID != "1" {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestPublishMatchesEndpoints(t *testing.T) {
+	accounts, transfers := &recorder{}, &recorder{}
+	accountServer, transferServer := httptest.NewServer(accounts), httptest.NewServer(transfers)
+	defer accountServer.Close()
+	defer transferServer.Close()
+
+	c, _ := newClient([]Endpoint{
+		{URL: accountServer.URL, Bucket: "bank", Subset: "account"},
+		{URL: transferServer.URL, EventTypes: []string{"TransferSent"}},
+	})
+
+	c.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account")
+	c.Publish(eventhus.Event{Type: "TransferSent"}, "bank", "transfer")
+
+	if accounts.count() != 1 {
+		t.Error("expected 1 request, got", accounts.count())
+	}
+
+	if transfers.count() != 1 {
+		t.Error("expected 1 request, got", transfers.count())
+	}
+}
+
+func TestPublishRetriesWithBackoff(t *testing.T) {
+	rec := &recorder{statuses: []int{500, 503, 429}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c, waits := newClient([]Endpoint{{URL: server.URL}}, WithBackoff(time.Second, 3*time.Second), WithMaxAttempts(5), WithMaxElapsed(time.Minute))
+
+	if err := c.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if rec.count() != 4 {
+		t.Error("expected 4 requests, got", rec.count())
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	if len(*waits) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, *waits)
+	}
+
+	for i := range expected {
+		if (*waits)[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, *waits)
+		}
+	}
+
+	// the same delivery ID is sent on every attempt
+	if rec.requests[0].Header.Get(DeliveryHeader) != rec.requests[3].Header.Get(DeliveryHeader) {
+		t.Error("expected the same delivery ID")
+	}
+}
+
+func TestPublishDoesNotRetryClientErrors(t *testing.T) {
+	rec := &recorder{statuses: []int{400}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c, _ := newClient([]Endpoint{{URL: server.URL}})
+
+	err := c.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account")
+	if _, ok := err.(*DeliveryError); !ok {
+		t.Fatal("expected a *DeliveryError, got", err)
+	}
+
+	if rec.count() != 1 {
+		t.Error("expected 1 request, got", rec.count())
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	rec := &recorder{statuses: []int{500, 500}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c, _ := newClient([]Endpoint{{Name: "ledger", URL: server.URL, Secret: "old"}}, WithMaxAttempts(2))
+
+	// the failed delivery is signed with the current secret of its endpoint
+	other, _ := newClient([]Endpoint{{Name: "ledger", URL: server.URL, Secret: "s3cr3t"}}, WithFailureStore(c.failures))
+
+	err := c.Publish(eventhus.Event{ID: "1", Type: "AccountCreated"}, "bank", "account")
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	failed, _ := c.Failed()
+	if len(failed) != 1 {
+		t.Fatal("expected 1 failed delivery, got", len(failed))
+	}
+
+	if failed[0].Endpoint != "ledger" || failed[0].Attempts != 2 || failed[0].Error == "" || failed[0].FailedAt.IsZero() {
+		t.Errorf("unexpected delivery %+v", failed[0])
+	}
+
+	delivered, err := other.Redeliver()
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if delivered != 1 {
+		t.Error("expected 1, got", delivered)
+	}
+
+	if failed, _ = c.Failed(); len(failed) != 0 {
+		t.Error("expected 0 failed deliveries, got", len(failed))
+	}
+
+	last := rec.count() - 1
+	if err = Verify("s3cr3t", rec.requests[last].Header, rec.bodies[last], 0); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
+
+func TestVerifyRejectsStaleTimestamps(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	body := []byte(`{"id":"1"}`)
+
+	cases := []struct {
+		sent time.Time
+		err  error
+	}{
+		{now.Add(-time.Minute), nil},
+		{now.Add(-10 * time.Minute), ErrStaleTimestamp},
+		{now.Add(10 * time.Minute), ErrStaleTimestamp},
+	}
+
+	for _, c := range cases {
+		timestamp := strconv.FormatInt(c.sent.Unix(), 10)
+		header := http.Header{}
+		header.Set(TimestampHeader, timestamp)
+		header.Set(SignatureHeader, Sign("s3cr3t", timestamp, body))
+
+		if err := verify("s3cr3t", header, body, 5*time.Minute, now); err != c.err {
+			t.Errorf("expected %v, got %v", c.err, err)
+		}
+	}
+
+	header := http.Header{}
+	header.Set(SignatureHeader, Sign("s3cr3t", "", body))
+	if err := verify("s3cr3t", header, body, 0, now); err != ErrStaleTimestamp {
+		t.Errorf("expected %v, got %v", ErrStaleTimestamp, err)
+	}
+}
+
+func TestPublishStopsRetryingAfterMaxElapsed(t *testing.T) {
+	rec := &recorder{statuses: []int{500, 500, 500, 500}}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	c, _ := newClient([]Endpoint{{URL: server.URL}}, WithBackoff(time.Second, time.Second), WithMaxElapsed(2500*time.Millisecond))
+
+	now := time.Now()
+	c.now = func() time.Time {
+		return now
+	}
+	c.sleep = func(d time.Duration) {
+		now = now.Add(d)
+	}
+
+	if _, ok := c.Publish(eventhus.Event{Type: "AccountCreated"}, "bank", "account").(*DeliveryError); !ok {
+		t.Fatal("expected a *DeliveryError")
+	}
+
+	if rec.count() != 3 {
+		t.Error("expected 3 requests, got", rec.count())
+	}
+}
+
+func TestRedeliverUnknownEndpoint(t *testing.T) {
+	store := NewMemoryFailureStore()
+	store.Save(Delivery{ID: "1", Endpoint: "removed", URL: "http://localhost"})
+
+	c, _ := newClient(nil, WithFailureStore(store))
+	if delivered, err := c.Redeliver(); err != nil || delivered != 0 {
+		t.Errorf("expected 0 and nil, got %d and %v", delivered, err)
+	}
+
+	failed, _ := c.Failed()
+	if len(failed) != 1 || failed[0].Error != ErrUnknownEndpoint.Error() {
+		t.Errorf("expected the delivery to be kept, got %+v", failed)
+	}
+}
+
+func TestMemoryFailureStoreSize(t *testing.T) {
+	store := NewMemoryFailureStoreWithSize(1)
+	if err := store.Save(Delivery{ID: "1"}); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := store.Save(Delivery{ID: "2"}); err != ErrFailureStoreFull {
+		t.Errorf("expected %v, got %v", ErrFailureStoreFull, err)
+	}
+
+	// a delivery already stored is updated
+	if err := store.Save(Delivery{ID: "1", Attempts: 2}); err != nil {
+		t.Error("expected nil, got", err)
+	}
+}
@@ -2,19 +2,19 @@ module github.com/mishudark/eventhus
 
 require (
 	github.com/AndreasBriese/bbloom v0.0.0-20180913140656-343706a395b7 // indirect
+	github.com/Shopify/sarama v1.27.2
+	github.com/alicebob/miniredis/v2 v2.23.0
 	github.com/dgraph-io/badger v1.5.4
 	github.com/dgryski/go-farm v0.0.0-20190104051053-3adb47b1fb0f // indirect
 	github.com/eclipse/paho.mqtt.golang v1.1.1
+	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
-	github.com/golang/protobuf v1.2.0 // indirect
-	github.com/nats-io/go-nats v1.7.0
-	github.com/nats-io/nkeys v0.0.2 // indirect
-	github.com/nats-io/nuid v1.0.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/nats-io/nats-server/v2 v2.2.6
+	github.com/nats-io/nats.go v1.11.0
 	github.com/oklog/ulid v1.3.1
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/streadway/amqp v0.0.0-20181205114330-a314942b2fd9
-	golang.org/x/net v0.0.0-20190119204137-ed066c81e75e // indirect
-	golang.org/x/sys v0.0.0-20190124100055-b90733256f2e // indirect
 	gopkg.in/mgo.v2 v2.0.0-20180705113604-9856a29383ce
 )
 
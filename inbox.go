@@ -0,0 +1,80 @@
+package eventhus
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrEventInProgress is returned by Claim while another delivery of the event
+// is being handled by the same consumer
+var ErrEventInProgress = errors.New("the event is being handled by the consumer")
+
+// InboxClaimLease is how long a consumer holds an event, a crashed consumer
+// releases it once the lease elapses
+var InboxClaimLease = time.Minute
+
+// InboxStore records the events processed by every consumer, so the events
+// redelivered by the broker are handled once
+type InboxStore interface {
+	Processed(consumer, key string) (bool, error)
+	// Claim atomically takes the event for consumer during lease, processed is
+	// true when it was already processed; it fails with ErrEventInProgress when
+	// another delivery holds it
+	Claim(consumer, key string, lease time.Duration) (processed bool, err error)
+	// MarkProcessed records the event as processed and drops its claim
+	MarkProcessed(consumer, key string, at time.Time) error
+	// Release drops the claim of the event, so a redelivery can process it
+	Release(consumer, key string) error
+	// Compact removes the records processed before the given time, it returns
+	// the quantity removed
+	Compact(before time.Time) (int, error)
+}
+
+// InboxKey identifies an event in the inbox, its ID or the aggregate and
+// version for the events without ID
+func InboxKey(event Event) string {
+	if event.ID != "" {
+		return event.ID
+	}
+
+	return event.AggregateID + "@" + strconv.Itoa(event.Version)
+}
+
+// Inbox is an EventHandle that skips the events already processed by its consumer
+type Inbox struct {
+	store    InboxStore
+	consumer string
+	handler  EventHandle
+	now      func() time.Time
+}
+
+// NewInbox wraps the handler of consumer, every consumer must have its own name
+func NewInbox(store InboxStore, consumer string, handler EventHandle) *Inbox {
+	return &Inbox{
+		store:    store,
+		consumer: consumer,
+		handler:  handler,
+		now:      time.Now,
+	}
+}
+
+// Handle an event unless it was already processed
+func (i *Inbox) Handle(event Event) error {
+	key := InboxKey(event)
+
+	// a concurrent delivery of the event fails with ErrEventInProgress, the
+	// broker redelivers it
+	processed, err := i.store.Claim(i.consumer, key, InboxClaimLease)
+	if err != nil || processed {
+		return err
+	}
+
+	if err = i.handler.Handle(event); err != nil {
+		// a claim that can't be released expires with its lease
+		i.store.Release(i.consumer, key)
+		return err
+	}
+
+	return i.store.MarkProcessed(i.consumer, key, i.now())
+}
@@ -0,0 +1,188 @@
+package badger
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mishudark/eventhus"
+)
+
+const keyPrefix = "inbox:"
+
+// claimPrefix prefixes the claims, they expire with their lease
+const claimPrefix = "inbox-claim:"
+
+// compactBatch is the quantity of records removed by every transaction of Compact
+const compactBatch = 1000
+
+// Client for access to BadgerDB
+type Client struct {
+	session   *badger.DB
+	retention time.Duration
+}
+
+// NewClient generates a new inbox store backed by BadgerDB, records older than
+// retention are discarded, a zero retention keeps them until compacted
+func NewClient(dbDir string, retention time.Duration) (*Client, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	session, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		session:   session,
+		retention: retention,
+	}, nil
+}
+
+// CloseClient closes the db connection
+func (c *Client) CloseClient() error {
+	return c.session.Close()
+}
+
+func key(consumer, id string) []byte {
+	return []byte(keyPrefix + consumer + "\x00" + id)
+}
+
+func claimKey(consumer, id string) []byte {
+	return []byte(claimPrefix + consumer + "\x00" + id)
+}
+
+// Processed reports whether consumer processed the event
+func (c *Client) Processed(consumer, id string) (bool, error) {
+	err := c.session.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(key(consumer, id))
+		return err
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// MarkProcessed records the event as processed by consumer
+func (c *Client) MarkProcessed(consumer, id string, at time.Time) error {
+	blob := []byte(strconv.FormatInt(at.UnixNano(), 10))
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(claimKey(consumer, id)); err != nil {
+			return err
+		}
+
+		if c.retention > 0 {
+			return txn.SetWithTTL(key(consumer, id), blob, c.retention)
+		}
+
+		return txn.Set(key(consumer, id), blob)
+	})
+}
+
+// Claim takes the event for consumer during lease, the claim is inserted only
+// if absent
+func (c *Client) Claim(consumer, id string, lease time.Duration) (bool, error) {
+	processed := false
+
+	err := c.session.Update(func(txn *badger.Txn) error {
+		_, err := txn.Get(key(consumer, id))
+		if err == nil {
+			processed = true
+			return nil
+		}
+
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		_, err = txn.Get(claimKey(consumer, id))
+		if err == nil {
+			return eventhus.ErrEventInProgress
+		}
+
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		return txn.SetWithTTL(claimKey(consumer, id), []byte{}, lease)
+	})
+
+	// a concurrent transaction claimed the event first
+	if err == badger.ErrConflict {
+		err = eventhus.ErrEventInProgress
+	}
+
+	return processed, err
+}
+
+// Release drops the claim of the event
+func (c *Client) Release(consumer, id string) error {
+	return c.session.Update(func(txn *badger.Txn) error {
+		return txn.Delete(claimKey(consumer, id))
+	})
+}
+
+// Compact removes the records processed before the given time
+func (c *Client) Compact(before time.Time) (int, error) {
+	var keys [][]byte
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+
+			at, err := strconv.ParseInt(string(val), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if at < before.UnixNano() {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	// the records are removed in batches, a transaction has a max size
+	removed := 0
+	for len(keys) > 0 {
+		n := compactBatch
+		if n > len(keys) {
+			n = len(keys)
+		}
+
+		err = c.session.Update(func(txn *badger.Txn) error {
+			for _, k := range keys[:n] {
+				if err := txn.Delete(k); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return removed, err
+		}
+
+		removed += n
+		keys = keys[n:]
+	}
+
+	return removed, nil
+}
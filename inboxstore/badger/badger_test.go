@@ -0,0 +1,89 @@
+package badger
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func TestClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-inbox")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir, 0)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	if processed, err := cli.Processed("projection", "1"); err != nil || processed {
+		t.Errorf("expected false and nil, got %v and %v", processed, err)
+	}
+
+	now := time.Now()
+	cli.MarkProcessed("projection", "1", now.Add(-time.Hour))
+	cli.MarkProcessed("projection", "2", now)
+
+	if processed, err := cli.Processed("projection", "1"); err != nil || !processed {
+		t.Errorf("expected true and nil, got %v and %v", processed, err)
+	}
+
+	if processed, _ := cli.Processed("audit", "1"); processed {
+		t.Error("expected the event not processed by audit")
+	}
+
+	removed, err := cli.Compact(now.Add(-time.Minute))
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 removed, got %d and %v", removed, err)
+	}
+
+	if processed, _ := cli.Processed("projection", "1"); processed {
+		t.Error("expected the record to be compacted")
+	}
+
+	if processed, _ := cli.Processed("projection", "2"); !processed {
+		t.Error("expected the record to be kept")
+	}
+}
+
+func TestClientClaim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-inbox")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir, 0)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	if processed, err := cli.Claim("projection", "1", time.Minute); err != nil || processed {
+		t.Errorf("expected false and nil, got %v and %v", processed, err)
+	}
+
+	if _, err := cli.Claim("projection", "1", time.Minute); err != eventhus.ErrEventInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrEventInProgress, err)
+	}
+
+	if processed, _ := cli.Processed("projection", "1"); processed {
+		t.Error("expected the claimed event not processed")
+	}
+
+	cli.Release("projection", "1")
+	if _, err := cli.Claim("projection", "1", time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	cli.MarkProcessed("projection", "1", time.Now())
+	if processed, err := cli.Claim("projection", "1", time.Minute); err != nil || !processed {
+		t.Errorf("expected true and nil, got %v and %v", processed, err)
+	}
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// record is a processed or claimed event
+type record struct {
+	processedAt  time.Time
+	claimedUntil time.Time
+}
+
+// Store keeps the processed events in memory
+type Store struct {
+	sync.RWMutex
+	records   map[string]record
+	retention time.Duration
+	purged    time.Time
+}
+
+// NewStore returns an inbox store, records older than retention are discarded,
+// a zero retention keeps them until compacted
+func NewStore(retention time.Duration) *Store {
+	return &Store{
+		records:   make(map[string]record),
+		retention: retention,
+		purged:    time.Now(),
+	}
+}
+
+func key(consumer, id string) string {
+	return consumer + "\x00" + id
+}
+
+// Processed reports whether consumer processed the event
+func (s *Store) Processed(consumer, id string) (bool, error) {
+	s.RLock()
+	r, ok := s.records[key(consumer, id)]
+	s.RUnlock()
+
+	return ok && s.processed(r, time.Now()), nil
+}
+
+// Claim takes the event for consumer during lease
+func (s *Store) Claim(consumer, id string, lease time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	r, ok := s.records[key(consumer, id)]
+	if ok && s.processed(r, now) {
+		return true, nil
+	}
+
+	if ok && r.processedAt.IsZero() && now.Before(r.claimedUntil) {
+		return false, eventhus.ErrEventInProgress
+	}
+
+	s.records[key(consumer, id)] = record{claimedUntil: now.Add(lease)}
+	return false, nil
+}
+
+// MarkProcessed records the event as processed by consumer
+func (s *Store) MarkProcessed(consumer, id string, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// the expired records are purged once per retention, memory is bounded by it
+	now := time.Now()
+	if s.retention > 0 && now.Sub(s.purged) > s.retention {
+		s.purge(now)
+	}
+
+	s.records[key(consumer, id)] = record{processedAt: at}
+	return nil
+}
+
+// Release drops the claim of the event
+func (s *Store) Release(consumer, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if r, ok := s.records[key(consumer, id)]; ok && r.processedAt.IsZero() {
+		delete(s.records, key(consumer, id))
+	}
+
+	return nil
+}
+
+// Compact removes the records processed before the given time and the expired claims
+func (s *Store) Compact(before time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	removed := 0
+	for stored, r := range s.records {
+		if r.processedAt.Before(before) && r.claimedUntil.Before(before) {
+			delete(s.records, stored)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+func (s *Store) purge(now time.Time) {
+	for stored, r := range s.records {
+		if r.processedAt.IsZero() && now.After(r.claimedUntil) || !r.processedAt.IsZero() && s.expired(r.processedAt, now) {
+			delete(s.records, stored)
+		}
+	}
+
+	s.purged = now
+}
+
+func (s *Store) processed(r record, now time.Time) bool {
+	return !r.processedAt.IsZero() && !s.expired(r.processedAt, now)
+}
+
+func (s *Store) expired(at, now time.Time) bool {
+	return s.retention > 0 && now.Sub(at) > s.retention
+}
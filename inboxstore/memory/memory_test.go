@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func TestInbox(t *testing.T) {
+	store := NewStore(0)
+
+	calls := 0
+	inbox := eventhus.NewInbox(store, "projection", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		calls++
+		return nil
+	}))
+
+	event := eventhus.Event{AggregateID: "1", Version: 2}
+	for i := 0; i < 2; i++ {
+		if err := inbox.Handle(event); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Error("expected 1 call, got", calls)
+	}
+
+	// other consumers process it
+	if processed, _ := store.Processed("audit", eventhus.InboxKey(event)); processed {
+		t.Error("expected the event not processed by audit")
+	}
+}
+
+func TestInboxConcurrentDelivery(t *testing.T) {
+	store := NewStore(0)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	inbox := eventhus.NewInbox(store, "projection", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		calls++
+		close(started)
+		<-release
+		return nil
+	}))
+
+	event := eventhus.Event{ID: "e-1"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := inbox.Handle(event); err != nil {
+			t.Error("expected nil, got", err)
+		}
+	}()
+
+	<-started
+	// the first delivery holds the claim
+	if err := inbox.Handle(event); err != eventhus.ErrEventInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrEventInProgress, err)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if err := inbox.Handle(event); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if calls != 1 {
+		t.Error("expected 1 call, got", calls)
+	}
+}
+
+func TestInboxReleasesFailedEvent(t *testing.T) {
+	store := NewStore(0)
+
+	fail := errors.New("expected error")
+	calls := 0
+	inbox := eventhus.NewInbox(store, "projection", eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		calls++
+		if calls == 1 {
+			return fail
+		}
+
+		return nil
+	}))
+
+	event := eventhus.Event{ID: "e-1"}
+	if err := inbox.Handle(event); err != fail {
+		t.Errorf("expected %v, got %v", fail, err)
+	}
+
+	// the redelivery is processed
+	if err := inbox.Handle(event); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if calls != 2 {
+		t.Error("expected 2 calls, got", calls)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	store := NewStore(time.Minute)
+	store.MarkProcessed("projection", "old", time.Now().Add(-time.Hour))
+	store.MarkProcessed("projection", "new", time.Now())
+
+	if processed, _ := store.Processed("projection", "old"); processed {
+		t.Error("expected expired record")
+	}
+
+	if processed, _ := store.Processed("projection", "new"); !processed {
+		t.Error("expected record to be found")
+	}
+
+	// the expired records are purged once the retention elapses since the last purge
+	store.purged = time.Now().Add(-time.Hour)
+	store.MarkProcessed("projection", "newer", time.Now())
+
+	if len(store.records) != 2 {
+		t.Error("expected 2 records after purge, got", len(store.records))
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	store := NewStore(0)
+	store.MarkProcessed("projection", "old", time.Now().Add(-time.Hour))
+	store.MarkProcessed("projection", "new", time.Now())
+
+	removed, err := store.Compact(time.Now().Add(-time.Minute))
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 removed, got %d and %v", removed, err)
+	}
+
+	if processed, _ := store.Processed("projection", "new"); !processed {
+		t.Error("expected record to be found")
+	}
+}
@@ -0,0 +1,256 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// DefaultTable is the table of the processed events
+const DefaultTable = "eventhus_inbox"
+
+// Placeholder returns the placeholder of the nth argument of a query
+type Placeholder func(n int) string
+
+// Question is the placeholder of mysql and sqlite
+func Question(n int) string {
+	return "?"
+}
+
+// Dollar is the placeholder of postgres
+func Dollar(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// TxHandler handles an event inside the transaction that records it as processed
+type TxHandler func(tx *sql.Tx, event eventhus.Event) error
+
+// Store keeps the processed events in a sql table
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+	now         func() time.Time
+}
+
+// Option customizes a Store
+type Option func(*Store)
+
+// WithTable sets the table of the processed events
+func WithTable(table string) Option {
+	return func(s *Store) {
+		s.table = table
+	}
+}
+
+// WithPlaceholder sets the placeholder of the driver, Question by default
+func WithPlaceholder(placeholder Placeholder) Option {
+	return func(s *Store) {
+		s.placeholder = placeholder
+	}
+}
+
+// NewStore returns an inbox store backed by db, the table is created with CreateTable
+func NewStore(db *sql.DB, options ...Option) *Store {
+	s := &Store{
+		db:          db,
+		table:       DefaultTable,
+		placeholder: Question,
+		now:         time.Now,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// CreateTable creates the table of the processed events if it doesn't exist
+func (s *Store) CreateTable() error {
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	consumer VARCHAR(255) NOT NULL,
+	event_key VARCHAR(255) NOT NULL,
+	processed_at BIGINT NOT NULL,
+	claimed_until BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (consumer, event_key)
+)`, s.table))
+
+	return err
+}
+
+// Processed reports whether consumer processed the event
+func (s *Store) Processed(consumer, key string) (bool, error) {
+	return s.processed(s.db, consumer, key)
+}
+
+// Claim takes the event for consumer during lease, the primary key makes the
+// insert of the claim atomic; an expired claim is taken over
+func (s *Store) Claim(consumer, key string, lease time.Duration) (bool, error) {
+	now := s.now()
+	until := now.Add(lease).UnixNano()
+
+	_, insertErr := s.db.Exec(
+		fmt.Sprintf("INSERT INTO %s (consumer, event_key, processed_at, claimed_until) VALUES (%s, %s, %s, %s)", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4)),
+		consumer, key, int64(0), until,
+	)
+
+	if insertErr == nil {
+		return false, nil
+	}
+
+	var processedAt, claimedUntil int64
+	err := s.db.QueryRow(
+		fmt.Sprintf("SELECT processed_at, claimed_until FROM %s WHERE consumer = %s AND event_key = %s", s.table, s.placeholder(1), s.placeholder(2)),
+		consumer, key,
+	).Scan(&processedAt, &claimedUntil)
+
+	// the insert didn't fail on the primary key
+	if err == sql.ErrNoRows {
+		return false, insertErr
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if processedAt > 0 {
+		return true, nil
+	}
+
+	if claimedUntil > now.UnixNano() {
+		return false, eventhus.ErrEventInProgress
+	}
+
+	// take over the expired claim unless another delivery did it first
+	n, err := s.update(s.db, int64(0), until, consumer, key, int64(0), claimedUntil)
+	if err == nil && n == 0 {
+		err = eventhus.ErrEventInProgress
+	}
+
+	return false, err
+}
+
+// Release drops the claim of the event
+func (s *Store) Release(consumer, key string) error {
+	_, err := s.db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE consumer = %s AND event_key = %s AND processed_at = %s", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3)),
+		consumer, key, int64(0),
+	)
+
+	return err
+}
+
+// MarkProcessed records the event as processed by consumer
+func (s *Store) MarkProcessed(consumer, key string, at time.Time) error {
+	return s.markProcessed(s.db, consumer, key, at)
+}
+
+// ProcessedTx is like Processed inside the transaction tx
+func (s *Store) ProcessedTx(tx *sql.Tx, consumer, key string) (bool, error) {
+	return s.processed(tx, consumer, key)
+}
+
+// MarkProcessedTx is like MarkProcessed inside the transaction tx, the record
+// is kept only if tx commits
+func (s *Store) MarkProcessedTx(tx *sql.Tx, consumer, key string, at time.Time) error {
+	return s.markProcessed(tx, consumer, key, at)
+}
+
+func (s *Store) processed(q querier, consumer, key string) (bool, error) {
+	var n int
+	err := q.QueryRow(
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE consumer = %s AND event_key = %s AND processed_at > 0", s.table, s.placeholder(1), s.placeholder(2)),
+		consumer, key,
+	).Scan(&n)
+
+	return n > 0, err
+}
+
+// markProcessed turns the claim of the event into a record, or inserts it
+func (s *Store) markProcessed(q querier, consumer, key string, at time.Time) error {
+	n, err := s.update(q, at.UnixNano(), int64(0), consumer, key)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = q.Exec(
+		fmt.Sprintf("INSERT INTO %s (consumer, event_key, processed_at, claimed_until) VALUES (%s, %s, %s, %s)", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4)),
+		consumer, key, at.UnixNano(), int64(0),
+	)
+
+	return err
+}
+
+// update sets processed_at and claimed_until of the event, the optional
+// expected values guard the update; it returns the quantity of rows updated
+func (s *Store) update(q querier, processedAt, claimedUntil int64, consumer, key string, expected ...int64) (int64, error) {
+	query := fmt.Sprintf("UPDATE %s SET processed_at = %s, claimed_until = %s WHERE consumer = %s AND event_key = %s", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	args := []interface{}{processedAt, claimedUntil, consumer, key}
+	if len(expected) == 2 {
+		query += fmt.Sprintf(" AND processed_at = %s AND claimed_until = %s", s.placeholder(5), s.placeholder(6))
+		args = append(args, expected[0], expected[1])
+	}
+
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// Compact removes the records processed before the given time and the claims
+// expired by then
+func (s *Store) Compact(before time.Time) (int, error) {
+	res, err := s.db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE processed_at < %s AND claimed_until < %s", s.table, s.placeholder(1), s.placeholder(2)),
+		before.UnixNano(), before.UnixNano(),
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Handler returns an EventHandle that runs handler and records the event in the
+// same transaction
+func (s *Store) Handler(consumer string, handler TxHandler) eventhus.EventHandle {
+	return eventhus.EventHandleFunc(func(event eventhus.Event) error {
+		key := eventhus.InboxKey(event)
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		processed, err := s.processed(tx, consumer, key)
+		if err != nil || processed {
+			tx.Rollback()
+			return err
+		}
+
+		if err = handler(tx, event); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = s.markProcessed(tx, consumer, key, s.now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,149 @@
+//go:build cgo
+// +build cgo
+
+package sql
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mishudark/eventhus"
+)
+
+// newStore returns a store backed by an in-memory sqlite database
+func newStore(t *testing.T) *Store {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// every connection opens its own in-memory database
+	conn.SetMaxOpenConns(1)
+
+	store := NewStore(conn)
+	if err = store.CreateTable(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return store
+}
+
+// count returns the rows of table
+func count(t *testing.T, store *Store, table string) int {
+	var n int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return n
+}
+
+func TestStore(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	now := time.Now()
+	store.MarkProcessed("projection", "1", now.Add(-time.Hour))
+	store.MarkProcessed("projection", "2", now)
+
+	if processed, err := store.Processed("projection", "1"); err != nil || !processed {
+		t.Errorf("expected true and nil, got %v and %v", processed, err)
+	}
+
+	if processed, _ := store.Processed("audit", "1"); processed {
+		t.Error("expected the event not processed by audit")
+	}
+
+	removed, err := store.Compact(now.Add(-time.Minute))
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 removed, got %d and %v", removed, err)
+	}
+
+	if processed, _ := store.Processed("projection", "1"); processed {
+		t.Error("expected the record to be compacted")
+	}
+}
+
+func TestStoreHandler(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	if _, err := store.db.Exec("CREATE TABLE balances (account VARCHAR(255) NOT NULL, amount BIGINT NOT NULL)"); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	calls := 0
+	fail := errors.New("expected error")
+	handler := store.Handler("projection", func(tx *sql.Tx, event eventhus.Event) error {
+		calls++
+		if _, err := tx.Exec("INSERT INTO balances (account, amount) VALUES (?, ?)", event.AggregateID, int64(10)); err != nil {
+			return err
+		}
+
+		if calls == 1 {
+			return fail
+		}
+
+		return nil
+	})
+
+	event := eventhus.Event{ID: "e-1", AggregateID: "account-1"}
+
+	// the writes of the failed handler are rolled back with the record
+	if err := handler.Handle(event); err != fail {
+		t.Errorf("expected %v, got %v", fail, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := handler.Handle(event); err != nil {
+			t.Fatal("expected nil, got", err)
+		}
+	}
+
+	if calls != 2 {
+		t.Error("expected 2 calls, got", calls)
+	}
+
+	if n := count(t, store, "balances"); n != 1 {
+		t.Error("expected 1 balance, got", n)
+	}
+}
+
+func TestStoreClaim(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	if processed, err := store.Claim("projection", "1", time.Minute); err != nil || processed {
+		t.Errorf("expected false and nil, got %v and %v", processed, err)
+	}
+
+	if _, err := store.Claim("projection", "1", time.Minute); err != eventhus.ErrEventInProgress {
+		t.Errorf("expected %v, got %v", eventhus.ErrEventInProgress, err)
+	}
+
+	if processed, _ := store.Processed("projection", "1"); processed {
+		t.Error("expected the claimed event not processed")
+	}
+
+	store.Release("projection", "1")
+	if _, err := store.Claim("projection", "1", -time.Second); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	// the expired claim is taken over
+	if _, err := store.Claim("projection", "1", time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	store.MarkProcessed("projection", "1", time.Now())
+	if processed, err := store.Claim("projection", "1", time.Minute); err != nil || !processed {
+		t.Errorf("expected true and nil, got %v and %v", processed, err)
+	}
+
+	if n := count(t, store, DefaultTable); n != 1 {
+		t.Error("expected 1 record, got", n)
+	}
+}
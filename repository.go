@@ -34,12 +34,40 @@ func (r *Repository) Save(aggregate AggregateHandler, version int) error {
 	return r.eventStore.Save(aggregate.Uncommited(), version)
 }
 
+// PublishOption customizes how PublishEvents sends the events
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	atomic bool
+}
+
+// AtomicBatch publishes the uncommitted events of the aggregate in a single
+// EventBatch, the consumers unpack it with UnpackBatch
+func AtomicBatch() PublishOption {
+	return func(o *publishOptions) {
+		o.atomic = true
+	}
+}
+
 // PublishEvents to an eventBus
-func (r *Repository) PublishEvents(aggregate AggregateHandler, bucket, subset string) error {
-	var err error
+func (r *Repository) PublishEvents(aggregate AggregateHandler, bucket, subset string, options ...PublishOption) error {
+	var opts publishOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
 
-	for _, event := range aggregate.Uncommited() {
-		if err = r.eventBus.Publish(event, bucket, subset); err != nil {
+	events := aggregate.Uncommited()
+	if opts.atomic && len(events) > 1 {
+		batch, err := NewBatchEvent(events)
+		if err != nil {
+			return err
+		}
+
+		return r.eventBus.Publish(batch, bucket, subset)
+	}
+
+	for _, event := range events {
+		if err := r.eventBus.Publish(event, bucket, subset); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,190 @@
+package eventhus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoWildcard is returned by Pattern when a field of the template can't be
+// known before the events are published and the transport has no wildcards
+var ErrNoWildcard = errors.New("the topic depends on the event and the transport has no wildcards")
+
+// ErrEmptyField is returned by Route when a field of the template is empty for
+// the event, e.g. a metadata key it doesn't have
+var ErrEmptyField = errors.New("empty topic field")
+
+// Fields of the topic templates
+const (
+	FieldBucket        = "bucket"
+	FieldSubset        = "subset"
+	FieldAggregateType = "aggregateType"
+	FieldAggregateID   = "aggregateID"
+	FieldEventType     = "eventType"
+	// FieldMetadata prefixes the keys of the metadata, e.g. `{metadata.tenant}`
+	FieldMetadata = "metadata."
+)
+
+// Router computes the topic, subject or routing key of the events
+type Router interface {
+	// Route returns the topic of an event published to bucket and subset
+	Route(event Event, bucket, subset string) (string, error)
+	// Pattern returns the topic that matches all the events of bucket and
+	// subset, the fields that depend on the event are replaced by wildcard
+	Pattern(bucket, subset, wildcard string) (string, error)
+}
+
+// RouterSetter is implemented by the event buses able to change how the topics are computed
+type RouterSetter interface {
+	SetRouter(router Router)
+}
+
+// TopicSubscriber is implemented by the event buses able to subscribe to a topic
+// computed with their Router, it can contain the wildcards of the transport
+type TopicSubscriber interface {
+	SubscribeTopic(topic string, handler EventHandle) (Subscription, error)
+}
+
+// templatePart is a literal or a field of a template
+type templatePart struct {
+	literal string
+	field   string
+}
+
+// TopicTemplate is a Router that replaces the fields between braces with the
+// values of the event, e.g. `{bucket}.{aggregateType}.{eventType}`
+type TopicTemplate struct {
+	template string
+	parts    []templatePart
+}
+
+// NewTopicTemplate parses a template
+func NewTopicTemplate(template string) (*TopicTemplate, error) {
+	t := &TopicTemplate{template: template}
+
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: rest})
+			break
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed field in template %q", template)
+		}
+
+		field := rest[start+1 : start+end]
+		if !validField(field) {
+			return nil, fmt.Errorf("unknown field %q in template %q", field, template)
+		}
+
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:start]})
+		}
+
+		t.parts = append(t.parts, templatePart{field: field})
+		rest = rest[start+end+1:]
+	}
+
+	return t, nil
+}
+
+// MustTopicTemplate is like NewTopicTemplate but panics if the template is invalid
+func MustTopicTemplate(template string) *TopicTemplate {
+	t, err := NewTopicTemplate(template)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func validField(field string) bool {
+	switch field {
+	case FieldBucket, FieldSubset, FieldAggregateType, FieldAggregateID, FieldEventType:
+		return true
+	}
+
+	return strings.HasPrefix(field, FieldMetadata) && len(field) > len(FieldMetadata)
+}
+
+// String returns the template
+func (t *TopicTemplate) String() string {
+	return t.template
+}
+
+// Route returns the topic of an event, it fails with ErrEmptyField when a
+// field has no value
+func (t *TopicTemplate) Route(event Event, bucket, subset string) (string, error) {
+	var err error
+	topic := t.Expand(func(field string) string {
+		var value string
+		switch field {
+		case FieldBucket:
+			value = bucket
+		case FieldSubset:
+			value = subset
+		case FieldAggregateType:
+			value = event.AggregateType
+		case FieldAggregateID:
+			value = event.AggregateID
+		case FieldEventType:
+			value = event.Type
+		default:
+			value = event.Metadata[strings.TrimPrefix(field, FieldMetadata)]
+		}
+
+		if value == "" && err == nil {
+			err = fmt.Errorf("%w {%s} in %q", ErrEmptyField, field, t.template)
+		}
+
+		return value
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return topic, nil
+}
+
+// Pattern returns the topic of all the events of bucket and subset
+func (t *TopicTemplate) Pattern(bucket, subset, wildcard string) (string, error) {
+	return t.Filter(map[string]string{FieldBucket: bucket, FieldSubset: subset}, wildcard)
+}
+
+// Filter returns the topic that matches the events with the given values, the
+// other fields are replaced by wildcard
+func (t *TopicTemplate) Filter(values map[string]string, wildcard string) (string, error) {
+	var err error
+	topic := t.Expand(func(field string) string {
+		if value, ok := values[field]; ok {
+			return value
+		}
+
+		if wildcard == "" {
+			err = ErrNoWildcard
+		}
+
+		return wildcard
+	})
+
+	return topic, err
+}
+
+// Expand builds the topic with the values returned by value
+func (t *TopicTemplate) Expand(value func(field string) string) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.field == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+
+		b.WriteString(value(part.field))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package eventhus
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTopicTemplateRoute(t *testing.T) {
+	router, err := NewTopicTemplate("{bucket}.{aggregateType}.{eventType}.{metadata.tenant}")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	event := Event{
+		AggregateType: "Account",
+		Type:          "WithdrawalPerformed",
+		Metadata:      map[string]string{"tenant": "acme"},
+	}
+
+	topic, err := router.Route(event, "bank", "account")
+	if err != nil || topic != "bank.Account.WithdrawalPerformed.acme" {
+		t.Errorf("expected bank.Account.WithdrawalPerformed.acme, got %s %v", topic, err)
+	}
+
+	// without the tenant the topic would be bank.Account.WithdrawalPerformed.
+	event.Metadata = nil
+	if _, err = router.Route(event, "bank", "account"); !errors.Is(err, ErrEmptyField) {
+		t.Errorf("expected %v, got %v", ErrEmptyField, err)
+	}
+}
+
+func TestTopicTemplatePattern(t *testing.T) {
+	router := MustTopicTemplate("{bucket}/{subset}/{eventType}")
+
+	topic, err := router.Pattern("bank", "account", "+")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if topic != "bank/account/+" {
+		t.Error("expected bank/account/+, got", topic)
+	}
+
+	if _, err = router.Pattern("bank", "account", ""); err != ErrNoWildcard {
+		t.Errorf("expected %v, got %v", ErrNoWildcard, err)
+	}
+
+	topic, err = MustTopicTemplate("{bucket}:{subset}").Pattern("bank", "account", "")
+	if err != nil || topic != "bank:account" {
+		t.Errorf("expected bank:account, got %s %v", topic, err)
+	}
+}
+
+func TestNewTopicTemplateErrors(t *testing.T) {
+	for _, template := range []string{"{bucket", "{unknown}", "{}", "{metadata.}"} {
+		if _, err := NewTopicTemplate(template); err == nil {
+			t.Errorf("expected an error for %q, got nil", template)
+		}
+	}
+}
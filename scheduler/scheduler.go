@@ -0,0 +1,205 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/utils"
+)
+
+// DefaultLease is how long a command is hidden from other dispatchers while
+// it's handed off to the bus
+const DefaultLease = time.Minute
+
+// Scheduler dispatches commands to a command bus once they are due, the
+// scheduled commands are persisted so they survive restarts
+type Scheduler struct {
+	store    eventhus.ScheduleStore
+	bus      eventhus.CommandBus
+	types    *eventhus.CommandRegister
+	interval time.Duration
+	lease    time.Duration
+	onError  func(error)
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// UndecodableError is reported for a scheduled command that can't be decoded,
+// it's removed from the store and Data keeps it
+type UndecodableError struct {
+	ID   string
+	Data []byte
+	Err  error
+}
+
+func (e *UndecodableError) Error() string {
+	return fmt.Sprintf("decode scheduled command %s: %s", e.ID, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *UndecodableError) Unwrap() error {
+	return e.Err
+}
+
+// Option customizes a Scheduler
+type Option func(*Scheduler)
+
+// WithLease sets how long a command is leased while it's dispatched, a command
+// whose dispatch didn't complete is dispatched again once it expires
+func WithLease(lease time.Duration) Option {
+	return func(s *Scheduler) {
+		s.lease = lease
+	}
+}
+
+// WithErrorHandler sets the func notified when a dispatch fails, the errors are
+// logged by default
+func WithErrorHandler(handler func(error)) Option {
+	return func(s *Scheduler) {
+		s.onError = handler
+	}
+}
+
+// NewScheduler returns a started scheduler that checks the store every interval,
+// commands lists the types of commands that can be scheduled
+func NewScheduler(store eventhus.ScheduleStore, bus eventhus.CommandBus, interval time.Duration, commands ...interface{}) *Scheduler {
+	return NewSchedulerWithOptions(store, bus, interval, commands)
+}
+
+// NewSchedulerWithOptions is like NewScheduler with options
+func NewSchedulerWithOptions(store eventhus.ScheduleStore, bus eventhus.CommandBus, interval time.Duration, commands []interface{}, options ...Option) *Scheduler {
+	types := eventhus.NewCommandRegister()
+	for _, command := range commands {
+		types.Add(command, nil)
+	}
+
+	s := &Scheduler{
+		store:    store,
+		bus:      bus,
+		types:    types,
+		interval: interval,
+		lease:    DefaultLease,
+		onError: func(err error) {
+			log.Println("scheduler: dispatch failed:", err)
+		},
+		done: make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+// Schedule a command to be dispatched at dueAt, it returns the ID to cancel it
+func (s *Scheduler) Schedule(command eventhus.Command, dueAt time.Time) (string, error) {
+	if _, err := s.types.New(eventhus.CommandTypeName(command)); err != nil {
+		return "", err
+	}
+
+	blob, err := eventhus.MarshalCommand(command)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := utils.UUID()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.Save(eventhus.ScheduledCommand{
+		ID:    id,
+		Data:  blob,
+		DueAt: dueAt,
+	})
+
+	return id, err
+}
+
+// ScheduleAfter dispatches a command once delay has passed
+func (s *Scheduler) ScheduleAfter(command eventhus.Command, delay time.Duration) (string, error) {
+	return s.Schedule(command, time.Now().Add(delay))
+}
+
+// Cancel a scheduled command, it returns eventhus.ErrScheduledCommandNotFound
+// if it was already dispatched
+func (s *Scheduler) Cancel(id string) error {
+	return s.store.Delete(id)
+}
+
+// Close stops dispatching commands
+func (s *Scheduler) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		// commands due while the process was down are dispatched right away
+		if err := s.Dispatch(time.Now()); err != nil {
+			s.onError(err)
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch the commands due at now, the failures of a command are reported and
+// the next ones dispatched
+func (s *Scheduler) Dispatch(now time.Time) error {
+	due, err := s.store.Due(now)
+	if err != nil {
+		return err
+	}
+
+	for _, scheduled := range due {
+		if err = s.dispatch(scheduled, now); err != nil {
+			s.onError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) dispatch(scheduled eventhus.ScheduledCommand, now time.Time) error {
+	command, err := eventhus.UnmarshalCommand(scheduled.Data, s.types)
+	if err != nil {
+		// it would be due forever
+		if err := s.store.Delete(scheduled.ID); err != nil && err != eventhus.ErrScheduledCommandNotFound {
+			return fmt.Errorf("delete scheduled command %s: %w", scheduled.ID, err)
+		}
+
+		return &UndecodableError{ID: scheduled.ID, Data: scheduled.Data, Err: err}
+	}
+
+	// a cancellation or another dispatcher won the race, don't dispatch it
+	if err = s.store.Lease(scheduled.ID, now, s.lease); err == eventhus.ErrScheduledCommandNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("lease scheduled command %s: %w", scheduled.ID, err)
+	}
+
+	s.bus.HandleCommand(command)
+
+	if err = s.store.Delete(scheduled.ID); err != nil && err != eventhus.ErrScheduledCommandNotFound {
+		return fmt.Errorf("delete scheduled command %s: %w", scheduled.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+	"github.com/mishudark/eventhus/schedulestore/memory"
+)
+
+type ExpireReservation struct {
+	eventhus.BaseCommand
+}
+
+type unknownCommand struct {
+	eventhus.BaseCommand
+}
+
+type busStub struct {
+	sync.Mutex
+	commands []eventhus.Command
+}
+
+func (b *busStub) HandleCommand(command eventhus.Command) {
+	b.Lock()
+	b.commands = append(b.commands, command)
+	b.Unlock()
+}
+
+func (b *busStub) count() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return len(b.commands)
+}
+
+func TestSchedulerDispatch(t *testing.T) {
+	bus := &busStub{}
+	s := NewScheduler(memory.NewStore(), bus, time.Hour, ExpireReservation{})
+	defer s.Close()
+
+	command := ExpireReservation{}
+	command.AggregateID = "123"
+
+	now := time.Now()
+	if _, err := s.Schedule(command, now.Add(15*time.Minute)); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	s.Dispatch(now)
+	if bus.count() != 0 {
+		t.Error("expected 0 commands, got", bus.count())
+	}
+
+	s.Dispatch(now.Add(15 * time.Minute))
+	if bus.count() != 1 {
+		t.Fatal("expected 1 command, got", bus.count())
+	}
+
+	if bus.commands[0].(ExpireReservation).AggregateID != "123" {
+		t.Errorf("unexpected command %+v", bus.commands[0])
+	}
+
+	// dispatched commands are removed
+	s.Dispatch(now.Add(time.Hour))
+	if bus.count() != 1 {
+		t.Error("expected 1 command, got", bus.count())
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	bus := &busStub{}
+	s := NewScheduler(memory.NewStore(), bus, time.Hour, ExpireReservation{})
+	defer s.Close()
+
+	id, _ := s.ScheduleAfter(ExpireReservation{}, time.Minute)
+	if err := s.Cancel(id); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := s.Cancel(id); err != eventhus.ErrScheduledCommandNotFound {
+		t.Error("expected ErrScheduledCommandNotFound, got", err)
+	}
+
+	s.Dispatch(time.Now().Add(time.Hour))
+	if bus.count() != 0 {
+		t.Error("expected 0 commands, got", bus.count())
+	}
+}
+
+func TestSchedulerUnknownCommand(t *testing.T) {
+	s := NewScheduler(memory.NewStore(), &busStub{}, time.Hour, ExpireReservation{})
+	defer s.Close()
+
+	if _, err := s.ScheduleAfter(unknownCommand{}, time.Minute); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestSchedulerDispatchesOverdueOnStart(t *testing.T) {
+	store := memory.NewStore()
+	bus := &busStub{}
+
+	first := NewScheduler(store, bus, time.Hour, ExpireReservation{})
+	first.Close()
+	first.Schedule(ExpireReservation{}, time.Now().Add(-time.Minute))
+
+	second := NewScheduler(store, bus, time.Hour, ExpireReservation{})
+	defer second.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for bus.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if bus.count() != 1 {
+		t.Error("expected 1 command, got", bus.count())
+	}
+}
+
+// leaseBus checks the command is kept in the store while it's handled
+type leaseBus struct {
+	store  *memory.Store
+	leased int
+	due    int
+}
+
+func (b *leaseBus) HandleCommand(command eventhus.Command) {
+	leased, _ := b.store.Due(time.Now())
+	due, _ := b.store.Due(time.Now().Add(2 * time.Minute))
+	b.leased, b.due = len(leased), len(due)
+}
+
+func TestSchedulerLeasesBeforeHandOff(t *testing.T) {
+	store := memory.NewStore()
+	bus := &leaseBus{store: store}
+	s := NewScheduler(store, bus, time.Hour, ExpireReservation{})
+	defer s.Close()
+
+	now := time.Now()
+	s.Schedule(ExpireReservation{}, now)
+	s.Dispatch(now)
+
+	// the command is hidden by its lease, but still stored
+	if bus.leased != 0 {
+		t.Error("expected 0 due commands while leased, got", bus.leased)
+	}
+
+	if bus.due != 1 {
+		t.Error("expected 1 due command during the hand off, got", bus.due)
+	}
+
+	if due, _ := store.Due(now.Add(time.Hour)); len(due) != 0 {
+		t.Error("expected the command to be deleted, got", len(due))
+	}
+}
+
+type failingStore struct {
+	*memory.Store
+}
+
+func (f failingStore) Due(now time.Time) ([]eventhus.ScheduledCommand, error) {
+	return nil, errors.New("expected error")
+}
+
+func TestSchedulerReportsDispatchErrors(t *testing.T) {
+	failed := make(chan error, 1)
+	s := NewSchedulerWithOptions(failingStore{memory.NewStore()}, &busStub{}, time.Hour, []interface{}{ExpireReservation{}}, WithErrorHandler(func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}))
+	defer s.Close()
+
+	select {
+	case err := <-failed:
+		if err.Error() != "expected error" {
+			t.Error("expected error, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the dispatch error to be reported")
+	}
+}
+
+func TestSchedulerReportsUndecodableCommands(t *testing.T) {
+	store := memory.NewStore()
+	var reported []error
+	s := NewSchedulerWithOptions(store, &busStub{}, time.Hour, []interface{}{ExpireReservation{}}, WithErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+	s.Close()
+
+	now := time.Now()
+	store.Save(eventhus.ScheduledCommand{ID: "broken", Data: []byte("{"), DueAt: now})
+	if err := s.Dispatch(now); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	var undecodable *UndecodableError
+	if len(reported) != 1 || !errors.As(reported[0], &undecodable) {
+		t.Fatal("expected an UndecodableError, got", reported)
+	}
+
+	if undecodable.ID != "broken" || string(undecodable.Data) != "{" {
+		t.Errorf("expected the broken command, got %s %s", undecodable.ID, undecodable.Data)
+	}
+
+	if due, _ := store.Due(now.Add(time.Hour)); len(due) != 0 {
+		t.Error("expected the command to be deleted, got", len(due))
+	}
+}
+
+type leaseFailingStore struct {
+	*memory.Store
+	id string
+}
+
+func (f *leaseFailingStore) Lease(id string, now time.Time, lease time.Duration) error {
+	if id == f.id {
+		return errors.New("expected error")
+	}
+
+	return f.Store.Lease(id, now, lease)
+}
+
+func TestSchedulerKeepsDispatchingAfterAFailure(t *testing.T) {
+	store := &leaseFailingStore{Store: memory.NewStore()}
+	bus := &busStub{}
+	var reported []error
+	s := NewSchedulerWithOptions(store, bus, time.Hour, []interface{}{ExpireReservation{}}, WithErrorHandler(func(err error) {
+		reported = append(reported, err)
+	}))
+	s.Close()
+
+	now := time.Now()
+	store.id, _ = s.Schedule(ExpireReservation{}, now.Add(-time.Minute))
+	s.Schedule(ExpireReservation{}, now)
+
+	if err := s.Dispatch(now); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	if len(reported) != 1 {
+		t.Error("expected 1 error, got", reported)
+	}
+
+	if bus.count() != 1 {
+		t.Error("expected 1 command, got", bus.count())
+	}
+}
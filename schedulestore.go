@@ -0,0 +1,36 @@
+package eventhus
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrScheduledCommandNotFound the scheduled command doesn't exist or was already dispatched
+var ErrScheduledCommandNotFound = errors.New("scheduled command not found")
+
+// ScheduledCommand is a serialized command to be dispatched at DueAt
+type ScheduledCommand struct {
+	ID    string    `json:"id"`
+	Data  []byte    `json:"data"`
+	DueAt time.Time `json:"due_at"`
+	// LeasedUntil hides the command from Due while it's being dispatched
+	LeasedUntil time.Time `json:"leased_until,omitempty"`
+}
+
+// Leased reports whether the command is being dispatched at now
+func (c ScheduledCommand) Leased(now time.Time) bool {
+	return c.LeasedUntil.After(now)
+}
+
+// ScheduleStore persists the scheduled commands until they are dispatched
+type ScheduleStore interface {
+	Save(command ScheduledCommand) error
+	// Delete a scheduled command, it returns ErrScheduledCommandNotFound if missing
+	Delete(id string) error
+	// Lease hides a command from Due until now plus lease while it's dispatched,
+	// it returns ErrScheduledCommandNotFound if missing or already leased
+	Lease(id string, now time.Time, lease time.Duration) error
+	// Due returns the commands whose due time is not after now and that aren't
+	// leased, oldest first
+	Due(now time.Time) ([]ScheduledCommand, error)
+}
@@ -0,0 +1,140 @@
+package badger
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger"
+	"github.com/mishudark/eventhus"
+)
+
+const keyPrefix = "schedule:"
+
+// Client for access to BadgerDB
+type Client struct {
+	session *badger.DB
+}
+
+// NewClient generates a new schedule store backed by BadgerDB
+func NewClient(dbDir string) (*Client, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dbDir
+	opts.ValueDir = dbDir
+	session, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		session,
+	}, nil
+}
+
+// CloseClient closes the db connection
+func (c *Client) CloseClient() error {
+	return c.session.Close()
+}
+
+// Save a scheduled command
+func (c *Client) Save(command eventhus.ScheduledCommand) error {
+	blob, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	return c.session.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(keyPrefix+command.ID), blob)
+	})
+}
+
+// Delete a scheduled command
+func (c *Client) Delete(id string) error {
+	return c.session.Update(func(txn *badger.Txn) error {
+		key := []byte(keyPrefix + id)
+		if _, err := txn.Get(key); err == badger.ErrKeyNotFound {
+			return eventhus.ErrScheduledCommandNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return txn.Delete(key)
+	})
+}
+
+// Lease a command while it's dispatched, concurrent leases conflict
+func (c *Client) Lease(id string, now time.Time, lease time.Duration) error {
+	err := c.session.Update(func(txn *badger.Txn) error {
+		key := []byte(keyPrefix + id)
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return eventhus.ErrScheduledCommandNotFound
+		} else if err != nil {
+			return err
+		}
+
+		val, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		var command eventhus.ScheduledCommand
+		if err = json.Unmarshal(val, &command); err != nil {
+			return err
+		}
+
+		if command.Leased(now) {
+			return eventhus.ErrScheduledCommandNotFound
+		}
+
+		command.LeasedUntil = now.Add(lease)
+		blob, err := json.Marshal(command)
+		if err != nil {
+			return err
+		}
+
+		return txn.Set(key, blob)
+	})
+
+	// another dispatcher leased it first
+	if err == badger.ErrConflict {
+		return eventhus.ErrScheduledCommandNotFound
+	}
+
+	return err
+}
+
+// Due returns the commands ready to be dispatched
+func (c *Client) Due(now time.Time) ([]eventhus.ScheduledCommand, error) {
+	var due []eventhus.ScheduledCommand
+
+	err := c.session.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(keyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			val, err := it.Item().Value()
+			if err != nil {
+				return err
+			}
+
+			var command eventhus.ScheduledCommand
+			if err = json.Unmarshal(val, &command); err != nil {
+				return err
+			}
+
+			if !command.DueAt.After(now) && !command.Leased(now) {
+				due = append(due, command)
+			}
+		}
+
+		return nil
+	})
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+
+	return due, err
+}
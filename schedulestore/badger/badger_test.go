@@ -0,0 +1,96 @@
+package badger
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+func TestClientDue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-schedule")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	now := time.Now()
+	cli.Save(eventhus.ScheduledCommand{ID: "later", DueAt: now.Add(time.Hour)})
+	cli.Save(eventhus.ScheduledCommand{ID: "second", DueAt: now.Add(-time.Minute)})
+	cli.Save(eventhus.ScheduledCommand{ID: "first", DueAt: now.Add(-time.Hour)})
+
+	due, err := cli.Due(now)
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(due) != 2 || due[0].ID != "first" || due[1].ID != "second" {
+		t.Errorf("unexpected due commands %+v", due)
+	}
+}
+
+func TestClientDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-schedule")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	cli.Save(eventhus.ScheduledCommand{ID: "1", DueAt: time.Now()})
+
+	if err = cli.Delete("1"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err = cli.Delete("1"); err != eventhus.ErrScheduledCommandNotFound {
+		t.Error("expected ErrScheduledCommandNotFound, got", err)
+	}
+}
+
+func TestClientLease(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-schedule")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli, err := NewClient(dir)
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	defer cli.CloseClient()
+
+	now := time.Now()
+	cli.Save(eventhus.ScheduledCommand{ID: "1", DueAt: now.Add(-time.Minute)})
+
+	if err = cli.Lease("1", now, time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err = cli.Lease("1", now, time.Minute); err != eventhus.ErrScheduledCommandNotFound {
+		t.Error("expected ErrScheduledCommandNotFound, got", err)
+	}
+
+	if due, _ := cli.Due(now); len(due) != 0 {
+		t.Error("expected 0 due commands, got", len(due))
+	}
+
+	// the command is dispatched again once the lease expires
+	if due, _ := cli.Due(now.Add(2 * time.Minute)); len(due) != 1 {
+		t.Error("expected 1 due command, got", len(due))
+	}
+}
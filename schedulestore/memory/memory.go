@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// Store keeps the scheduled commands in memory, they are lost on restart
+type Store struct {
+	sync.RWMutex
+	commands map[string]eventhus.ScheduledCommand
+}
+
+// NewStore returns an empty schedule store
+func NewStore() *Store {
+	return &Store{
+		commands: make(map[string]eventhus.ScheduledCommand),
+	}
+}
+
+// Save a scheduled command
+func (s *Store) Save(command eventhus.ScheduledCommand) error {
+	s.Lock()
+	s.commands[command.ID] = command
+	s.Unlock()
+
+	return nil
+}
+
+// Delete a scheduled command
+func (s *Store) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.commands[id]; !ok {
+		return eventhus.ErrScheduledCommandNotFound
+	}
+
+	delete(s.commands, id)
+	return nil
+}
+
+// Lease a command while it's dispatched
+func (s *Store) Lease(id string, now time.Time, lease time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	command, ok := s.commands[id]
+	if !ok || command.Leased(now) {
+		return eventhus.ErrScheduledCommandNotFound
+	}
+
+	command.LeasedUntil = now.Add(lease)
+	s.commands[id] = command
+	return nil
+}
+
+// Due returns the commands ready to be dispatched
+func (s *Store) Due(now time.Time) ([]eventhus.ScheduledCommand, error) {
+	var due []eventhus.ScheduledCommand
+
+	s.RLock()
+	for _, command := range s.commands {
+		if !command.DueAt.After(now) && !command.Leased(now) {
+			due = append(due, command)
+		}
+	}
+	s.RUnlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DueAt.Before(due[j].DueAt)
+	})
+
+	return due, nil
+}
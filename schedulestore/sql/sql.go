@@ -0,0 +1,169 @@
+package sql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mishudark/eventhus"
+)
+
+// DefaultTable is the table of the scheduled commands
+const DefaultTable = "eventhus_schedule"
+
+// Placeholder returns the placeholder of the nth argument of a query
+type Placeholder func(n int) string
+
+// Question is the placeholder of mysql and sqlite
+func Question(n int) string {
+	return "?"
+}
+
+// Dollar is the placeholder of postgres
+func Dollar(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Store keeps the scheduled commands in a sql table
+type Store struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+// Option customizes a Store
+type Option func(*Store)
+
+// WithTable sets the table of the scheduled commands
+func WithTable(table string) Option {
+	return func(s *Store) {
+		s.table = table
+	}
+}
+
+// WithPlaceholder sets the placeholder of the driver, Question by default
+func WithPlaceholder(placeholder Placeholder) Option {
+	return func(s *Store) {
+		s.placeholder = placeholder
+	}
+}
+
+// NewStore returns a schedule store backed by db, the table is created with CreateTable
+func NewStore(db *sql.DB, options ...Option) *Store {
+	s := &Store{
+		db:          db,
+		table:       DefaultTable,
+		placeholder: Question,
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// CreateTable creates the table of the scheduled commands if it doesn't exist
+func (s *Store) CreateTable() error {
+	_, err := s.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) NOT NULL PRIMARY KEY,
+	data TEXT NOT NULL,
+	due_at BIGINT NOT NULL,
+	leased_until BIGINT NOT NULL DEFAULT 0
+)`, s.table))
+
+	return err
+}
+
+// Save a scheduled command
+func (s *Store) Save(command eventhus.ScheduledCommand) error {
+	_, err := s.db.Exec(
+		fmt.Sprintf("INSERT INTO %s (id, data, due_at, leased_until) VALUES (%s, %s, %s, %s)", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4)),
+		command.ID, string(command.Data), nanos(command.DueAt), nanos(command.LeasedUntil),
+	)
+
+	return err
+}
+
+// Delete a scheduled command
+func (s *Store) Delete(id string) error {
+	res, err := s.db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE id = %s", s.table, s.placeholder(1)),
+		id,
+	)
+
+	return notFound(res, err)
+}
+
+// Lease a command while it's dispatched, the update is guarded by the expiry
+// of the previous lease so concurrent dispatchers can't both lease it
+func (s *Store) Lease(id string, now time.Time, lease time.Duration) error {
+	res, err := s.db.Exec(
+		fmt.Sprintf("UPDATE %s SET leased_until = %s WHERE id = %s AND leased_until <= %s", s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3)),
+		now.Add(lease).UnixNano(), id, now.UnixNano(),
+	)
+
+	return notFound(res, err)
+}
+
+// Due returns the commands ready to be dispatched
+func (s *Store) Due(now time.Time) ([]eventhus.ScheduledCommand, error) {
+	rows, err := s.db.Query(
+		fmt.Sprintf("SELECT id, data, due_at, leased_until FROM %s WHERE due_at <= %s AND leased_until <= %s ORDER BY due_at", s.table, s.placeholder(1), s.placeholder(2)),
+		now.UnixNano(), now.UnixNano(),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []eventhus.ScheduledCommand
+	for rows.Next() {
+		var command eventhus.ScheduledCommand
+		var data string
+		var dueAt, leasedUntil int64
+
+		if err = rows.Scan(&command.ID, &data, &dueAt, &leasedUntil); err != nil {
+			return nil, err
+		}
+
+		command.Data = []byte(data)
+		command.DueAt = fromNanos(dueAt)
+		command.LeasedUntil = fromNanos(leasedUntil)
+		due = append(due, command)
+	}
+
+	return due, rows.Err()
+}
+
+// notFound turns an update of no rows into eventhus.ErrScheduledCommandNotFound
+func notFound(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return eventhus.ErrScheduledCommandNotFound
+	}
+
+	return err
+}
+
+// nanos encodes the zero time as 0
+func nanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func fromNanos(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
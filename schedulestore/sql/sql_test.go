@@ -0,0 +1,118 @@
+//go:build cgo
+// +build cgo
+
+package sql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/mishudark/eventhus"
+)
+
+// newStore returns a store backed by an in-memory sqlite database
+func newStore(t *testing.T, options ...Option) *Store {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// every connection opens its own in-memory database
+	conn.SetMaxOpenConns(1)
+
+	store := NewStore(conn, options...)
+	if err = store.CreateTable(); err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	return store
+}
+
+func TestStoreDue(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	now := time.Now()
+	store.Save(eventhus.ScheduledCommand{ID: "later", Data: []byte("{}"), DueAt: now.Add(time.Hour)})
+	store.Save(eventhus.ScheduledCommand{ID: "second", Data: []byte("{}"), DueAt: now.Add(-time.Minute)})
+	store.Save(eventhus.ScheduledCommand{ID: "first", Data: []byte(`{"id":1}`), DueAt: now.Add(-time.Hour)})
+
+	due, err := store.Due(now)
+	if err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if len(due) != 2 || due[0].ID != "first" || due[1].ID != "second" {
+		t.Fatalf("unexpected due commands %+v", due)
+	}
+
+	if string(due[0].Data) != `{"id":1}` || !due[0].DueAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected command %+v", due[0])
+	}
+}
+
+func TestStoreLease(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	now := time.Now()
+	store.Save(eventhus.ScheduledCommand{ID: "1", Data: []byte("{}"), DueAt: now.Add(-time.Minute)})
+
+	if err := store.Lease("1", now, time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := store.Lease("1", now, time.Minute); err != eventhus.ErrScheduledCommandNotFound {
+		t.Error("expected ErrScheduledCommandNotFound, got", err)
+	}
+
+	if due, _ := store.Due(now); len(due) != 0 {
+		t.Error("expected 0 due commands, got", len(due))
+	}
+
+	if due, _ := store.Due(now.Add(2 * time.Minute)); len(due) != 1 {
+		t.Error("expected 1 due command, got", len(due))
+	}
+
+	if err := store.Delete("1"); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := store.Delete("1"); err != eventhus.ErrScheduledCommandNotFound {
+		t.Error("expected ErrScheduledCommandNotFound, got", err)
+	}
+}
+
+func TestStoreSaveDuplicate(t *testing.T) {
+	store := newStore(t)
+	defer store.db.Close()
+
+	command := eventhus.ScheduledCommand{ID: "1", Data: []byte("{}"), DueAt: time.Now()}
+	if err := store.Save(command); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := store.Save(command); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestStoreWithOptions(t *testing.T) {
+	store := newStore(t, WithTable("schedule"), WithPlaceholder(Dollar))
+	defer store.db.Close()
+
+	now := time.Now()
+	if err := store.Save(eventhus.ScheduledCommand{ID: "1", Data: []byte("{}"), DueAt: now}); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if err := store.Lease("1", now, time.Minute); err != nil {
+		t.Error("expected nil, got", err)
+	}
+
+	if due, _ := store.Due(now.Add(2 * time.Minute)); len(due) != 1 {
+		t.Error("expected 1 due command, got", len(due))
+	}
+}